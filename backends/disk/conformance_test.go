@@ -0,0 +1,59 @@
+package disk_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/disk"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// open opens a Queue in a temporary directory which is closed when the
+// test completes.
+func open(t *testing.T, opts ...disk.Option) *disk.Queue {
+	t.Helper()
+
+	q, err := disk.Open(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		q := open(t)
+		c := make(chan *msg.Message, 100)
+
+		srv := disk.NewServer(q, 10)
+		go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			c <- m
+			return nil
+		}))
+		t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+		return msgtest.TopicFixture{
+			Topic: disk.NewTopic(q),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case m := <-c:
+					return m, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		q := open(t)
+		return msgtest.ServerFixture{
+			Server: disk.NewServer(q, 10),
+			Topic:  disk.NewTopic(q),
+		}
+	})
+}
@@ -0,0 +1,627 @@
+// Package disk provides a durable queue backend which stores Messages in a
+// write-ahead log on the local filesystem.
+//
+// A Queue is a directory of segment files. Published Messages are appended
+// to the active segment, and acknowledged once a Receiver processes them
+// successfully. When a Queue is opened, every Message which has not been
+// acknowledged is delivered again, so Messages survive process restarts
+// and crashes.
+//
+// Segments are rotated once they reach a maximum size. Segments in which
+// every Message has been acknowledged are deleted, and Compact rewrites the
+// remaining Messages of old segments so that they can be deleted too.
+//
+// A Queue may only be opened by a single process at a time.
+package disk
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// ErrQueueClosed is returned by operations on a closed Queue.
+var ErrQueueClosed = errors.New("disk: queue closed")
+
+const segmentExt = ".wal"
+
+// Queue is a durable, file-backed message queue.
+// It is safe to use from concurrent goroutines.
+type Queue struct {
+	dir            string
+	maxSegmentSize int64
+	syncWrites     bool
+
+	mux      sync.Mutex
+	closed   bool
+	nextID   uint64
+	segments map[uint64]*segment
+	active   *segment
+	entries  map[uint64]*entry
+	ready    readyQueue
+
+	// notify is closed and replaced whenever a Message becomes ready
+	notify chan struct{}
+}
+
+// segment is a single file of the write-ahead log.
+type segment struct {
+	id   uint64
+	file *os.File
+	size int64
+
+	// pending is the number of unacknowledged Messages in the segment
+	pending int
+}
+
+// entry is an unacknowledged Message.
+type entry struct {
+	id      uint64
+	segment *segment
+	offset  int64
+	size    int
+
+	publishedAt time.Time
+	visibleAt   time.Time
+
+	receiveCount  int
+	firstReceived time.Time
+
+	// index is the position of the entry in the ready queue,
+	// or -1 if it is being processed.
+	index int
+}
+
+// Option is a functional option for a Queue.
+type Option func(*Queue)
+
+// WithMaxSegmentSize sets the size in bytes at which segments are rotated.
+// The default is 64 MiB.
+func WithMaxSegmentSize(n int64) Option {
+	return func(q *Queue) {
+		q.maxSegmentSize = n
+	}
+}
+
+// WithSyncWrites sets whether every write is flushed to stable storage
+// before it returns. It is enabled by default; disabling it trades
+// durability on power loss for throughput.
+func WithSyncWrites(sync bool) Option {
+	return func(q *Queue) {
+		q.syncWrites = sync
+	}
+}
+
+// Open opens the Queue stored in dir, creating it if it does not exist.
+// Messages which were not acknowledged before the Queue was last closed
+// become ready for delivery again.
+func Open(dir string, opts ...Option) (*Queue, error) {
+	q := &Queue{
+		dir:            dir,
+		maxSegmentSize: 64 << 20,
+		syncWrites:     true,
+		nextID:         1,
+		segments:       make(map[uint64]*segment),
+		entries:        make(map[uint64]*entry),
+		notify:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := q.replay(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Close closes the Queue. Messages which are being processed and have not
+// been acknowledged will be delivered again when the Queue is reopened.
+func (q *Queue) Close() error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.closed = true
+	close(q.notify)
+
+	return q.closeFiles()
+}
+
+// Len returns the number of unacknowledged Messages in the Queue.
+func (q *Queue) Len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	return len(q.entries)
+}
+
+func (q *Queue) closeFiles() error {
+	var errs []error
+	for _, s := range q.segments {
+		errs = append(errs, s.file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// replay reads every segment in order to rebuild the set of
+// unacknowledged Messages.
+func (q *Queue) replay() error {
+	names, err := filepath.Glob(filepath.Join(q.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+
+	var ids []uint64
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		s, err := q.openSegment(id)
+		if err != nil {
+			return err
+		}
+		if err := q.replaySegment(s, i == len(ids)-1); err != nil {
+			return fmt.Errorf("disk: could not replay segment %d: %w", id, err)
+		}
+		q.active = s
+	}
+
+	if q.active == nil || q.active.size >= q.maxSegmentSize {
+		var next uint64 = 1
+		if q.active != nil {
+			next = q.active.id + 1
+		}
+		s, err := q.openSegment(next)
+		if err != nil {
+			return err
+		}
+		q.active = s
+	}
+
+	for _, e := range q.entries {
+		heap.Push(&q.ready, e)
+	}
+	q.removeAcknowledgedSegments()
+	return nil
+}
+
+// replaySegment reads the records of s. A corrupt record at the end of the
+// last segment is the result of a crash during a write, and is truncated.
+func (q *Queue) replaySegment(s *segment, last bool) error {
+	r := bufio.NewReader(io.NewSectionReader(s.file, 0, s.size))
+
+	var offset int64
+	for {
+		rec, size, err := readRecord(r, s.size-offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err == errCorruptRecord && last {
+			s.size = offset
+			return s.file.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch rec.typ {
+		case recordMessage:
+			// a Message may appear again in a later segment after compaction
+			if e, ok := q.entries[rec.id]; ok {
+				e.segment.pending--
+			}
+			q.entries[rec.id] = &entry{
+				id:          rec.id,
+				segment:     s,
+				offset:      offset,
+				size:        size,
+				publishedAt: rec.publishedAt,
+				visibleAt:   rec.visibleAt,
+			}
+			s.pending++
+		case recordAck:
+			if e, ok := q.entries[rec.id]; ok {
+				e.segment.pending--
+				delete(q.entries, rec.id)
+			}
+		}
+
+		if rec.id >= q.nextID {
+			q.nextID = rec.id + 1
+		}
+		offset += int64(size)
+	}
+}
+
+func (q *Queue) openSegment(id uint64) (*segment, error) {
+	name := filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s := &segment{id: id, file: f, size: info.Size()}
+	q.segments[id] = s
+	return s, nil
+}
+
+// write appends a record to the active segment, rotating it if it is full.
+// It must be called with q.mux held.
+func (q *Queue) write(rec *record) (*segment, int64, int, error) {
+	if q.active.size >= q.maxSegmentSize {
+		if err := q.rotate(); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	b := rec.encode()
+	s := q.active
+	offset := s.size
+
+	if _, err := s.file.WriteAt(b, offset); err != nil {
+		return nil, 0, 0, err
+	}
+	if q.syncWrites {
+		if err := s.file.Sync(); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	s.size += int64(len(b))
+
+	return s, offset, len(b), nil
+}
+
+// rotate seals the active segment and starts a new one.
+// It must be called with q.mux held.
+func (q *Queue) rotate() error {
+	s, err := q.openSegment(q.active.id + 1)
+	if err != nil {
+		return err
+	}
+	q.active = s
+	q.removeAcknowledgedSegments()
+	return nil
+}
+
+// removeAcknowledgedSegments deletes the oldest sealed segments as long as
+// all of their Messages have been acknowledged. Segments are only deleted
+// in order, since a segment may hold acknowledgements for Messages in
+// earlier segments. It stops at the first segment which cannot be
+// deleted, which is tried again on the next call. It must be called with
+// q.mux held.
+func (q *Queue) removeAcknowledgedSegments() {
+	for _, id := range q.segmentIDs() {
+		s := q.segments[id]
+		if s == q.active || s.pending > 0 {
+			return
+		}
+		if err := q.removeSegment(s); err != nil {
+			return
+		}
+	}
+}
+
+// segmentIDs returns the IDs of the segments in ascending order.
+// It must be called with q.mux held.
+func (q *Queue) segmentIDs() []uint64 {
+	ids := make([]uint64, 0, len(q.segments))
+	for id := range q.segments {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// removeSegment deletes the file of s. The segment is only forgotten
+// once its file is deleted, so that a failed deletion is retried later.
+func (q *Queue) removeSegment(s *segment) error {
+	if err := os.Remove(s.file.Name()); err != nil {
+		return err
+	}
+	delete(q.segments, s.id)
+	return s.file.Close()
+}
+
+// Compact rewrites the unacknowledged Messages of sealed segments to the
+// active segment and deletes the sealed segments. It reclaims the space of
+// segments which are kept alive by a few long-lived Messages.
+//
+// The rewritten Messages may fill more than one segment, so only the
+// segments which were sealed when Compact was called are deleted. They are
+// deleted oldest first, so that a crash midway never leaves a Message
+// without the acknowledgement which follows it.
+func (q *Queue) Compact() error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	// seal the active segment, so that every existing segment can be removed
+	if err := q.rotate(); err != nil {
+		return err
+	}
+
+	sealed := q.segmentIDs()
+	sealed = sealed[:len(sealed)-1]
+	compacted := make(map[uint64]bool, len(sealed))
+	for _, id := range sealed {
+		compacted[id] = true
+	}
+
+	for _, e := range q.entries {
+		if !compacted[e.segment.id] {
+			continue
+		}
+		rec, err := q.read(e)
+		if err != nil {
+			return err
+		}
+		rec.visibleAt = e.visibleAt
+		s, offset, size, err := q.write(rec)
+		if err != nil {
+			return err
+		}
+		e.segment.pending--
+		e.segment, e.offset, e.size = s, offset, size
+		s.pending++
+	}
+
+	for _, id := range sealed {
+		// segments may have been deleted while the active one was rotated
+		s, ok := q.segments[id]
+		if !ok {
+			continue
+		}
+		if err := q.removeSegment(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads the record of e from its segment.
+// It must be called with q.mux held.
+func (q *Queue) read(e *entry) (*record, error) {
+	b := make([]byte, e.size)
+	if _, err := e.segment.file.ReadAt(b, e.offset); err != nil {
+		return nil, err
+	}
+	return decodeRecord(b)
+}
+
+// publish appends a Message to the Queue.
+func (q *Queue) publish(attrs msg.Attributes, body []byte, delay time.Duration) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	now := time.Now()
+	rec := &record{
+		typ:         recordMessage,
+		id:          q.nextID,
+		publishedAt: now,
+		visibleAt:   now,
+		attributes:  attrs,
+		body:        body,
+	}
+	if delay > 0 {
+		rec.visibleAt = now.Add(delay)
+	}
+
+	s, offset, size, err := q.write(rec)
+	if err != nil {
+		return err
+	}
+	q.nextID++
+
+	e := &entry{
+		id:          rec.id,
+		segment:     s,
+		offset:      offset,
+		size:        size,
+		publishedAt: rec.publishedAt,
+		visibleAt:   rec.visibleAt,
+	}
+	s.pending++
+	q.entries[e.id] = e
+	q.push(e)
+
+	return nil
+}
+
+// push makes e ready for delivery and wakes up waiting consumers.
+// It must be called with q.mux held.
+func (q *Queue) push(e *entry) {
+	heap.Push(&q.ready, e)
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// delivery is a Message which has been dequeued for processing.
+type delivery struct {
+	message *msg.Message
+	info    msg.DeliveryInfo
+	id      uint64
+}
+
+// next blocks until a Message is ready for delivery or ctx is done.
+func (q *Queue) next(ctx context.Context) (*delivery, error) {
+	for {
+		q.mux.Lock()
+		if q.closed {
+			q.mux.Unlock()
+			return nil, ErrQueueClosed
+		}
+
+		now := time.Now()
+		if len(q.ready) > 0 && !q.ready[0].visibleAt.After(now) {
+			e := heap.Pop(&q.ready).(*entry)
+			d, err := q.deliver(e, now)
+			q.mux.Unlock()
+			return d, err
+		}
+
+		// wait for the next Message to become visible, or a new one
+		var timer *time.Timer
+		var wait <-chan time.Time
+		if len(q.ready) > 0 {
+			timer = time.NewTimer(q.ready[0].visibleAt.Sub(now))
+			wait = timer.C
+		}
+		notify := q.notify
+		q.mux.Unlock()
+
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-notify:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// deliver reads the Message of e and records its delivery.
+// It must be called with q.mux held.
+func (q *Queue) deliver(e *entry, now time.Time) (*delivery, error) {
+	rec, err := q.read(e)
+	if err != nil {
+		return nil, err
+	}
+
+	e.receiveCount++
+	if e.firstReceived.IsZero() {
+		e.firstReceived = now
+	}
+
+	return &delivery{
+		message: &msg.Message{
+			Attributes: rec.attributes,
+			Body:       bytes.NewReader(rec.body),
+		},
+		info: msg.DeliveryInfo{
+			MessageID:     strconv.FormatUint(e.id, 10),
+			ReceiveCount:  e.receiveCount,
+			FirstReceived: e.firstReceived,
+			PublishTime:   e.publishedAt,
+		},
+		id: e.id,
+	}, nil
+}
+
+// ack acknowledges a delivered Message, removing it from the Queue.
+func (q *Queue) ack(id uint64) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	e, ok := q.entries[id]
+	if !ok {
+		return nil
+	}
+
+	if _, _, _, err := q.write(&record{typ: recordAck, id: id}); err != nil {
+		return err
+	}
+	delete(q.entries, id)
+	e.segment.pending--
+	q.removeAcknowledgedSegments()
+
+	return nil
+}
+
+// nack makes a delivered Message ready for delivery again after delay.
+func (q *Queue) nack(id uint64, delay time.Duration) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	e, ok := q.entries[id]
+	if !ok {
+		return nil
+	}
+
+	e.visibleAt = time.Now().Add(delay)
+	q.push(e)
+	return nil
+}
+
+// readyQueue is a min-heap of entries ordered by when they become visible.
+type readyQueue []*entry
+
+func (rq readyQueue) Len() int { return len(rq) }
+
+func (rq readyQueue) Less(i, j int) bool {
+	if rq[i].visibleAt.Equal(rq[j].visibleAt) {
+		return rq[i].id < rq[j].id
+	}
+	return rq[i].visibleAt.Before(rq[j].visibleAt)
+}
+
+func (rq readyQueue) Swap(i, j int) {
+	rq[i], rq[j] = rq[j], rq[i]
+	rq[i].index = i
+	rq[j].index = j
+}
+
+func (rq *readyQueue) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*rq)
+	*rq = append(*rq, e)
+}
+
+func (rq *readyQueue) Pop() any {
+	old := *rq
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*rq = old[:n-1]
+	return e
+}
@@ -0,0 +1,289 @@
+package disk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+func mustOpen(t *testing.T, dir string, opts ...Option) *Queue {
+	t.Helper()
+
+	q, err := Open(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func mustPublish(t *testing.T, q *Queue, body string) {
+	t.Helper()
+
+	attrs := msg.Attributes{}
+	attrs.Set("X-Body", body)
+	if err := q.publish(attrs, []byte(body), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustNext(t *testing.T, q *Queue) *delivery {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	d, err := q.next(ctx)
+	if err != nil {
+		t.Fatalf("could not dequeue message: %s", err)
+	}
+	return d
+}
+
+func assertBody(t *testing.T, d *delivery, want string) {
+	t.Helper()
+
+	body, err := msg.DumpBody(d.message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != want {
+		t.Errorf("expected body %q, got %q", want, body)
+	}
+	if got := d.message.Attributes.Get("X-Body"); got != want {
+		t.Errorf("expected attribute X-Body to be %q, got %q", want, got)
+	}
+}
+
+func segmentCount(t *testing.T, dir string) int {
+	t.Helper()
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(names)
+}
+
+// TestQueue_RedeliversAfterCrash asserts that Messages which were not
+// acknowledged are delivered again when the Queue is reopened.
+func TestQueue_RedeliversAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	q := mustOpen(t, dir)
+	mustPublish(t, q, "one")
+	mustPublish(t, q, "two")
+
+	d := mustNext(t, q)
+	assertBody(t, d, "one")
+	if err := q.ack(d.id); err != nil {
+		t.Fatal(err)
+	}
+
+	// "two" is dequeued but never acknowledged
+	assertBody(t, mustNext(t, q), "two")
+	q.Close()
+
+	q = mustOpen(t, dir)
+	defer q.Close()
+
+	if n := q.Len(); n != 1 {
+		t.Fatalf("expected 1 message after reopening, got %d", n)
+	}
+	d = mustNext(t, q)
+	assertBody(t, d, "two")
+	if d.info.ReceiveCount != 1 {
+		t.Errorf("expected receive count 1, got %d", d.info.ReceiveCount)
+	}
+
+	// new Messages must not reuse IDs of existing ones
+	mustPublish(t, q, "three")
+	if d2 := mustNext(t, q); d2.id <= d.id {
+		t.Errorf("expected ID greater than %d, got %d", d.id, d2.id)
+	}
+}
+
+// TestQueue_TruncatesTornWrite asserts that a record which was only
+// partially written when the process crashed is discarded.
+func TestQueue_TruncatesTornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	q := mustOpen(t, dir)
+	mustPublish(t, q, "one")
+	name := q.active.file.Name()
+	size := q.active.size
+	q.Close()
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 42})
+	f.Close()
+
+	q = mustOpen(t, dir)
+	defer q.Close()
+
+	if q.active.size != size {
+		t.Errorf("expected segment to be truncated to %d bytes, got %d", size, q.active.size)
+	}
+	assertBody(t, mustNext(t, q), "one")
+
+	mustPublish(t, q, "two")
+	assertBody(t, mustNext(t, q), "two")
+}
+
+// TestQueue_RotatesSegments asserts that segments are rotated once they
+// are full, and deleted once all of their Messages are acknowledged.
+func TestQueue_RotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	q := mustOpen(t, dir, WithMaxSegmentSize(64))
+	defer q.Close()
+
+	for _, body := range []string{"one", "two", "three", "four"} {
+		mustPublish(t, q, body)
+	}
+	if n := segmentCount(t, dir); n < 2 {
+		t.Fatalf("expected segments to be rotated, got %d segment", n)
+	}
+
+	for _, body := range []string{"one", "two", "three", "four"} {
+		d := mustNext(t, q)
+		assertBody(t, d, body)
+		if err := q.ack(d.id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustPublish(t, q, "five")
+
+	if n := segmentCount(t, dir); n != 1 {
+		t.Errorf("expected acknowledged segments to be deleted, got %d segments", n)
+	}
+}
+
+// TestQueue_Compact asserts that compaction moves unacknowledged Messages
+// out of old segments, which are then deleted.
+func TestQueue_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	q := mustOpen(t, dir, WithMaxSegmentSize(64))
+	for _, body := range []string{"one", "two", "three", "four"} {
+		mustPublish(t, q, body)
+	}
+
+	// acknowledge every Message but the first, which keeps all
+	// segments alive
+	first := mustNext(t, q)
+	for i := 0; i < 3; i++ {
+		if err := q.ack(mustNext(t, q).id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.nack(first.id, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if n := segmentCount(t, dir); n != 1 {
+		t.Errorf("expected 1 segment after compaction, got %d", n)
+	}
+	assertBody(t, mustNext(t, q), "one")
+	q.Close()
+
+	q = mustOpen(t, dir)
+	defer q.Close()
+
+	if n := q.Len(); n != 1 {
+		t.Fatalf("expected 1 message after reopening, got %d", n)
+	}
+	assertBody(t, mustNext(t, q), "one")
+}
+
+// TestQueue_CompactAcrossRotation asserts that Messages rewritten by
+// compaction survive when they fill more than one segment.
+func TestQueue_CompactAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	body := string(make([]byte, 100))
+	q := mustOpen(t, dir, WithMaxSegmentSize(200))
+	for i := 0; i < 10; i++ {
+		if err := q.publish(msg.Attributes{}, []byte(body), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.Len(); n != 10 {
+		t.Errorf("expected 10 messages after compaction, got %d", n)
+	}
+	q.Close()
+
+	q = mustOpen(t, dir, WithMaxSegmentSize(200))
+	defer q.Close()
+
+	if n := q.Len(); n != 10 {
+		t.Fatalf("expected 10 messages after reopening, got %d", n)
+	}
+	for i := 0; i < 10; i++ {
+		d := mustNext(t, q)
+		if b, _ := msg.DumpBody(d.message); string(b) != body {
+			t.Errorf("expected the body of message %s to be kept, got %d bytes", d.info.MessageID, len(b))
+		}
+	}
+}
+
+// TestQueue_TruncatesCorruptLength asserts that a record whose length
+// exceeds the rest of the segment is treated as a torn write.
+func TestQueue_TruncatesCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+
+	q := mustOpen(t, dir)
+	mustPublish(t, q, "one")
+	name := q.active.file.Name()
+	size := q.active.size
+	q.Close()
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0, 42})
+	f.Close()
+
+	q = mustOpen(t, dir)
+	defer q.Close()
+
+	if q.active.size != size {
+		t.Errorf("expected segment to be truncated to %d bytes, got %d", size, q.active.size)
+	}
+	assertBody(t, mustNext(t, q), "one")
+}
+
+// TestQueue_PersistsDelay asserts that the delay of a Message is honored
+// after the Queue is reopened.
+func TestQueue_PersistsDelay(t *testing.T) {
+	dir := t.TempDir()
+
+	q := mustOpen(t, dir)
+	if err := q.publish(msg.Attributes{}, []byte("later"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	q = mustOpen(t, dir)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if d, err := q.next(ctx); err == nil {
+		t.Errorf("expected delayed message not to be delivered, got %d", d.id)
+	}
+}
@@ -0,0 +1,196 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Records are stored in segments as a header followed by a payload:
+//
+//	length  uint32 // length of the payload
+//	crc     uint32 // CRC-32 (Castagnoli) of the payload
+//	payload []byte
+//
+// The payload starts with the record type and the message ID. Message
+// records continue with the publish and visibility times, the attributes
+// and finally the body.
+const headerSize = 8
+
+const (
+	recordMessage byte = 1
+	recordAck     byte = 2
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorruptRecord is returned when a record is truncated or fails
+// its checksum, which happens if the process crashed while writing it.
+var errCorruptRecord = errors.New("disk: corrupt record")
+
+// record is a decoded record.
+type record struct {
+	typ         byte
+	id          uint64
+	publishedAt time.Time
+	visibleAt   time.Time
+	attributes  msg.Attributes
+	body        []byte
+}
+
+// encode returns the framed encoding of r.
+func (r *record) encode() []byte {
+	payload := make([]byte, 0, 64+len(r.body))
+	payload = append(payload, r.typ)
+	payload = binary.BigEndian.AppendUint64(payload, r.id)
+
+	if r.typ == recordMessage {
+		payload = binary.BigEndian.AppendUint64(payload, uint64(r.publishedAt.UnixNano()))
+		payload = binary.BigEndian.AppendUint64(payload, uint64(r.visibleAt.UnixNano()))
+
+		payload = binary.AppendUvarint(payload, uint64(len(r.attributes)))
+		for k, vv := range r.attributes {
+			payload = appendString(payload, k)
+			payload = binary.AppendUvarint(payload, uint64(len(vv)))
+			for _, v := range vv {
+				payload = appendString(payload, v)
+			}
+		}
+		payload = append(payload, r.body...)
+	}
+
+	b := make([]byte, headerSize, headerSize+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.Checksum(payload, crcTable))
+	return append(b, payload...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readRecord reads a single framed record from r, which holds n more
+// bytes. It returns io.EOF if r is exhausted, and errCorruptRecord if the
+// record is incomplete or damaged, including when its length exceeds
+// what is left of r. The returned size is the number of bytes the record
+// occupies.
+func readRecord(r *bufio.Reader, n int64) (*record, int, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, errCorruptRecord
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if int64(length) > n-headerSize {
+		// a damaged length must not make us allocate up to 4 GiB
+		return nil, 0, errCorruptRecord
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errCorruptRecord
+	}
+
+	rec, err := decodePayload(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec, headerSize + int(length), nil
+}
+
+// decodeRecord decodes a framed record which has been read in full.
+func decodeRecord(b []byte) (*record, error) {
+	if len(b) < headerSize {
+		return nil, errCorruptRecord
+	}
+	payload := b[headerSize:]
+	if int(binary.BigEndian.Uint32(b[0:4])) != len(payload) ||
+		crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(b[4:8]) {
+		return nil, errCorruptRecord
+	}
+	return decodePayload(payload)
+}
+
+func decodePayload(p []byte) (*record, error) {
+	if len(p) < 9 {
+		return nil, errCorruptRecord
+	}
+	r := &record{
+		typ: p[0],
+		id:  binary.BigEndian.Uint64(p[1:9]),
+	}
+	p = p[9:]
+
+	switch r.typ {
+	case recordAck:
+		return r, nil
+	case recordMessage:
+	default:
+		return nil, errCorruptRecord
+	}
+
+	if len(p) < 16 {
+		return nil, errCorruptRecord
+	}
+	r.publishedAt = time.Unix(0, int64(binary.BigEndian.Uint64(p[0:8])))
+	r.visibleAt = time.Unix(0, int64(binary.BigEndian.Uint64(p[8:16])))
+	p = p[16:]
+
+	n, p, err := readUvarint(p)
+	if err != nil {
+		return nil, err
+	}
+	r.attributes = make(msg.Attributes, n)
+	for i := uint64(0); i < n; i++ {
+		var k string
+		if k, p, err = readString(p); err != nil {
+			return nil, err
+		}
+		var nv uint64
+		if nv, p, err = readUvarint(p); err != nil {
+			return nil, err
+		}
+		vv := make([]string, 0, nv)
+		for j := uint64(0); j < nv; j++ {
+			var v string
+			if v, p, err = readString(p); err != nil {
+				return nil, err
+			}
+			vv = append(vv, v)
+		}
+		r.attributes[k] = vv
+	}
+	r.body = p
+
+	return r, nil
+}
+
+func readUvarint(p []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, nil, errCorruptRecord
+	}
+	return v, p[n:], nil
+}
+
+func readString(p []byte) (string, []byte, error) {
+	n, p, err := readUvarint(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(p)) < n {
+		return "", nil, errCorruptRecord
+	}
+	return string(p[:n]), p[n:], nil
+}
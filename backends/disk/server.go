@@ -0,0 +1,150 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server delivers the Messages of a Queue to a Receiver.
+//
+// A Message is acknowledged, and removed from the Queue, once Receive
+// returns nil or a permanent error. Otherwise it is delivered again,
+// after the delay requested with msg.RetryAfter if any.
+type Server struct {
+	Queue *Queue
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed
+func (s *Server) Serve(r msg.Receiver) error {
+	for {
+		// acquire "lock"
+		select {
+		case <-s.listenerCtx.Done():
+			return msg.ErrServerClosed
+		case s.maxConcurrentReceives <- struct{}{}:
+		}
+
+		d, err := s.Queue.next(s.listenerCtx)
+		if err != nil {
+			<-s.maxConcurrentReceives
+
+			if errors.Is(err, context.Canceled) {
+				return msg.ErrServerClosed
+			}
+			return err
+		}
+
+		go func(ctx context.Context, d *delivery) {
+			defer func() {
+				<-s.maxConcurrentReceives
+			}()
+
+			d.info.Source = s.Name
+			err := r.Receive(msg.WithDeliveryInfo(ctx, d.info), d.message)
+			s.settle(d, err)
+		}(s.receiverCtx, d)
+	}
+}
+
+// settle acknowledges successful and permanently failed Messages,
+// and schedules the redelivery of other failed Messages.
+func (s *Server) settle(d *delivery, err error) {
+	if err == nil {
+		if err := s.Queue.ack(d.id); err != nil {
+			log.Printf("could not acknowledge message %s", err)
+		}
+		return
+	}
+	log.Printf("could not receive message %s", err)
+
+	if !msg.IsRetryable(err) {
+		log.Printf("dropping message %s", err)
+		if err := s.Queue.ack(d.id); err != nil {
+			log.Printf("could not acknowledge message %s", err)
+		}
+		return
+	}
+
+	delay, _ := msg.RetryDelay(err)
+	if err := s.Queue.nack(d.id, delay); err != nil {
+		log.Printf("could not requeue message %s", err)
+	}
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops polling for new Messages
+// and then it waits for all of the active goroutines to complete.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned. Messages which were not acknowledged remain in the Queue.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server.
+func NewServer(q *Queue, cc int) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	return &Server{
+		Queue:       q,
+		Concurrency: cc,
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+}
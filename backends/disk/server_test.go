@@ -0,0 +1,97 @@
+package disk_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/disk"
+)
+
+func publish(t *testing.T, topic msg.Topic, body string, delay time.Duration) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	w.SetDelay(delay)
+	if _, err := w.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestServer_HonorsDelay asserts that delayed Messages are not delivered
+// before their delay has elapsed.
+func TestServer_HonorsDelay(t *testing.T) {
+	q := open(t)
+	start := time.Now()
+	publish(t, disk.NewTopic(q), "hello world", 200*time.Millisecond)
+
+	received := make(chan time.Time, 1)
+	srv := disk.NewServer(q, 1)
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- time.Now()
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case at := <-received:
+		if elapsed := at.Sub(start); elapsed < 200*time.Millisecond {
+			t.Errorf("expected message to be delayed by 200ms, got %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message to be delivered")
+	}
+}
+
+// TestServer_AcknowledgesMessages asserts that successful and permanently
+// failed Messages are removed from the Queue, while other failures are
+// redelivered.
+func TestServer_AcknowledgesMessages(t *testing.T) {
+	q := open(t)
+	topic := disk.NewTopic(q)
+	publish(t, topic, "ok", 0)
+	publish(t, topic, "permanent", 0)
+	publish(t, topic, "retry", 0)
+
+	done := make(chan struct{})
+	srv := disk.NewServer(q, 1)
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			return err
+		}
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+
+		switch string(body) {
+		case "permanent":
+			return msg.Permanent(errors.New("bad message"))
+		case "retry":
+			if info.ReceiveCount < 3 {
+				return msg.RetryAfter(errors.New("try again"), 10*time.Millisecond)
+			}
+			close(done)
+		}
+		return nil
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message to be redelivered")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, msg.ErrServerClosed) {
+		t.Fatalf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+
+	if n := q.Len(); n != 0 {
+		t.Errorf("expected queue to be empty, got %d messages", n)
+	}
+}
@@ -0,0 +1,91 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Topic publishes Messages to a Queue.
+type Topic struct {
+	Queue *Queue
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// NewTopic returns a Topic which publishes Messages to q.
+func NewTopic(q *Queue) *Topic {
+	return &Topic{Queue: q}
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to write messages to a Queue.
+func (t *Topic) NewWriter(context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		queue: t.Queue,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to publish a single Message to a Queue.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	queue *Queue
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// The delay is persisted, so it is honored across restarts.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close appends the Message to the Queue. It returns once the Message
+// has been written to the log.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	return w.queue.publish(w.attributes, w.buf.Bytes(), w.delay)
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
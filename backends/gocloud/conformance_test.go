@@ -0,0 +1,103 @@
+package gocloud_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/gocloud"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"github.com/zerofox-oss/go-msg/msgtest"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/mempubsub"
+)
+
+// mempubsubTopic returns an in-memory topic with a subscription, which
+// are shut down when the test completes.
+func mempubsubTopic(t *testing.T) (*pubsub.Topic, *pubsub.Subscription) {
+	t.Helper()
+
+	topic := mempubsub.NewTopic()
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+	t.Cleanup(func() {
+		sub.Shutdown(context.Background())
+		topic.Shutdown(context.Background())
+	})
+	return topic, sub
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		topic, sub := mempubsubTopic(t)
+
+		return msgtest.TopicFixture{
+			Topic: gocloud.NewTopic(topic),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				m, err := sub.Receive(ctx)
+				if err != nil {
+					return nil, err
+				}
+				m.Ack()
+
+				message := &msg.Message{
+					Attributes: msg.Attributes{},
+					Body:       bytes.NewReader(m.Body),
+				}
+				for k, v := range m.Metadata {
+					message.Attributes.Set(k, v)
+				}
+				return message, nil
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		topic, sub := mempubsubTopic(t)
+
+		return msgtest.ServerFixture{
+			Server: gocloud.NewServer(sub, 10),
+			Topic:  gocloud.NewTopic(topic),
+		}
+	})
+}
+
+// Tests OpenTopic by publishing through it from a msg.Topic, so that
+// Messages go from msg to gocloud and back.
+func TestOpenTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		c := make(chan *msg.Message, 100)
+		topic := gocloud.OpenTopic(&mem.Topic{C: c})
+		t.Cleanup(func() { topic.Shutdown(context.Background()) })
+
+		return msgtest.TopicFixture{
+			Topic: gocloud.NewTopic(topic),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case m := <-c:
+					return m, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+// Tests OpenSubscription by serving from it, so that Messages go from
+// msg to gocloud and back.
+func TestOpenSubscription_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		c := make(chan *msg.Message, 100)
+		sub := gocloud.OpenSubscription(mem.NewServer(c, 10))
+		t.Cleanup(func() { sub.Shutdown(context.Background()) })
+
+		return msgtest.ServerFixture{
+			Server: gocloud.NewServer(sub, 10),
+			Topic:  &mem.Topic{C: c},
+		}
+	})
+}
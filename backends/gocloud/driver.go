@@ -0,0 +1,255 @@
+package gocloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/driver"
+)
+
+var (
+	// errNacked is returned to the msg.Server for Messages which were
+	// nacked, so that it delivers them again.
+	errNacked = errors.New("gocloud: message nacked")
+
+	// errSubscriptionClosed is returned to the msg.Server for Messages
+	// which were not acked before the subscription was shut down.
+	errSubscriptionClosed = errors.New("gocloud: subscription shut down")
+
+	// errServerStopped wraps the error of a msg.Server which stopped
+	// serving on its own, and is returned by the subscription from then on.
+	errServerStopped = errors.New("gocloud: server stopped serving")
+)
+
+// OpenTopic returns a *pubsub.Topic which publishes to t. Metadata is
+// mapped to attributes.
+func OpenTopic(t msg.Topic) *pubsub.Topic {
+	return pubsub.NewTopic(&topic{next: t}, nil)
+}
+
+// topic implements driver.Topic on top of a msg.Topic.
+type topic struct {
+	next msg.Topic
+}
+
+func (t *topic) SendBatch(ctx context.Context, ms []*driver.Message) error {
+	for _, m := range ms {
+		if err := t.send(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *topic) send(ctx context.Context, m *driver.Message) error {
+	w := t.next.NewWriter(ctx)
+	for k, v := range m.Metadata {
+		w.Attributes().Set(k, v)
+	}
+
+	if m.BeforeSend != nil {
+		if err := m.BeforeSend(as); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(m.Body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if m.AfterSend != nil {
+		return m.AfterSend(as)
+	}
+	return nil
+}
+
+func (*topic) IsRetryable(error) bool             { return false }
+func (*topic) As(interface{}) bool                { return false }
+func (*topic) ErrorAs(error, interface{}) bool    { return false }
+func (*topic) ErrorCode(error) gcerrors.ErrorCode { return gcerrors.Unknown }
+func (*topic) Close() error                       { return nil }
+
+// as exposes no driver-specific types.
+func as(interface{}) bool { return false }
+
+// OpenSubscription starts srv and returns a *pubsub.Subscription which
+// receives the Messages it delivers. Attributes are mapped to metadata,
+// and Messages with attributes which have several values are rejected
+// with a permanent error.
+//
+// A Message is held by srv until it is acked or nacked: Receive returns
+// nil once it is acked, and an error once it is nacked, so that srv
+// delivers it again. Shutting down the subscription shuts srv down, and
+// Messages which were not acked yet are handed back to srv. If srv stops
+// serving on its own, receiving from the subscription fails with its
+// error.
+func OpenSubscription(srv msg.Server) *pubsub.Subscription {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscription{
+		srv:        srv,
+		deliveries: make(chan *delivery),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	go func() {
+		if err := srv.Serve(msg.ReceiverFunc(s.receive)); !errors.Is(err, msg.ErrServerClosed) {
+			s.err = fmt.Errorf("%w: %w", errServerStopped, err)
+			cancel()
+		}
+	}()
+	return pubsub.NewSubscription(s, nil, nil)
+}
+
+// subscription implements driver.Subscription on top of a msg.Server.
+type subscription struct {
+	srv        msg.Server
+	deliveries chan *delivery
+
+	// ctx is done once the subscription is shut down, or the Server
+	// stopped serving, in which case err holds why. err is only read once
+	// ctx is done.
+	ctx    context.Context
+	cancel context.CancelFunc
+	err    error
+}
+
+// delivery is a Message delivered by the Server, waiting to be acked.
+type delivery struct {
+	m *driver.Message
+
+	// settled receives the outcome of the Message, once.
+	settled chan error
+}
+
+// receive hands m over to ReceiveBatch, and waits for it to be acked or
+// nacked.
+func (s *subscription) receive(ctx context.Context, m *msg.Message) error {
+	metadata, err := toMetadata(m.Attributes)
+	if err != nil {
+		return msg.Permanent(err)
+	}
+	body, err := io.ReadAll(m.Body)
+	if err != nil {
+		return err
+	}
+
+	d := &delivery{settled: make(chan error, 1)}
+	info, _ := msg.DeliveryInfoFromContext(ctx)
+	d.m = &driver.Message{
+		LoggableID: info.MessageID,
+		Body:       body,
+		Metadata:   metadata,
+		AckID:      d,
+		AsFunc:     as,
+	}
+
+	select {
+	case s.deliveries <- d:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.ctx.Done():
+		return errSubscriptionClosed
+	}
+
+	select {
+	case err := <-d.settled:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.ctx.Done():
+		return errSubscriptionClosed
+	}
+}
+
+// receiveWait is how long ReceiveBatch waits for a Message.
+const receiveWait = time.Second
+
+func (s *subscription) ReceiveBatch(ctx context.Context, maxMessages int) ([]*driver.Message, error) {
+	timer := time.NewTimer(receiveWait)
+	defer timer.Stop()
+
+	var ms []*driver.Message
+	select {
+	case d := <-s.deliveries:
+		ms = append(ms, d.m)
+	case <-timer.C:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, errSubscriptionClosed
+	}
+
+	for len(ms) < maxMessages {
+		select {
+		case d := <-s.deliveries:
+			ms = append(ms, d.m)
+		default:
+			return ms, nil
+		}
+	}
+	return ms, nil
+}
+
+func (s *subscription) SendAcks(ctx context.Context, ids []driver.AckID) error {
+	s.settle(ids, nil)
+	return nil
+}
+
+func (s *subscription) SendNacks(ctx context.Context, ids []driver.AckID) error {
+	s.settle(ids, errNacked)
+	return nil
+}
+
+// settle passes err to the deliveries ids. Deliveries which were already
+// settled are left as they are.
+func (s *subscription) settle(ids []driver.AckID, err error) {
+	for _, id := range ids {
+		select {
+		case id.(*delivery).settled <- err:
+		default:
+		}
+	}
+}
+
+func (*subscription) CanNack() bool                   { return true }
+func (*subscription) As(interface{}) bool             { return false }
+func (*subscription) ErrorAs(error, interface{}) bool { return false }
+
+// IsRetryable reports false for every error: a Server which stopped
+// serving does not start again, so Receive returns its error rather than
+// retrying forever.
+func (*subscription) IsRetryable(error) bool { return false }
+
+func (*subscription) ErrorCode(err error) gcerrors.ErrorCode {
+	switch {
+	case errors.Is(err, errServerStopped):
+		return gcerrors.Internal
+	case errors.Is(err, errSubscriptionClosed):
+		return gcerrors.FailedPrecondition
+	}
+	return gcerrors.Unknown
+}
+
+// Close hands the Messages which were not acked back to the Server, and
+// shuts it down.
+func (s *subscription) Close() error {
+	s.cancel()
+
+	err := s.srv.Shutdown(context.Background())
+	if errors.Is(err, msg.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package gocloud_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/gocloud"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/pubsub"
+)
+
+func publish(t *testing.T, topic msg.Topic, body string, kv ...string) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	for i := 0; i+1 < len(kv); i += 2 {
+		w.Attributes().Set(kv[i], kv[i+1])
+	}
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts srv in the background and shuts it down when the test
+// completes.
+func serve(t *testing.T, srv *gocloud.Server, r msg.ReceiverFunc) {
+	go srv.Serve(r)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+}
+
+func TestTopic_MapsAttributesToMetadata(t *testing.T) {
+	topic, sub := mempubsubTopic(t)
+	publish(t, gocloud.NewTopic(topic), "hello world", "X-Request-Id", "1234")
+
+	m, err := sub.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Ack()
+	if got := m.Metadata["X-Request-Id"]; got != "1234" {
+		t.Errorf("expected metadata X-Request-Id to be 1234, got %q", got)
+	}
+}
+
+func TestTopic_RejectsMultiValuedAttributes(t *testing.T) {
+	topic, _ := mempubsubTopic(t)
+
+	w := gocloud.NewTopic(topic).NewWriter(context.Background())
+	(*w.Attributes())["Accept"] = []string{"text/plain", "application/json"}
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err == nil {
+		t.Error("expected Close to fail")
+	}
+}
+
+// Tests that the Server acks Messages which succeed or fail permanently,
+// and nacks those which fail otherwise.
+func TestServer_FollowsReceiveResults(t *testing.T) {
+	topic, sub := mempubsubTopic(t)
+	publish(t, gocloud.NewTopic(topic), "retry")
+	publish(t, gocloud.NewTopic(topic), "permanent")
+
+	received := make(chan string, 10)
+	retried := false
+	serve(t, gocloud.NewServer(sub, 1), func(ctx context.Context, m *msg.Message) error {
+		b, _ := msg.DumpBody(m)
+		received <- string(b)
+
+		switch string(b) {
+		case "permanent":
+			return msg.Permanent(errors.New("malformed"))
+		case "retry":
+			if !retried {
+				retried = true
+				return errors.New("try again")
+			}
+		}
+		return nil
+	})
+
+	counts := make(map[string]int)
+	timeout := time.After(500 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case b := <-received:
+			counts[b]++
+		case <-timeout:
+			done = true
+		}
+	}
+	if counts["retry"] < 2 {
+		t.Errorf("expected the nacked message to be delivered again, got %d deliveries", counts["retry"])
+	}
+	if counts["permanent"] != 1 {
+		t.Errorf("expected the permanently failed message to be delivered once, got %d", counts["permanent"])
+	}
+}
+
+// Tests that a nack from the pubsub side fails the delivery of the
+// msg.Server, so that it delivers the Message again.
+func TestOpenSubscription_NackRedelivers(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	sub := gocloud.OpenSubscription(mem.NewServer(c, 1))
+	t.Cleanup(func() { sub.Shutdown(context.Background()) })
+	publish(t, &mem.Topic{C: c}, "hello world", "X-Request-Id", "1234")
+
+	m := receive(t, sub)
+	if got := m.Metadata["X-Request-Id"]; got != "1234" {
+		t.Errorf("expected metadata X-Request-Id to be 1234, got %q", got)
+	}
+	m.Nack()
+
+	m = receive(t, sub)
+	if got := string(m.Body); got != "hello world" {
+		t.Errorf("expected the message to be delivered again, got %q", got)
+	}
+	m.Ack()
+}
+
+// Tests that Messages which cannot be mapped to pubsub are rejected
+// permanently.
+func TestOpenSubscription_RejectsMultiValuedAttributes(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	dlq := make(chan *msg.Message, 1)
+	sub := gocloud.OpenSubscription(mem.NewServer(c, 1, mem.WithDeadLetter(dlq)))
+	t.Cleanup(func() { sub.Shutdown(context.Background()) })
+
+	w := (&mem.Topic{C: c}).NewWriter(context.Background())
+	(*w.Attributes())["Accept"] = []string{"text/plain", "application/json"}
+	w.Write([]byte("hello world"))
+	w.Close()
+
+	select {
+	case <-dlq:
+	case <-time.After(time.Second):
+		t.Fatal("expected the message to be dead-lettered")
+	}
+}
+
+// failingServer is a msg.Server which stops serving as soon as it starts.
+type failingServer struct{}
+
+func (failingServer) Serve(msg.Receiver) error           { return errors.New("connection refused") }
+func (failingServer) Shutdown(ctx context.Context) error { return msg.ErrServerClosed }
+
+// Tests that receiving from a subscription whose Server stopped serving
+// fails with its error, rather than blocking.
+func TestOpenSubscription_ReportsServeErrors(t *testing.T) {
+	sub := gocloud.OpenSubscription(failingServer{})
+	t.Cleanup(func() { sub.Shutdown(context.Background()) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := sub.Receive(ctx)
+	if err == nil || ctx.Err() != nil {
+		t.Fatalf("expected the error of the Server, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("expected the error of the Server, got %v", err)
+	}
+	if code := gcerrors.Code(err); code != gcerrors.Internal {
+		t.Errorf("expected error code %v, got %v", gcerrors.Internal, code)
+	}
+}
+
+func receive(t *testing.T, sub *pubsub.Subscription) *pubsub.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
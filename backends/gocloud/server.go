@@ -0,0 +1,168 @@
+package gocloud
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"gocloud.dev/pubsub"
+)
+
+// Server receives Messages from a gocloud pubsub subscription.
+//
+// Messages are acked once Receive returns nil or a permanent error.
+// Other failed Messages are nacked, after the delay requested with
+// msg.RetryAfter if there is one, so that they are delivered again.
+// Drivers which cannot nack deliver them again once their ack deadline
+// has passed.
+type Server struct {
+	Subscription *pubsub.Subscription
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed. gocloud retries
+// transient failures itself, so other errors mean that the subscription
+// can no longer be used.
+func (s *Server) Serve(r msg.Receiver) error {
+	for {
+		// acquire "lock"
+		select {
+		case <-s.listenerCtx.Done():
+			return msg.ErrServerClosed
+		case s.maxConcurrentReceives <- struct{}{}:
+		}
+
+		m, err := s.Subscription.Receive(s.listenerCtx)
+		if err != nil {
+			<-s.maxConcurrentReceives
+			if s.listenerCtx.Err() != nil {
+				return msg.ErrServerClosed
+			}
+			return err
+		}
+
+		go func(ctx context.Context, m *pubsub.Message) {
+			defer func() {
+				<-s.maxConcurrentReceives
+			}()
+
+			s.deliver(ctx, r, m)
+		}(s.receiverCtx, m)
+	}
+}
+
+// deliver delivers m to r and settles its outcome.
+func (s *Server) deliver(ctx context.Context, r msg.Receiver, m *pubsub.Message) {
+	info := msg.DeliveryInfo{
+		MessageID: m.LoggableID,
+		Source:    s.Name,
+	}
+
+	err := r.Receive(msg.WithDeliveryInfo(ctx, info), &msg.Message{
+		Attributes: toAttributes(m.Metadata),
+		Body:       bytes.NewReader(m.Body),
+	})
+	if err == nil {
+		m.Ack()
+		return
+	}
+	log.Printf("could not receive message %s", err)
+
+	if !msg.IsRetryable(err) {
+		log.Printf("dropping message %s", err)
+		m.Ack()
+		return
+	}
+
+	if !m.Nackable() {
+		return
+	}
+	if delay, ok := msg.RetryDelay(err); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-s.listenerCtx.Done():
+		}
+	}
+	m.Nack()
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops receiving new Messages
+// and then it waits for all of the active goroutines to complete.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned.
+//
+// Shutdown does not shut down the Subscription.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which receives Messages
+// from sub.
+func NewServer(sub *pubsub.Subscription, cc int) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	return &Server{
+		Subscription: sub,
+		Concurrency:  cc,
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+}
@@ -0,0 +1,155 @@
+// Package gocloud adapts gocloud.dev/pubsub to msg, in both directions.
+//
+// Topic and Server wrap a *pubsub.Topic and a *pubsub.Subscription, so
+// that Messages can be published and received through any gocloud
+// driver. OpenTopic and OpenSubscription do the reverse: they expose a
+// msg.Topic and a msg.Server as a *pubsub.Topic and a *pubsub.Subscription.
+//
+// Attributes map to metadata. Metadata holds a single value per key, so
+// attributes with several values cannot be mapped, and Messages which
+// carry them are rejected.
+package gocloud
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"gocloud.dev/pubsub"
+)
+
+// Topic publishes Messages to a gocloud pubsub topic.
+type Topic struct {
+	Topic *pubsub.Topic
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// NewTopic returns a Topic which sends Messages to t.
+func NewTopic(t *pubsub.Topic) *Topic {
+	return &Topic{Topic: t}
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to send a single Message.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to send a single Message to a gocloud topic.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// gocloud has no notion of delayed delivery, so Close waits for the delay
+// before it sends the Message.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close sends the Message to the topic.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	metadata, err := toMetadata(w.attributes)
+	if err != nil {
+		return err
+	}
+
+	if w.delay > 0 {
+		timer := time.NewTimer(w.delay)
+		defer timer.Stop()
+
+		select {
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return w.topic.Topic.Send(w.ctx, &pubsub.Message{
+		Body:     w.buf.Bytes(),
+		Metadata: metadata,
+	})
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
+
+// toMetadata converts attributes to metadata. It fails if an attribute
+// has several values.
+func toMetadata(attributes msg.Attributes) (map[string]string, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string, len(attributes))
+	for k, vv := range attributes {
+		switch len(vv) {
+		case 0:
+		case 1:
+			metadata[k] = vv[0]
+		default:
+			return nil, fmt.Errorf("gocloud: attribute %s has %d values, metadata holds one", k, len(vv))
+		}
+	}
+	return metadata, nil
+}
+
+// toAttributes converts metadata to attributes with canonical keys.
+func toAttributes(metadata map[string]string) msg.Attributes {
+	attributes := make(msg.Attributes, len(metadata))
+	for k, v := range metadata {
+		attributes[textproto.CanonicalMIMEHeaderKey(k)] = []string{v}
+	}
+	return attributes
+}
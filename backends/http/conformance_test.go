@@ -0,0 +1,75 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+	msghttp "github.com/zerofox-oss/go-msg/backends/http"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// serve starts srv behind an httptest.Server which is closed when the
+// test completes.
+func serve(t *testing.T, srv *msghttp.Server) *httptest.Server {
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		c := make(chan *msg.Message, 100)
+
+		srv := msghttp.NewServer(10)
+		go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			c <- msg.WithBody(m, bytes.NewReader(body))
+			return nil
+		}))
+		t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+		return msgtest.TopicFixture{
+			Topic: msghttp.NewTopic(serve(t, srv).URL),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case m := <-c:
+					return m, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+// asyncWriter sends its request in the background, since the suite
+// publishes Messages before it starts the Server, and requests wait
+// for Serve to be called.
+type asyncWriter struct {
+	msg.MessageWriter
+}
+
+func (w asyncWriter) Close() error {
+	go w.MessageWriter.Close()
+	return nil
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		srv := msghttp.NewServer(10)
+		topic := msghttp.NewTopic(serve(t, srv).URL)
+
+		return msgtest.ServerFixture{
+			Server: srv,
+			Topic: msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+				return asyncWriter{topic.NewWriter(ctx)}
+			}),
+		}
+	})
+}
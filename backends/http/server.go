@@ -0,0 +1,290 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server is an http.Handler which turns POST requests into Messages and
+// delivers them to the Receiver passed to Serve. Request headers become
+// the attributes of the Message, and the request body its Body.
+//
+// The outcome of Receive is mapped to the response status:
+//
+//   - nil: 204 No Content
+//   - an error wrapped with msg.RetryAfter: 429 Too Many Requests, with
+//     a Retry-After header
+//   - a permanent error: 422 Unprocessable Entity
+//   - any other error: 503 Service Unavailable
+//
+// The MessageID of the msg.DeliveryInfo is taken from the X-Request-Id
+// header, if present.
+//
+// Requests which arrive before Serve is called wait for it. Once the
+// Server is shut down, requests are answered with 503 Service Unavailable.
+type Server struct {
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server. Further requests wait for a slot.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	maxBodySize int64
+
+	receiver  msg.Receiver
+	serving   chan struct{}
+	serveOnce sync.Once
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server and http.Handler
+var (
+	_ msg.Server   = &Server{}
+	_ http.Handler = &Server{}
+)
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithMaxBodySize limits the size of request bodies. Larger requests are
+// answered with 413 Request Entity Too Large. The default is 1 MiB.
+func WithMaxBodySize(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// ErrServing is returned by Serve if the Server is already serving.
+var ErrServing = errors.New("http: Server is already serving")
+
+// hopHeaders are request headers which describe the connection rather
+// than the Message, and are not copied to its attributes. Headers named
+// by the Connection header are dropped as well.
+var hopHeaders = []string{
+	"Accept-Encoding",
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"User-Agent",
+}
+
+// credentialHeaders are request headers which authenticate the sender to
+// the Server. They are not copied to the attributes of the Message, so
+// that they are not handed on to wherever the Message goes next.
+var credentialHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+// Serve delivers requests to r until Shutdown is called.
+// It always returns ErrServerClosed, or ErrServing if it was already
+// called.
+func (s *Server) Serve(r msg.Receiver) error {
+	serving := false
+	s.serveOnce.Do(func() {
+		serving = true
+		s.receiver = r
+		close(s.serving)
+	})
+	if !serving {
+		return ErrServing
+	}
+
+	<-s.listenerCtx.Done()
+	return msg.ErrServerClosed
+}
+
+// ServeHTTP delivers the request to the Receiver as a Message.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// wait for Serve, then acquire "lock"
+	select {
+	case <-s.serving:
+	case <-s.listenerCtx.Done():
+	case <-req.Context().Done():
+		return
+	}
+	if s.listenerCtx.Err() != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case <-s.listenerCtx.Done():
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	case <-req.Context().Done():
+		return
+	case s.maxConcurrentReceives <- struct{}{}:
+	}
+	defer func() {
+		<-s.maxConcurrentReceives
+	}()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, s.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	m := &msg.Message{
+		Attributes: attributes(req.Header),
+		Body:       bytes.NewReader(body),
+	}
+
+	// cancel the Receiver if the client goes away, or if Shutdown expires
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	stop := context.AfterFunc(s.receiverCtx, cancel)
+	defer stop()
+
+	ctx = msg.WithDeliveryInfo(ctx, msg.DeliveryInfo{
+		MessageID:     req.Header.Get("X-Request-Id"),
+		ReceiveCount:  1,
+		FirstReceived: time.Now(),
+		Source:        s.Name,
+	})
+
+	err = s.receiver.Receive(ctx, m)
+	if err != nil {
+		log.Printf("could not receive message %s", err)
+	}
+	writeStatus(w, err)
+}
+
+// attributes returns the attributes of a Message for the request
+// headers h, leaving out hop-by-hop and credential headers.
+func attributes(h http.Header) msg.Attributes {
+	attrs := msg.Attributes(h.Clone())
+	for _, v := range h.Values("Connection") {
+		for _, k := range strings.Split(v, ",") {
+			delete(attrs, http.CanonicalHeaderKey(strings.TrimSpace(k)))
+		}
+	}
+	for _, k := range hopHeaders {
+		delete(attrs, k)
+	}
+	for _, k := range credentialHeaders {
+		delete(attrs, k)
+	}
+	return attrs
+}
+
+// writeStatus writes the response for the outcome of Receive.
+func writeStatus(w http.ResponseWriter, err error) {
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !msg.IsRetryable(err) {
+		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+		return
+	}
+	if delay, ok := msg.RetryDelay(err); ok {
+		seconds := int(math.Ceil(delay.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server rejects new requests
+// and then it waits for all of the active requests to complete.
+//
+// If the provided context expires before the shutdown is complete,
+// then the Contexts of any remaining requests are cancelled and the
+// context's error is returned.
+//
+// Shutdown does not stop the http.Server which the Server is mounted on.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server.
+func NewServer(cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		Concurrency: cc,
+		maxBodySize: 1 << 20,
+
+		serving:               make(chan struct{}),
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
@@ -0,0 +1,171 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msghttp "github.com/zerofox-oss/go-msg/backends/http"
+)
+
+// TestServer_StatusCodes asserts that the outcome of Receive is mapped
+// to the response status.
+func TestServer_StatusCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		retryAfter string
+	}{
+		{"Success", nil, http.StatusNoContent, ""},
+		{"Permanent", msg.Permanent(errors.New("bad")), http.StatusUnprocessableEntity, ""},
+		{"RetryAfter", msg.RetryAfter(errors.New("slow down"), 1500*time.Millisecond), http.StatusTooManyRequests, "2"},
+		{"Retryable", errors.New("unavailable"), http.StatusServiceUnavailable, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := msghttp.NewServer(1)
+			go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				return tc.err
+			}))
+			defer srv.Shutdown(context.Background())
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+
+			if rec.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tc.retryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tc.retryAfter, got)
+			}
+		})
+	}
+}
+
+func TestServer_RequestToMessage(t *testing.T) {
+	srv := msghttp.NewServer(1)
+	srv.Name = "webhooks"
+
+	received := make(chan *msg.Message, 1)
+	var info msg.DeliveryInfo
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		info, _ = msg.DeliveryInfoFromContext(ctx)
+		received <- m
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello world"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Request-Id", "1234")
+	req.Header.Set("User-Agent", "test")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	m := <-received
+	body, err := msg.DumpBody(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello world" {
+		t.Errorf("expected body %q, got %q", "hello world", body)
+	}
+	if got := m.Attributes.Get("Content-Type"); got != "text/plain" {
+		t.Errorf("expected Content-Type text/plain, got %q", got)
+	}
+	for _, k := range []string{"User-Agent", "Authorization", "Cookie", "Connection", "X-Hop"} {
+		if _, ok := m.Attributes[k]; ok {
+			t.Errorf("expected %s not to be an attribute", k)
+		}
+	}
+	if info.MessageID != "1234" || info.Source != "webhooks" {
+		t.Errorf("unexpected delivery info %+v", info)
+	}
+}
+
+func TestServer_ServeTwice(t *testing.T) {
+	srv := msghttp.NewServer(1)
+	r := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		return nil
+	})
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(r) }()
+
+	// requests wait for Serve, so the Server is serving once this returns
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+
+	if err := srv.Serve(r); !errors.Is(err, msghttp.ErrServing) {
+		t.Errorf("expected %v, got %v", msghttp.ErrServing, err)
+	}
+
+	srv.Shutdown(context.Background())
+	if err := <-served; !errors.Is(err, msg.ErrServerClosed) {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
+
+func TestServer_RejectsRequests(t *testing.T) {
+	srv := msghttp.NewServer(1, msghttp.WithMaxBodySize(4))
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		return nil
+	}))
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for GET, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello world")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d for large body, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	srv.Shutdown(context.Background())
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hi")))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d after Shutdown, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+// TestServer_TopicRetries asserts that a Topic retries Messages which the
+// Server asks to be retried.
+func TestServer_TopicRetries(t *testing.T) {
+	srv := msghttp.NewServer(1)
+	calls := 0
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		calls++
+		if calls == 1 {
+			return errors.New("try again")
+		}
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	topic := msghttp.NewTopic(ts.URL, msghttp.WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 deliveries, got %d", calls)
+	}
+}
@@ -0,0 +1,268 @@
+// Package http provides a backend which delivers Messages as HTTP requests,
+// for integrating with push-based webhooks.
+//
+// A Topic POSTs each Message to a URL, and a Server is an http.Handler which
+// turns requests into Messages. Attributes are sent as request headers.
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// StatusError is returned by MessageWriter.Close when the Message was
+// rejected with a non-2xx status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http: unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Topic publishes Messages by POSTing them to a URL.
+//
+// Requests which fail with a network error, 429 Too Many Requests or a 5xx
+// status code are retried with exponential backoff. A Retry-After header
+// in the response takes precedence over the backoff, up to the maximum
+// backoff, so that a server cannot stall the publisher indefinitely.
+type Topic struct {
+	URL string
+
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	maxRetries  int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// TopicOption is a functional option for the Topic.
+type TopicOption func(*Topic)
+
+// WithClient sets the http.Client used to send requests.
+func WithClient(c *http.Client) TopicOption {
+	return func(t *Topic) {
+		t.Client = c
+	}
+}
+
+// WithMaxRetries sets how many times a failed request is retried.
+// The default is 3.
+func WithMaxRetries(n int) TopicOption {
+	return func(t *Topic) {
+		t.maxRetries = n
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry, which doubles
+// with every retry up to max. The default is 100ms, up to 5s.
+func WithRetryBackoff(base, max time.Duration) TopicOption {
+	return func(t *Topic) {
+		t.backoffBase = base
+		t.backoffMax = max
+	}
+}
+
+// NewTopic returns a Topic which POSTs Messages to url.
+func NewTopic(url string, opts ...TopicOption) *Topic {
+	t := &Topic{
+		URL:         url,
+		maxRetries:  3,
+		backoffBase: 100 * time.Millisecond,
+		backoffMax:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to POST a single Message. Its request is
+// made with ctx.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to publish a single Message over HTTP.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// HTTP has no notion of delayed delivery, so Close waits for the delay
+// before it sends the request. This blocks the publisher for the whole
+// delay, unless the MessageWriter's context is done first, so long delays
+// are better left to a backend which supports delayed delivery.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close POSTs the Message, retrying if the request fails temporarily.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	if w.closed {
+		w.mux.Unlock()
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+	delay := w.delay
+	w.mux.Unlock()
+
+	// the MessageWriter is closed, so the buffer can no longer change
+	// and the lock need not be held while waiting
+	if err := sleep(w.ctx, delay); err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		delay, err := w.post()
+		if err == nil || delay < 0 || attempt >= w.topic.maxRetries {
+			return err
+		}
+		if delay == 0 {
+			delay = w.topic.backoff(attempt)
+		}
+		if w.topic.backoffMax > 0 && delay > w.topic.backoffMax {
+			delay = w.topic.backoffMax
+		}
+		if err := sleep(w.ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// post sends the Message once. If the request may be retried, it returns
+// the delay requested by the server, if any; otherwise it returns a
+// negative delay.
+func (w *MessageWriter) post() (time.Duration, error) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.topic.URL, bytes.NewReader(w.buf.Bytes()))
+	if err != nil {
+		return -1, err
+	}
+	for k, v := range w.attributes {
+		req.Header[k] = v
+	}
+
+	resp, err := w.topic.client().Do(req)
+	if err != nil {
+		if w.ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return retryAfter(resp.Header), &StatusError{StatusCode: resp.StatusCode}
+	default:
+		return -1, &StatusError{StatusCode: resp.StatusCode}
+	}
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
+
+func (t *Topic) client() *http.Client {
+	if t.Client == nil {
+		return http.DefaultClient
+	}
+	return t.Client
+}
+
+// backoff returns how long to wait before retry n, counting from zero.
+func (t *Topic) backoff(n int) time.Duration {
+	delay := t.backoffBase
+	for i := 0; i < n; i++ {
+		delay *= 2
+		if t.backoffMax > 0 && delay >= t.backoffMax {
+			return t.backoffMax
+		}
+	}
+	return delay
+}
+
+// retryAfter parses the Retry-After header, which holds either a number
+// of seconds or an HTTP date. It returns zero if the header is absent
+// or invalid.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(v); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,181 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msghttp "github.com/zerofox-oss/go-msg/backends/http"
+)
+
+func TestTopic_SendsAttributesAsHeaders(t *testing.T) {
+	var header http.Header
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected method POST, got %s", r.Method)
+		}
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	w := msghttp.NewTopic(ts.URL).NewWriter(context.Background())
+	w.Attributes().Set("Content-Type", "application/json")
+	w.Attributes().Set("X-Event", "created")
+	w.Write([]byte(`{"id":1}`))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %q", got)
+	}
+	if got := header.Get("X-Event"); got != "created" {
+		t.Errorf("expected X-Event created, got %q", got)
+	}
+	if string(body) != `{"id":1}` {
+		t.Errorf("expected body %q, got %q", `{"id":1}`, body)
+	}
+}
+
+// TestTopic_CloseDoesNotLockDuringDelay asserts that the MessageWriter
+// can still be used while Close waits for the delay.
+func TestTopic_CloseDoesNotLockDuringDelay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := msghttp.NewTopic(ts.URL).NewWriter(ctx)
+	w.SetDelay(time.Minute)
+	closed := make(chan error, 1)
+	go func() { closed <- w.Close() }()
+
+	done := make(chan error, 1)
+	go func() {
+		// wait for the first Close to mark the MessageWriter closed
+		for {
+			if _, err := w.Write([]byte("hello")); err != nil {
+				done <- err
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, msg.ErrClosedMessageWriter) {
+			t.Errorf("expected %v, got %v", msg.ErrClosedMessageWriter, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Write not to block while Close waits")
+	}
+
+	cancel()
+	if err := <-closed; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestTopic_RetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	topic := msghttp.NewTopic(ts.URL, msghttp.WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestTopic_CapsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	topic := msghttp.NewTopic(ts.URL, msghttp.WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	w := topic.NewWriter(ctx)
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestTopic_GivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	topic := msghttp.NewTopic(ts.URL,
+		msghttp.WithMaxRetries(2),
+		msghttp.WithRetryBackoff(time.Millisecond, 10*time.Millisecond),
+	)
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello world"))
+
+	var statusErr *msghttp.StatusError
+	if err := w.Close(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected a StatusError with status 503, got %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestTopic_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	w := msghttp.NewTopic(ts.URL).NewWriter(context.Background())
+	w.Write([]byte("hello world"))
+
+	var statusErr *msghttp.StatusError
+	if err := w.Close(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a StatusError with status 400, got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
@@ -0,0 +1,68 @@
+package jsonl_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/jsonl"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// pipe returns a Topic which appends to a file that is followed by a
+// Server. The file is closed when the test completes.
+func pipe(t *testing.T) (*jsonl.Topic, *jsonl.Server) {
+	name := filepath.Join(t.TempDir(), "messages.jsonl")
+	w, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		w.Close()
+		r.Close()
+	})
+
+	return jsonl.NewTopic(w), jsonl.NewServer(r, 10, jsonl.WithFollow(10*time.Millisecond))
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		topic, srv := pipe(t)
+
+		c := make(chan *msg.Message, 100)
+		go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			c <- m
+			return nil
+		}))
+		t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+		return msgtest.TopicFixture{
+			Topic: topic,
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case m := <-c:
+					return m, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		topic, srv := pipe(t)
+		return msgtest.ServerFixture{
+			Server: srv,
+			Topic:  topic,
+		}
+	})
+}
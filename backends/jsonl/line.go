@@ -0,0 +1,98 @@
+// Package jsonl provides a backend which stores Messages as JSON lines.
+//
+// Each Message is a single line holding a JSON object:
+//
+//	{"attributes":{"Content-Type":["text/plain"]},"body":"hello world"}
+//
+// Bodies which are not valid UTF-8 are stored base64-encoded in the
+// "bodyBase64" field instead of "body". A Message published with a delay
+// records it in the "delay" field, e.g. "1m30s".
+//
+// The format makes captured traffic easy to keep as test fixtures, and
+// lets small tools pipe Messages to each other.
+package jsonl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/textproto"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// line is the JSON representation of a Message.
+type line struct {
+	Attributes msg.Attributes `json:"attributes"`
+	Body       *string        `json:"body,omitempty"`
+	BodyBase64 *string        `json:"bodyBase64,omitempty"`
+	Delay      string         `json:"delay,omitempty"`
+}
+
+// encodeLine returns the JSON line of a Message, including the
+// trailing newline.
+func encodeLine(attrs msg.Attributes, body []byte, delay time.Duration) ([]byte, error) {
+	l := line{Attributes: attrs}
+	if l.Attributes == nil {
+		l.Attributes = msg.Attributes{}
+	}
+	if utf8.Valid(body) {
+		s := string(body)
+		l.Body = &s
+	} else {
+		s := base64.StdEncoding.EncodeToString(body)
+		l.BodyBase64 = &s
+	}
+	if delay > 0 {
+		l.Delay = delay.String()
+	}
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// errNoBody is returned for lines which have neither a body nor a
+// base64-encoded body.
+var errNoBody = errors.New("jsonl: line has no body")
+
+// decodeLine decodes a JSON line into its attributes, body and delay.
+func decodeLine(b []byte) (msg.Attributes, []byte, time.Duration, error) {
+	var l line
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, nil, 0, err
+	}
+
+	var body []byte
+	switch {
+	case l.BodyBase64 != nil:
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(*l.BodyBase64); err != nil {
+			return nil, nil, 0, err
+		}
+	case l.Body != nil:
+		body = []byte(*l.Body)
+	default:
+		return nil, nil, 0, errNoBody
+	}
+
+	var delay time.Duration
+	if l.Delay != "" {
+		var err error
+		if delay, err = time.ParseDuration(l.Delay); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	// canonicalize keys of hand-written lines
+	attrs := make(msg.Attributes, len(l.Attributes))
+	for k, vv := range l.Attributes {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		attrs[k] = append(attrs[k], vv...)
+	}
+	return attrs, body, delay, nil
+}
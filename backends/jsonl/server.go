@@ -0,0 +1,282 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server replays Messages stored as JSON lines into a Receiver.
+//
+// Messages are delivered in the order of the input. A Message which fails
+// is redelivered until it succeeds, fails permanently, exceeds the max
+// receive count or the Server is shut down; it holds its concurrency slot
+// in the meantime. Delays recorded in the input are ignored.
+//
+// When the input is exhausted, Serve waits for the Messages in flight and
+// returns io.EOF, unless the Server follows the input (see WithFollow).
+// The Server never closes R; a read which is blocked when the Server is
+// shut down returns once R is closed by the caller.
+type Server struct {
+	R io.Reader
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	follow          time.Duration
+	maxReceiveCount int
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithFollow makes the Server follow the input like `tail -f`: when the
+// input is exhausted, it polls for new lines every interval until Shutdown.
+func WithFollow(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.follow = interval
+	}
+}
+
+// WithMaxReceiveCount sets the number of times a Message may be delivered
+// before it is dropped. A zero count, the default, means Messages are
+// redelivered until they succeed.
+func WithMaxReceiveCount(n int) ServerOption {
+	return func(s *Server) {
+		s.maxReceiveCount = n
+	}
+}
+
+// item is a decoded line, or the error which ended the input.
+type item struct {
+	attributes msg.Attributes
+	body       []byte
+	number     int
+	err        error
+}
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed. If the input is
+// exhausted, the returned error is io.EOF; an invalid line or an error
+// reading the input is returned as is.
+func (s *Server) Serve(r msg.Receiver) error {
+	items := make(chan item)
+	go s.read(items)
+
+	for {
+		select {
+		case <-s.listenerCtx.Done():
+			return msg.ErrServerClosed
+
+		case it := <-items:
+			if it.err != nil {
+				s.wait()
+				return it.err
+			}
+
+			// acquire "lock"
+			s.maxConcurrentReceives <- struct{}{}
+
+			go func(ctx context.Context, it item) {
+				defer func() {
+					<-s.maxConcurrentReceives
+				}()
+
+				s.deliver(ctx, r, it)
+			}(s.receiverCtx, it)
+		}
+	}
+}
+
+// deliver delivers the Message of it to r until it succeeds or must
+// not be retried.
+func (s *Server) deliver(ctx context.Context, r msg.Receiver, it item) {
+	info := msg.DeliveryInfo{
+		MessageID:     strconv.Itoa(it.number),
+		FirstReceived: time.Now(),
+		Source:        s.Name,
+	}
+
+	for {
+		info.ReceiveCount++
+
+		// every attempt gets its own copy of the attributes, so that
+		// changes made by r do not leak into the next one
+		m := msg.WithBody(&msg.Message{Attributes: it.attributes}, bytes.NewReader(it.body))
+
+		err := r.Receive(msg.WithDeliveryInfo(ctx, info), m)
+		if err == nil {
+			return
+		}
+		log.Printf("could not receive message %s", err)
+
+		if !msg.IsRetryable(err) || (s.maxReceiveCount > 0 && info.ReceiveCount >= s.maxReceiveCount) {
+			log.Printf("dropping message %s", err)
+			return
+		}
+
+		delay, _ := msg.RetryDelay(err)
+		select {
+		case <-time.After(delay):
+		case <-s.listenerCtx.Done():
+			log.Printf("dropping message %s", err)
+			return
+		}
+	}
+}
+
+// read decodes lines from the input and sends them to items, until the
+// input ends or the Server is shut down.
+func (s *Server) read(items chan<- item) {
+	send := func(it item) bool {
+		select {
+		case items <- it:
+			return true
+		case <-s.listenerCtx.Done():
+			return false
+		}
+	}
+
+	br := bufio.NewReader(s.R)
+	number := 0
+	var buf []byte
+	for {
+		b, err := br.ReadBytes('\n')
+		buf = append(buf, b...)
+
+		if err == io.EOF && s.follow > 0 {
+			// keep a partial line until the rest of it is written
+			select {
+			case <-time.After(s.follow):
+				continue
+			case <-s.listenerCtx.Done():
+				return
+			}
+		}
+		if err != nil && err != io.EOF {
+			send(item{err: err})
+			return
+		}
+
+		if len(bytes.TrimSpace(buf)) > 0 {
+			number++
+			attrs, body, _, derr := decodeLine(buf)
+			if derr != nil {
+				send(item{err: fmt.Errorf("jsonl: invalid line %d: %w", number, derr)})
+				return
+			}
+			if !send(item{attributes: attrs, body: body, number: number}) {
+				return
+			}
+		}
+		buf = nil
+
+		if err == io.EOF {
+			send(item{err: io.EOF})
+			return
+		}
+	}
+}
+
+// wait blocks until every Message in flight has been processed,
+// or the Server is shut down.
+func (s *Server) wait() {
+	acquired := 0
+	defer func() {
+		for ; acquired > 0; acquired-- {
+			<-s.maxConcurrentReceives
+		}
+	}()
+
+	for acquired < cap(s.maxConcurrentReceives) {
+		select {
+		case s.maxConcurrentReceives <- struct{}{}:
+			acquired++
+		case <-s.receiverCtx.Done():
+			return
+		}
+	}
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops reading new Messages
+// and then it waits for all of the active goroutines to complete.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which reads JSON lines
+// from r.
+func NewServer(r io.Reader, cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		R:           r,
+		Concurrency: cc,
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
@@ -0,0 +1,177 @@
+package jsonl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/jsonl"
+)
+
+const fixture = `{"attributes":{"Content-Type":["text/plain"]},"body":"hello world"}
+
+{"attributes":{},"bodyBase64":"/wAB"}
+{"attributes":{},"body":"fails"}
+{"attributes":{},"body":"goodbye"}
+`
+
+// TestServer_Replay asserts that every line is delivered in order and
+// that Serve returns io.EOF once the input is exhausted.
+func TestServer_Replay(t *testing.T) {
+	var mux sync.Mutex
+	var bodies []string
+	var ids []string
+
+	srv := jsonl.NewServer(strings.NewReader(fixture), 1)
+	err := srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			return err
+		}
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+
+		mux.Lock()
+		defer mux.Unlock()
+		bodies = append(bodies, string(body))
+		ids = append(ids, info.MessageID)
+
+		if string(body) == "fails" {
+			return msg.Permanent(errors.New("receive failed"))
+		}
+		return nil
+	}))
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+
+	expected := []string{"hello world", "\xff\x00\x01", "fails", "goodbye"}
+	if strings.Join(bodies, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected bodies %q, got %q", expected, bodies)
+	}
+	if strings.Join(ids, ",") != "1,2,3,4" {
+		t.Errorf("expected message IDs 1,2,3,4, got %v", ids)
+	}
+}
+
+// TestServer_RetryClonesAttributes asserts that changes made to the
+// attributes of a failed attempt are not seen by the next one.
+func TestServer_RetryClonesAttributes(t *testing.T) {
+	var attempts []string
+
+	srv := jsonl.NewServer(strings.NewReader(fixture[:strings.Index(fixture, "\n")+1]), 1)
+	err := srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		attempts = append(attempts, m.Attributes.Get("Content-Type"))
+		if len(attempts) == 1 {
+			m.Attributes.Set("Content-Type", "application/json")
+			return errors.New("try again")
+		}
+		return nil
+	}))
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+
+	expected := []string{"text/plain", "text/plain"}
+	if strings.Join(attempts, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected Content-Type %q on every attempt, got %q", expected, attempts)
+	}
+}
+
+func TestServer_InvalidLine(t *testing.T) {
+	srv := jsonl.NewServer(strings.NewReader("{\"attributes\":{}}\n"), 1)
+	err := srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		t.Error("expected no message to be delivered")
+		return nil
+	}))
+	if err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("expected an error for an invalid line, got %v", err)
+	}
+}
+
+// TestServer_Follow asserts that a following Server delivers lines which
+// are appended to a file after it has been exhausted.
+func TestServer_Follow(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "messages.jsonl")
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	in, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	received := make(chan string, 2)
+	srv := jsonl.NewServer(in, 1, jsonl.WithFollow(10*time.Millisecond))
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			received <- string(body)
+			return nil
+		}))
+	}()
+
+	topic := jsonl.NewTopic(out)
+	for _, body := range []string{"one", "two"} {
+		w := topic.NewWriter(context.Background())
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a line written in parts is delivered once it is complete
+	line := []byte(`{"attributes":{},"body":"three"}` + "\n")
+	out.Write(line[:10])
+	time.Sleep(50 * time.Millisecond)
+	out.Write(line[10:])
+
+	for _, expected := range []string{"one", "two", "three"} {
+		select {
+		case body := <-received:
+			if body != expected {
+				t.Errorf("expected %q, got %q", expected, body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", expected)
+		}
+	}
+
+	srv.Shutdown(context.Background())
+	if err := <-served; !errors.Is(err, msg.ErrServerClosed) {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
+
+// TestServer_RoundTrip asserts that Messages written by a Topic are
+// replayed with the same attributes and body.
+func TestServer_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := jsonl.NewTopic(&buf).NewWriter(context.Background())
+	(*w.Attributes())["X-Multi"] = []string{"a", "b"}
+	w.Write([]byte("hello world"))
+	w.Close()
+
+	srv := jsonl.NewServer(&buf, 1)
+	srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if got := m.Attributes["X-Multi"]; strings.Join(got, ",") != "a,b" {
+			t.Errorf("expected attribute X-Multi to be [a b], got %v", got)
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,105 @@
+package jsonl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Topic appends Messages to an io.Writer as JSON lines.
+// It is safe to use from concurrent goroutines; each Message is written
+// with a single call to Write.
+type Topic struct {
+	W io.Writer
+
+	mux sync.Mutex
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// NewTopic returns a Topic which writes Messages to w.
+func NewTopic(w io.Writer) *Topic {
+	return &Topic{W: w}
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to write a message as a JSON line.
+func (t *Topic) NewWriter(context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// write writes a single encoded line to the underlying io.Writer.
+func (t *Topic) write(b []byte) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	_, err := t.W.Write(b)
+	return err
+}
+
+// MessageWriter is used to publish a single Message as a JSON line.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// The delay is recorded in the JSON line.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close writes the Message as a JSON line.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	b, err := encodeLine(w.attributes, w.buf.Bytes(), w.delay)
+	if err != nil {
+		return err
+	}
+	return w.topic.write(b)
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,36 @@
+package jsonl_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg/backends/jsonl"
+)
+
+func TestTopic_WritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	topic := jsonl.NewTopic(&buf)
+
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("Content-Type", "text/plain")
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w = topic.NewWriter(context.Background())
+	w.SetDelay(90 * time.Second)
+	w.Write([]byte{0xff, 0x00, 0x01})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"attributes":{"Content-Type":["text/plain"]},"body":"hello world"}
+{"attributes":{},"bodyBase64":"/wAB","delay":"1m30s"}
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
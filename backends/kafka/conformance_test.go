@@ -0,0 +1,100 @@
+package kafka_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zerofox-oss/go-msg"
+	msgkafka "github.com/zerofox-oss/go-msg/backends/kafka"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// cluster starts an in-process Kafka cluster with a "messages" topic of
+// the given number of partitions, which is closed when the test
+// completes.
+func cluster(t *testing.T, partitions int32) *kfake.Cluster {
+	t.Helper()
+
+	c, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(partitions, "messages"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// client returns a client of c, which is closed when the test completes.
+func client(t *testing.T, c *kfake.Cluster, opts ...kgo.Opt) *kgo.Client {
+	t.Helper()
+
+	opts = append([]kgo.Opt{
+		kgo.SeedBrokers(c.ListenAddrs()...),
+		kgo.FetchMaxWait(100 * time.Millisecond),
+	}, opts...)
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cl.Close)
+	return cl
+}
+
+// consumer returns a client of c which consumes "messages" as a member
+// of group, as the Server requires.
+func consumer(t *testing.T, c *kfake.Cluster, group string) *kgo.Client {
+	t.Helper()
+
+	return client(t, c,
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics("messages"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		kgo.AutoCommitMarks(),
+	)
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		c := cluster(t, 1)
+		reader := client(t, c,
+			kgo.ConsumeTopics("messages"),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+		)
+
+		var pending []*kgo.Record
+		return msgtest.TopicFixture{
+			Topic: msgkafka.NewTopic(client(t, c), "messages"),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				for len(pending) == 0 {
+					fetches := reader.PollFetches(ctx)
+					if err := ctx.Err(); err != nil {
+						return nil, err
+					}
+					pending = fetches.Records()
+				}
+
+				record := pending[0]
+				pending = pending[1:]
+
+				var kv []string
+				for _, h := range record.Headers {
+					kv = append(kv, h.Key, string(h.Value))
+				}
+				return msgtest.NewMessage(string(record.Value), kv...), nil
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		c := cluster(t, 4)
+
+		return msgtest.ServerFixture{
+			Server: msgkafka.NewServer(consumer(t, c, "group"), 10),
+			Topic:  msgkafka.NewTopic(client(t, c), "messages"),
+		}
+	})
+}
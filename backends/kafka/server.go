@@ -0,0 +1,364 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server consumes records from Kafka as a member of a consumer group.
+//
+// The Client must be created with kgo.ConsumerGroup, the topics to consume
+// and kgo.AutoCommitMarks, so that only the offsets of records the Server
+// marked as processed are committed. A record is marked once Receive
+// returns nil or a permanent error. Other failed records are delivered
+// again after a backoff, or the delay requested with msg.RetryAfter,
+// before the records which follow them in their partition.
+type Server struct {
+	Client *kgo.Client
+
+	// Concurrency is the maximum number of partitions whose records can
+	// be processed concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	backoffBase     time.Duration
+	backoffMax      time.Duration
+	maxReceiveCount int
+
+	// partitions holds the batches of records of every partition which
+	// is being processed, in the order they were fetched.
+	partitions map[partition]*backlog
+	mux        sync.Mutex
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// partition identifies a partition of a topic.
+type partition struct {
+	topic     string
+	partition int32
+}
+
+// backlog holds the batches of records of a partition which wait for the
+// batch being processed.
+type backlog struct {
+	batches [][]*kgo.Record
+}
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithRedeliveryBackoff delays the redelivery of failed records
+// exponentially, starting at base and doubling with every delivery
+// up to max. The default is 100ms, up to 10s.
+//
+// A delay requested by the Receiver via msg.RetryAfter takes precedence.
+func WithRedeliveryBackoff(base, max time.Duration) ServerOption {
+	return func(s *Server) {
+		s.backoffBase = base
+		s.backoffMax = max
+	}
+}
+
+// WithMaxReceiveCount sets the number of times a record may be delivered
+// before it is committed and dropped, so that it no longer holds up its
+// partition. A zero count, the default, means records are redelivered
+// until they succeed.
+func WithMaxReceiveCount(n int) ServerOption {
+	return func(s *Server) {
+		s.maxReceiveCount = n
+	}
+}
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed
+func (s *Server) Serve(r msg.Receiver) error {
+	for {
+		fetches := s.Client.PollFetches(s.listenerCtx)
+		if s.listenerCtx.Err() != nil {
+			// the offsets of records which were not delivered are not
+			// committed, so the group delivers them again
+			return msg.ErrServerClosed
+		}
+		if fetches.IsClientClosed() {
+			return kgo.ErrClientClosed
+		}
+
+		fetches.EachError(func(topic string, p int32, err error) {
+			log.Printf("could not fetch records from %s/%d %s", topic, p, err)
+		})
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			if len(p.Records) > 0 {
+				s.dispatch(r, partition{topic: p.Topic, partition: p.Partition}, p.Records)
+			}
+		})
+	}
+}
+
+// dispatch processes records, a batch of the partition p, in a new
+// goroutine. If a batch of p is being processed already, records are
+// queued behind it instead, and fetching p is paused until its queue is
+// drained, so that a partition which is held up by retries or delayed
+// records only ever takes a single slot. dispatch blocks until a slot is
+// free, and does nothing if the Server was shut down.
+func (s *Server) dispatch(r msg.Receiver, p partition, records []*kgo.Record) {
+	s.mux.Lock()
+	if b, ok := s.partitions[p]; ok {
+		// paused under the lock, so that next cannot resume p first
+		b.batches = append(b.batches, records)
+		s.Client.PauseFetchPartitions(map[string][]int32{p.topic: {p.partition}})
+		s.mux.Unlock()
+		return
+	}
+	s.partitions[p] = &backlog{}
+	s.mux.Unlock()
+
+	// acquire "lock"
+	select {
+	case <-s.listenerCtx.Done():
+		s.mux.Lock()
+		delete(s.partitions, p)
+		s.mux.Unlock()
+		return
+	case s.maxConcurrentReceives <- struct{}{}:
+	}
+
+	go func(ctx context.Context) {
+		defer func() {
+			<-s.maxConcurrentReceives
+		}()
+
+		for records != nil {
+			for _, record := range records {
+				if !s.process(ctx, r, record) {
+					// the batches which follow are delivered again by
+					// the group, since they were not committed
+					s.mux.Lock()
+					delete(s.partitions, p)
+					s.mux.Unlock()
+					return
+				}
+			}
+			records = s.next(p)
+		}
+	}(s.receiverCtx)
+}
+
+// next returns the next batch queued for the partition p, or nil once
+// its queue is drained, in which case fetching p is resumed.
+func (s *Server) next(p partition) []*kgo.Record {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	b := s.partitions[p]
+	if len(b.batches) > 0 {
+		records := b.batches[0]
+		b.batches = b.batches[1:]
+		return records
+	}
+	delete(s.partitions, p)
+	s.Client.ResumeFetchPartitions(map[string][]int32{p.topic: {p.partition}})
+	return nil
+}
+
+// process delivers record to r until it succeeds or fails permanently,
+// then marks it to be committed. It returns false if the Server was shut
+// down first, in which case the records which follow it in its partition
+// must not be processed either.
+func (s *Server) process(ctx context.Context, r msg.Receiver, record *kgo.Record) bool {
+	if _, deliverAt := decode(record); !s.sleep(time.Until(deliverAt)) {
+		return false
+	}
+
+	info := msg.DeliveryInfo{
+		MessageID:     fmt.Sprintf("%s/%d/%d", record.Topic, record.Partition, record.Offset),
+		PublishTime:   record.Timestamp,
+		FirstReceived: time.Now(),
+		Source:        s.Name,
+	}
+	for {
+		if s.listenerCtx.Err() != nil {
+			return false
+		}
+
+		info.ReceiveCount++
+		if s.maxReceiveCount > 0 && info.ReceiveCount > s.maxReceiveCount {
+			log.Printf("dropping message %s: exceeded max receive count", info.MessageID)
+			s.Client.MarkCommitRecords(record)
+			return true
+		}
+
+		// every delivery gets a Message of its own, so that changes made
+		// by the Receiver do not leak into the next one
+		m, _ := decode(record)
+		err := r.Receive(msg.WithDeliveryInfo(ctx, info), m)
+		if err == nil {
+			s.Client.MarkCommitRecords(record)
+			return true
+		}
+		log.Printf("could not receive message %s", err)
+
+		if !msg.IsRetryable(err) {
+			log.Printf("dropping message %s", err)
+			s.Client.MarkCommitRecords(record)
+			return true
+		}
+
+		delay, ok := msg.RetryDelay(err)
+		if !ok {
+			delay = s.backoff(info.ReceiveCount)
+		}
+		if !s.sleep(delay) {
+			return false
+		}
+	}
+}
+
+// sleep blocks for d. It returns false if the Server was shut down in the
+// meantime.
+func (s *Server) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return s.listenerCtx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.listenerCtx.Done():
+		return false
+	}
+}
+
+// backoff returns how long to wait before redelivering a record which
+// has been received n times.
+func (s *Server) backoff(n int) time.Duration {
+	if s.backoffBase <= 0 {
+		return 0
+	}
+
+	delay := s.backoffBase
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if s.backoffMax > 0 && delay >= s.backoffMax {
+			return s.backoffMax
+		}
+	}
+	return delay
+}
+
+// decode converts record to a Message and the time it is due.
+func decode(record *kgo.Record) (*msg.Message, time.Time) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewReader(record.Value),
+	}
+
+	var deliverAt time.Time
+	for _, h := range record.Headers {
+		k := textproto.CanonicalMIMEHeaderKey(h.Key)
+		if k == headerDeliverAt {
+			if ms, err := strconv.ParseInt(string(h.Value), 10, 64); err == nil {
+				deliverAt = time.UnixMilli(ms)
+			}
+			continue
+		}
+		m.Attributes[k] = append(m.Attributes[k], string(h.Value))
+	}
+	return m, deliverAt
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops polling for new records
+// and then it waits for all of the active goroutines to complete. The
+// offsets of the records which were processed are then committed.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned. Records which were not committed are delivered again to
+// the next member of the group which is assigned their partition.
+//
+// Shutdown does not close the Client.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				if err := s.Client.CommitMarkedOffsets(ctx); err != nil {
+					return err
+				}
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which consumes records
+// with client.
+func NewServer(client *kgo.Client, cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		Client:      client,
+		Concurrency: cc,
+
+		backoffBase: 100 * time.Millisecond,
+		backoffMax:  10 * time.Second,
+
+		partitions: make(map[partition]*backlog),
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
@@ -0,0 +1,357 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zerofox-oss/go-msg"
+	msgkafka "github.com/zerofox-oss/go-msg/backends/kafka"
+)
+
+func publish(t *testing.T, topic msg.Topic, body string, kv ...string) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	for i := 0; i+1 < len(kv); i += 2 {
+		w.Attributes().Set(kv[i], kv[i+1])
+	}
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts srv in the background and shuts it down when the test
+// completes.
+func serve(t *testing.T, srv *msgkafka.Server, r msg.ReceiverFunc) {
+	go srv.Serve(r)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+}
+
+func body(t *testing.T, m *msg.Message) string {
+	t.Helper()
+
+	b, err := msg.DumpBody(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestTopic_UsesKeyAttributeAsRecordKey(t *testing.T) {
+	c := cluster(t, 8)
+	topic := msgkafka.NewTopic(client(t, c), "messages", msgkafka.WithKeyAttribute("Device-Id"))
+	for i := 0; i < 10; i++ {
+		publish(t, topic, fmt.Sprintf("reading #%d", i), "Device-Id", "sensor-1")
+	}
+
+	reader := client(t, c,
+		kgo.ConsumeTopics("messages"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	var records []*kgo.Record
+	for len(records) < 10 {
+		records = append(records, reader.PollFetches(context.Background()).Records()...)
+	}
+
+	for i, record := range records {
+		if string(record.Key) != "sensor-1" {
+			t.Errorf("expected key sensor-1, got %q", record.Key)
+		}
+		if record.Partition != records[0].Partition {
+			t.Errorf("expected every record in partition %d, got %d", records[0].Partition, record.Partition)
+		}
+		if want := fmt.Sprintf("reading #%d", i); string(record.Value) != want {
+			t.Errorf("expected %q, got %q", want, record.Value)
+		}
+	}
+}
+
+// Tests that a failed record is delivered again before the records which
+// follow it in its partition.
+func TestServer_KeepsPartitionOrderOnRetry(t *testing.T) {
+	c := cluster(t, 1)
+	topic := msgkafka.NewTopic(client(t, c), "messages")
+	for i := 0; i < 3; i++ {
+		publish(t, topic, fmt.Sprintf("message #%d", i))
+	}
+
+	var mux sync.Mutex
+	var got []string
+	done := make(chan struct{})
+	srv := msgkafka.NewServer(consumer(t, c, "group"), 10, msgkafka.WithRedeliveryBackoff(10*time.Millisecond, 0))
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		mux.Lock()
+		defer mux.Unlock()
+
+		b := body(t, m)
+		got = append(got, b)
+		if info, _ := msg.DeliveryInfoFromContext(ctx); b == "message #1" && info.ReceiveCount == 1 {
+			return errors.New("try again")
+		}
+		if b == "message #2" {
+			close(done)
+		}
+		return nil
+	})
+
+	<-done
+	mux.Lock()
+	defer mux.Unlock()
+
+	want := []string{"message #0", "message #1", "message #1", "message #2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected deliveries %q, got %q", want, got)
+	}
+}
+
+// Tests that a slow record holds up its partition only.
+func TestServer_ProcessesPartitionsConcurrently(t *testing.T) {
+	c := cluster(t, 2)
+	topic := msgkafka.NewTopic(client(t, c), "messages", msgkafka.WithKeyAttribute("Key"))
+
+	// find two keys which are produced to different partitions
+	partitions := make(map[int32]string)
+	reader := client(t, c, kgo.ConsumeTopics("messages"), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	for i := 0; len(partitions) < 2; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		publish(t, topic, "probe", "Key", key)
+		for _, record := range reader.PollFetches(context.Background()).Records() {
+			if _, ok := partitions[record.Partition]; !ok {
+				partitions[record.Partition] = string(record.Key)
+			}
+		}
+	}
+	slow, fast := partitions[0], partitions[1]
+	publish(t, topic, "slow", "Key", slow)
+	publish(t, topic, "fast", "Key", fast)
+
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+	srv := msgkafka.NewServer(consumer(t, c, "group"), 2)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		switch body(t, m) {
+		case "slow":
+			<-release
+		case "fast":
+			close(fastDone)
+		}
+		return nil
+	})
+	defer close(release)
+
+	select {
+	case <-fastDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the fast partition to progress while the slow one is blocked")
+	}
+}
+
+// Tests that batches fetched for a partition which is held up do not take
+// the slots of other partitions, and are processed in order once it is
+// released.
+func TestServer_QueuesBatchesOfBusyPartitions(t *testing.T) {
+	c := cluster(t, 2)
+	topic := msgkafka.NewTopic(client(t, c), "messages", msgkafka.WithKeyAttribute("Key"))
+
+	// find two keys which are produced to different partitions
+	partitions := make(map[int32]string)
+	reader := client(t, c, kgo.ConsumeTopics("messages"), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	for i := 0; len(partitions) < 2; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		publish(t, topic, "probe", "Key", key)
+		for _, record := range reader.PollFetches(context.Background()).Records() {
+			if _, ok := partitions[record.Partition]; !ok {
+				partitions[record.Partition] = string(record.Key)
+			}
+		}
+	}
+	slow, fast := partitions[0], partitions[1]
+
+	var mux sync.Mutex
+	var got []string
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	fastDone := make(chan struct{})
+	slowDone := make(chan struct{})
+	srv := msgkafka.NewServer(consumer(t, c, "group"), 2)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		b := body(t, m)
+		mux.Lock()
+		got = append(got, b)
+		mux.Unlock()
+
+		switch b {
+		case "slow #0":
+			close(blocked)
+			<-release
+		case "slow #3":
+			close(slowDone)
+		case "fast":
+			close(fastDone)
+		}
+		return nil
+	})
+
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+
+	publish(t, topic, "slow #0", "Key", slow)
+	<-blocked
+
+	// every record is fetched in a batch of its own
+	for i := 1; i <= 3; i++ {
+		publish(t, topic, fmt.Sprintf("slow #%d", i), "Key", slow)
+		time.Sleep(200 * time.Millisecond)
+	}
+	publish(t, topic, "fast", "Key", fast)
+
+	select {
+	case <-fastDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the fast partition to progress while batches of the slow one are queued")
+	}
+
+	unblock()
+	select {
+	case <-slowDone:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the queued batches of the slow partition to be processed")
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	var slows []string
+	for _, b := range got {
+		if b != "fast" && b != "probe" {
+			slows = append(slows, b)
+		}
+	}
+	want := []string{"slow #0", "slow #1", "slow #2", "slow #3"}
+	if fmt.Sprint(slows) != fmt.Sprint(want) {
+		t.Errorf("expected deliveries %q, got %q", want, slows)
+	}
+}
+
+// Tests that only the offsets of processed records are committed, so
+// that the next member of the group resumes after them.
+func TestServer_CommitsProcessedRecordsOnly(t *testing.T) {
+	c := cluster(t, 1)
+	topic := msgkafka.NewTopic(client(t, c), "messages")
+	for i := 0; i < 3; i++ {
+		publish(t, topic, fmt.Sprintf("message #%d", i))
+	}
+
+	first := msgkafka.NewServer(consumer(t, c, "group"), 1)
+	received := make(chan string, 3)
+	blocked := make(chan struct{})
+	go first.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		b := body(t, m)
+		if b == "message #1" {
+			close(blocked)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		received <- b
+		return nil
+	}))
+
+	<-blocked
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := first.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Shutdown to time out, got %v", err)
+	}
+	if err := first.Client.CommitMarkedOffsets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first.Client.LeaveGroup()
+
+	second := msgkafka.NewServer(consumer(t, c, "group"), 1)
+	serve(t, second, func(ctx context.Context, m *msg.Message) error {
+		received <- body(t, m)
+		return nil
+	})
+
+	want := []string{"message #0", "message #1", "message #2"}
+	for _, w := range want {
+		select {
+		case got := <-received:
+			if got != w {
+				t.Errorf("expected %q, got %q", w, got)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func TestServer_ProvidesDeliveryInfo(t *testing.T) {
+	c := cluster(t, 1)
+	publish(t, msgkafka.NewTopic(client(t, c), "messages"), "hello world", "X-Request-Id", "1234")
+
+	infos := make(chan msg.DeliveryInfo, 2)
+	srv := msgkafka.NewServer(consumer(t, c, "group"), 1, msgkafka.WithRedeliveryBackoff(10*time.Millisecond, 0))
+	srv.Name = "kafka"
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		infos <- info
+		if info.ReceiveCount == 1 {
+			// changes made to the Message must not leak into the next delivery
+			m.Attributes.Set("X-Request-Id", "changed")
+			return errors.New("try again")
+		}
+		if got := m.Attributes.Get("X-Request-Id"); got != "1234" {
+			t.Errorf("expected attribute X-Request-Id to be 1234, got %q", got)
+		}
+		return nil
+	})
+
+	first, second := <-infos, <-infos
+	if first.MessageID != "messages/0/0" {
+		t.Errorf("expected MessageID messages/0/0, got %s", first.MessageID)
+	}
+	if first.Source != "kafka" {
+		t.Errorf("expected Source kafka, got %s", first.Source)
+	}
+	if first.PublishTime.IsZero() || first.FirstReceived.IsZero() {
+		t.Error("expected PublishTime and FirstReceived to be set")
+	}
+	if second.ReceiveCount != 2 {
+		t.Errorf("expected ReceiveCount 2, got %d", second.ReceiveCount)
+	}
+}
+
+func TestServer_HonorsDelay(t *testing.T) {
+	c := cluster(t, 1)
+	start := time.Now()
+
+	w := msgkafka.NewTopic(client(t, c), "messages").NewWriter(context.Background())
+	w.SetDelay(300 * time.Millisecond)
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *msg.Message, 1)
+	serve(t, msgkafka.NewServer(consumer(t, c, "group"), 1), func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	})
+
+	// the due time is stored with millisecond precision
+	m := <-received
+	if d := time.Since(start); d < 299*time.Millisecond {
+		t.Errorf("expected the message to be delayed by at least 300ms, got %s", d)
+	}
+	if got := m.Attributes.Get("Msg-Deliver-At"); got != "" {
+		t.Errorf("expected the delay header to be removed, got %q", got)
+	}
+}
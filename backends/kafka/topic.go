@@ -0,0 +1,163 @@
+// Package kafka provides a backend which uses Kafka topics.
+//
+// A Topic produces every Message as a record, with its attributes as
+// record headers. The record key, which selects the partition, can be
+// taken from an attribute, so that related Messages are kept in order.
+//
+// A Server consumes records as a member of a consumer group. The records
+// of each partition are delivered one at a time and in order, while
+// partitions are processed concurrently. The offset of a record is only
+// committed once Receive returned nil or a permanent error, so records
+// which were not processed are delivered again after a restart or a
+// rebalance.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// headerDeliverAt holds the time, in unix milliseconds, before which a
+// delayed Message must not be delivered. It is removed from the attributes
+// of received Messages.
+const headerDeliverAt = "Msg-Deliver-At"
+
+// Topic produces Messages to a Kafka topic.
+type Topic struct {
+	Client *kgo.Client
+	Topic  string
+
+	// KeyAttribute is the attribute whose value is used as the record
+	// key. Records without a key are spread over partitions.
+	KeyAttribute string
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// TopicOption is a functional option for the Topic.
+type TopicOption func(*Topic)
+
+// WithKeyAttribute sets the attribute whose value is used as the record
+// key. Messages with the same key are produced to the same partition, and
+// so are delivered in the order they were published. The attribute is
+// sent as a header as well.
+func WithKeyAttribute(key string) TopicOption {
+	return func(t *Topic) {
+		t.KeyAttribute = key
+	}
+}
+
+// NewTopic returns a Topic which produces Messages to topic.
+func NewTopic(client *kgo.Client, topic string, opts ...TopicOption) *Topic {
+	t := &Topic{
+		Client: client,
+		Topic:  topic,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to produce a single record.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to produce a single record to Kafka.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// Kafka has no delayed records, so the record is produced immediately
+// and the Server holds it until it is due, along with the records which
+// follow it in its partition.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close produces the record and waits for Kafka to acknowledge it.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	record := &kgo.Record{
+		Topic: w.topic.Topic,
+		Value: w.buf.Bytes(),
+	}
+	if w.topic.KeyAttribute != "" {
+		if key := w.attributes.Get(w.topic.KeyAttribute); key != "" {
+			record.Key = []byte(key)
+		}
+	}
+
+	// every value is a header of its own, which Kafka allows
+	for k, vv := range w.attributes {
+		for _, v := range vv {
+			record.Headers = append(record.Headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
+		}
+	}
+	if w.delay > 0 {
+		deliverAt := time.Now().Add(w.delay).UnixMilli()
+		record.Headers = append(record.Headers, kgo.RecordHeader{
+			Key:   headerDeliverAt,
+			Value: []byte(strconv.FormatInt(deliverAt, 10)),
+		})
+	}
+
+	return w.topic.Client.ProduceSync(w.ctx, record).FirstErr()
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,107 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Broker routes Messages from named topics to named subscriptions.
+// Every Message published to a topic is copied to each of its
+// subscriptions, similar to an SNS topic with multiple SQS queues.
+//
+// Each subscription has its own channel and its own Server, so that
+// multiple Receivers can process the same Message independently.
+// Messages published to a topic without subscriptions are dropped.
+type Broker struct {
+	// Clock schedules delayed Messages for every subscription.
+	// If nil, the system clock is used.
+	Clock Clock
+
+	// QueueSize is the buffer size of each subscription's channel.
+	QueueSize int
+
+	mux           sync.Mutex
+	subscriptions map[string]map[string]*subscription
+}
+
+// subscription is a queue which receives copies of a topic's Messages.
+type subscription struct {
+	topic  *Topic
+	server *Server
+}
+
+// NewBroker creates and initializes a new Broker whose subscription
+// channels buffer up to size Messages.
+func NewBroker(size int) *Broker {
+	return &Broker{
+		QueueSize:     size,
+		subscriptions: make(map[string]map[string]*subscription),
+	}
+}
+
+// Topic returns a msg.Topic which publishes to the named topic.
+// The topic does not need to have any subscriptions.
+func (b *Broker) Topic(name string) msg.Topic {
+	return msg.TopicFunc(func(context.Context) msg.MessageWriter {
+		return &MessageWriter{
+			publish: func(m *msg.Message, delay time.Duration) {
+				b.fanout(name, m, delay)
+			},
+
+			attributes: make(map[string][]string),
+			buf:        &bytes.Buffer{},
+		}
+	})
+}
+
+// Subscribe creates a subscription to the named topic and returns the
+// Server which serves its Messages. The Server is created with the given
+// concurrency and options, and is named after the subscription.
+//
+// Only Messages published after Subscribe returns are delivered.
+// It is an error to subscribe twice with the same name to a topic.
+func (b *Broker) Subscribe(topic, name string, cc int, opts ...ServerOption) (*Server, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	subs, ok := b.subscriptions[topic]
+	if !ok {
+		subs = make(map[string]*subscription)
+		b.subscriptions[topic] = subs
+	}
+	if _, ok := subs[name]; ok {
+		return nil, fmt.Errorf("mem: subscription %q already exists on topic %q", name, topic)
+	}
+
+	c := make(chan *msg.Message, b.QueueSize)
+
+	srv := NewServer(c, cc, opts...)
+	srv.Name = name
+
+	subs[name] = &subscription{
+		topic:  &Topic{C: c, Clock: b.Clock},
+		server: srv,
+	}
+	return srv, nil
+}
+
+// fanout publishes a copy of m to every subscription of the named topic.
+func (b *Broker) fanout(topic string, m *msg.Message, delay time.Duration) {
+	b.mux.Lock()
+	subs := make([]*subscription, 0, len(b.subscriptions[topic]))
+	for _, sub := range b.subscriptions[topic] {
+		subs = append(subs, sub)
+	}
+	b.mux.Unlock()
+
+	// m was created by MessageWriter.Close, so its Body is always a buffer
+	body := m.Body.(*bytes.Buffer).Bytes()
+	for _, sub := range subs {
+		sub.topic.publish(msg.WithBody(m, bytes.NewBuffer(body)), delay)
+	}
+}
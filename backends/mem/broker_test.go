@@ -0,0 +1,118 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+)
+
+// TestBroker_FanOut asserts that every subscription of a topic receives
+// its own copy of each published message.
+func TestBroker_FanOut(t *testing.T) {
+	broker := mem.NewBroker(10)
+
+	type delivery struct {
+		source string
+		body   string
+	}
+	deliveries := make(chan delivery, 4)
+
+	for _, name := range []string{"billing", "shipping"} {
+		srv, err := broker.Subscribe("orders", name, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			info, _ := msg.DeliveryInfoFromContext(ctx)
+			deliveries <- delivery{source: info.Source, body: string(body)}
+			return nil
+		}))
+		defer srv.Shutdown(context.Background())
+	}
+
+	w := broker.Topic("orders").NewWriter(context.Background())
+	w.Attributes().Set("Type", "OrderPlaced")
+	w.Write([]byte("order #1"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := map[string]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case d := <-deliveries:
+			received[d.source] = d.body
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected message to be delivered to every subscription")
+		}
+	}
+
+	for _, name := range []string{"billing", "shipping"} {
+		if received[name] != "order #1" {
+			t.Errorf("expected %s to receive %q, got %q", name, "order #1", received[name])
+		}
+	}
+}
+
+// TestBroker_Delay asserts that delayed messages are held for every
+// subscription until they are due.
+func TestBroker_Delay(t *testing.T) {
+	clock := mem.NewFakeClock(time.Now())
+	broker := mem.NewBroker(10)
+	broker.Clock = clock
+
+	srv, err := broker.Subscribe("reminders", "mailer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := broker.Topic("reminders").NewWriter(context.Background())
+	w.SetDelay(time.Hour)
+	w.Write([]byte("renew your subscription"))
+	w.Close()
+
+	if n := len(srv.C); n != 0 {
+		t.Fatalf("got %d messages in channel, wanted 0", n)
+	}
+
+	clock.Advance(time.Hour)
+
+	if n := len(srv.C); n != 1 {
+		t.Fatalf("got %d messages in channel, wanted 1", n)
+	}
+}
+
+// TestBroker_SubscribeTwice asserts that a subscription name may only be
+// used once per topic.
+func TestBroker_SubscribeTwice(t *testing.T) {
+	broker := mem.NewBroker(1)
+
+	if _, err := broker.Subscribe("orders", "billing", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := broker.Subscribe("orders", "billing", 1); err == nil {
+		t.Error("expected an error when subscribing twice")
+	}
+	if _, err := broker.Subscribe("refunds", "billing", 1); err != nil {
+		t.Errorf("expected subscription to another topic to succeed, got %v", err)
+	}
+}
+
+// TestBroker_NoSubscriptions asserts that publishing to a topic without
+// subscriptions does not block.
+func TestBroker_NoSubscriptions(t *testing.T) {
+	broker := mem.NewBroker(0)
+
+	w := broker.Topic("orders").NewWriter(context.Background())
+	w.Write([]byte("nobody is listening"))
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,117 @@
+package mem
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and timers to a Topic.
+// It allows tests to control when delayed Messages are delivered.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc waits for the duration to elapse and then calls f.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer represents a single event scheduled by a Clock.
+type Timer interface {
+	// Stop prevents the Timer from firing. It returns false if the Timer
+	// has already fired or been stopped.
+	Stop() bool
+}
+
+// systemClock is a Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock is a Clock whose time only moves when Advance is called.
+// It is safe to use from concurrent goroutines.
+type FakeClock struct {
+	mux    sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// Ensure that FakeClock implements Clock
+var _ Clock = &FakeClock{}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the FakeClock.
+func (c *FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.now
+}
+
+// AfterFunc schedules f to be called once the FakeClock has been
+// advanced by at least d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	t := &fakeTimer{
+		clock: c,
+		due:   c.now.Add(d),
+		f:     f,
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the FakeClock forward by d and calls the functions of all
+// Timers which are due, in the order they are due. The functions are called
+// synchronously, so Advance returns once all of them have returned.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	c.now = c.now.Add(d)
+
+	var due, pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.due.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	c.mux.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].due.Before(due[j].due)
+	})
+	for _, t := range due {
+		t.f()
+	}
+}
+
+type fakeTimer struct {
+	clock *FakeClock
+	due   time.Time
+	f     func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mux.Lock()
+	defer t.clock.mux.Unlock()
+
+	for i, tt := range t.clock.timers {
+		if tt == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
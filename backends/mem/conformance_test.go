@@ -0,0 +1,37 @@
+package mem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		c := make(chan *msg.Message, 100)
+		return msgtest.TopicFixture{
+			Topic: &mem.Topic{C: c},
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case m := <-c:
+					return m, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		c := make(chan *msg.Message, 100)
+		return msgtest.ServerFixture{
+			Server: mem.NewServer(c, 10),
+			Topic:  &mem.Topic{C: c},
+		}
+	})
+}
@@ -1,8 +1,11 @@
 package mem
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/zerofox-oss/go-msg"
@@ -16,6 +19,21 @@ type Server struct {
 	// concurrently by the Server.
 	Concurrency int
 
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	visibilityTimeout time.Duration
+	backoffBase       time.Duration
+	backoffMax        time.Duration
+	maxReceiveCount   int
+	deadLetter        chan *msg.Message
+
+	// deliveries tracks the state of Messages which have been
+	// received but not yet processed successfully.
+	deliveries map[*msg.Message]*delivery
+	mux        sync.Mutex
+
 	// maxConcurrentReceives is a buffered channel which acts as
 	// a shared lock that limits the number of concurrent goroutines
 	maxConcurrentReceives chan struct{}
@@ -27,9 +45,67 @@ type Server struct {
 	receiverCancelFunc context.CancelFunc
 }
 
+// delivery is the state of a Message which has been received by the Server.
+type delivery struct {
+	info msg.DeliveryInfo
+	body []byte
+
+	// lease identifies the current delivery of the Message. The outcome
+	// of a delivery whose lease has expired is ignored.
+	lease int
+	timer *time.Timer
+}
+
 // Ensure that Server implements msg.Server
 var _ msg.Server = &Server{}
 
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithVisibilityTimeout sets how long a Message is leased to a Receiver.
+// If Receive has not returned once the timeout elapses, the Message is
+// redelivered and the outcome of the original delivery is ignored.
+// A zero duration, the default, means Messages are leased indefinitely.
+func WithVisibilityTimeout(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.visibilityTimeout = d
+	}
+}
+
+// WithRedeliveryBackoff delays the redelivery of failed Messages
+// exponentially, starting at base and doubling with every delivery
+// up to max. By default, failed Messages are redelivered immediately.
+//
+// A delay requested by the Receiver via msg.RetryAfter takes precedence.
+func WithRedeliveryBackoff(base, max time.Duration) ServerOption {
+	return func(s *Server) {
+		s.backoffBase = base
+		s.backoffMax = max
+	}
+}
+
+// WithMaxReceiveCount sets the number of times a Message may be delivered
+// before it is dead-lettered. A zero count, the default, means Messages
+// are redelivered until they succeed.
+func WithMaxReceiveCount(n int) ServerOption {
+	return func(s *Server) {
+		s.maxReceiveCount = n
+	}
+}
+
+// WithDeadLetter sets the channel that Messages are sent to when they
+// exceed the max receive count or fail permanently. Without a dead-letter
+// channel, such Messages are dropped.
+//
+// A Message holds its concurrency slot until it is sent, so c should be
+// buffered or drained concurrently. Once the Server is shut down, Messages
+// are only sent if c has room for them, and dropped otherwise.
+func WithDeadLetter(c chan *msg.Message) ServerOption {
+	return func(s *Server) {
+		s.deadLetter = c
+	}
+}
+
 // Serve always returns a non-nil error.
 // After Shutdown, the returned error is ErrServerClosed
 func (s *Server) Serve(r msg.Receiver) error {
@@ -52,15 +128,168 @@ func (s *Server) Serve(r msg.Receiver) error {
 					<-s.maxConcurrentReceives
 				}()
 
-				if err := r.Receive(ctx, m); err != nil {
-					log.Printf("could not receive message %s", err)
-					s.C <- m
+				dm, info, lease, err := s.deliver(m)
+				if err != nil {
+					s.kill(m, err)
+					return
 				}
+
+				err = r.Receive(msg.WithDeliveryInfo(ctx, info), dm)
+				s.settle(m, lease, err)
 			}(s.receiverCtx, m)
 		}
 	}
 }
 
+// deliver records a delivery of m. It returns a copy of m for the
+// Receiver, which has its own Body so that concurrent deliveries of
+// the same Message do not interfere, along with its msg.DeliveryInfo.
+func (s *Server) deliver(m *msg.Message) (*msg.Message, msg.DeliveryInfo, int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	d, ok := s.deliveries[m]
+	if !ok {
+		id, publishTime := published(m)
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			return nil, msg.DeliveryInfo{}, 0, err
+		}
+
+		d = &delivery{
+			info: msg.DeliveryInfo{
+				MessageID:     id,
+				FirstReceived: time.Now(),
+				PublishTime:   publishTime,
+				Source:        s.Name,
+			},
+			body: body,
+		}
+		s.deliveries[m] = d
+	}
+	d.info.ReceiveCount++
+	d.lease++
+
+	if s.visibilityTimeout > 0 {
+		lease := d.lease
+		d.timer = time.AfterFunc(s.visibilityTimeout, func() {
+			s.settle(m, lease, errVisibilityTimeout)
+		})
+	}
+
+	dm := msg.WithBody(m, bytes.NewReader(d.body))
+	return dm, d.info, d.lease, nil
+}
+
+// errVisibilityTimeout is used to settle deliveries whose lease expired.
+var errVisibilityTimeout = errors.New("mem: visibility timeout exceeded")
+
+// settle handles the outcome of a delivery. Successful Messages are
+// forgotten. Failed Messages are redelivered, unless they failed
+// permanently or exceeded the max receive count, in which case they are
+// dead-lettered. Outcomes of deliveries whose lease expired are ignored.
+func (s *Server) settle(m *msg.Message, lease int, err error) {
+	s.mux.Lock()
+	d, ok := s.deliveries[m]
+	if !ok || d.lease != lease {
+		s.mux.Unlock()
+		return
+	}
+	// expire the lease so that no other outcome is handled for it
+	d.lease++
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+
+	if err == nil {
+		delete(s.deliveries, m)
+		s.mux.Unlock()
+		return
+	}
+	log.Printf("could not receive message %s", err)
+
+	if !msg.IsRetryable(err) || (s.maxReceiveCount > 0 && d.info.ReceiveCount >= s.maxReceiveCount) {
+		delete(s.deliveries, m)
+		s.mux.Unlock()
+		s.kill(m, err)
+		return
+	}
+
+	delay, ok := msg.RetryDelay(err)
+	if !ok {
+		delay = s.backoff(d.info.ReceiveCount)
+	}
+	s.mux.Unlock()
+
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			s.redeliver(m)
+		})
+		return
+	}
+	s.redeliver(m)
+}
+
+// redeliver sends m back to the channel. Once the Server is shut down,
+// nothing may read from the channel anymore, so m is only sent if the
+// channel has room for it, and dropped otherwise.
+func (s *Server) redeliver(m *msg.Message) {
+	select {
+	case s.C <- m:
+		return
+	case <-s.listenerCtx.Done():
+	}
+
+	select {
+	case s.C <- m:
+	default:
+		s.mux.Lock()
+		delete(s.deliveries, m)
+		s.mux.Unlock()
+		log.Printf("dropping message %s", msg.ErrServerClosed)
+	}
+}
+
+// kill sends m to the dead-letter channel, or drops it if there is none.
+// Once the Server is shut down, m is only sent if the dead-letter channel
+// has room for it, and dropped otherwise.
+func (s *Server) kill(m *msg.Message, err error) {
+	if s.deadLetter == nil {
+		log.Printf("dropping message %s", err)
+		return
+	}
+
+	select {
+	case s.deadLetter <- m:
+		return
+	case <-s.listenerCtx.Done():
+	}
+
+	select {
+	case s.deadLetter <- m:
+	default:
+		log.Printf("dropping message %s", err)
+	}
+}
+
+// backoff returns how long to wait before redelivering a Message which
+// has been received n times.
+func (s *Server) backoff(n int) time.Duration {
+	if s.backoffBase <= 0 {
+		return 0
+	}
+
+	delay := s.backoffBase
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if s.backoffMax > 0 && delay >= s.backoffMax {
+			return s.backoffMax
+		}
+	}
+	return delay
+}
+
 // shutdownPollInterval is how often we poll for quiescence
 // during Server.Shutdown.
 const shutdownPollInterval = 50 * time.Millisecond
@@ -69,6 +298,8 @@ const shutdownPollInterval = 50 * time.Millisecond
 // interrupting any messages in flight.
 // When Shutdown is signalled, the Server stops polling for new Messages
 // and then it waits for all of the active goroutines to complete.
+// Messages which fail from then on, or whose redelivery is due, are put
+// back on the channel if it has room, and dropped otherwise.
 //
 // If the provided context expires before the shutdown is complete,
 // then any remaining goroutines will be killed and the context's error
@@ -97,7 +328,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 }
 
 // NewServer creates and initializes a new Server.
-func NewServer(c chan *msg.Message, cc int) *Server {
+func NewServer(c chan *msg.Message, cc int, opts ...ServerOption) *Server {
 	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
 	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
 
@@ -105,11 +336,16 @@ func NewServer(c chan *msg.Message, cc int) *Server {
 		C:           c,
 		Concurrency: cc,
 
+		deliveries:            make(map[*msg.Message]*delivery),
 		listenerCtx:           listenerCtx,
 		listenerCancelFunc:    listenerCancelFunc,
 		receiverCtx:           receiverCtx,
 		receiverCancelFunc:    receiverCancelFunc,
 		maxConcurrentReceives: make(chan struct{}, cc),
 	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
 	return srv
 }
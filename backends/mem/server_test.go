@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -212,3 +213,327 @@ func TestServer_ShutdownContextTimeoutExceeded(t *testing.T) {
 
 	<-done
 }
+
+// TestServer_ShutdownDoesNotBlockOnRedelivery asserts that a Message which
+// fails while the Server shuts down does not block its goroutine on a
+// channel nobody reads from anymore.
+func TestServer_ShutdownDoesNotBlockOnRedelivery(t *testing.T) {
+	srv := mem.NewServer(make(chan *msg.Message), 1)
+
+	inflight := make(chan struct{})
+	release := make(chan struct{})
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		close(inflight)
+		<-release
+		return errors.New("try again")
+	}))
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("hello world!"),
+	}
+	<-inflight
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	// let Serve stop reading from the channel before the Receiver fails
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if err := <-shutdown; err != msg.ErrServerClosed {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
+
+// TestServer_ShutdownDoesNotBlockOnDeadLetter asserts that a Message which
+// is dead-lettered while the Server shuts down does not block its goroutine
+// on a dead-letter channel nobody reads from.
+func TestServer_ShutdownDoesNotBlockOnDeadLetter(t *testing.T) {
+	srv := mem.NewServer(make(chan *msg.Message), 1,
+		mem.WithDeadLetter(make(chan *msg.Message)),
+	)
+
+	inflight := make(chan struct{})
+	release := make(chan struct{})
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		close(inflight)
+		<-release
+		return msg.Permanent(errors.New("cannot process message"))
+	}))
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("poison"),
+	}
+	<-inflight
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	// let Serve stop reading from the channel before the Receiver fails
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	if err := <-shutdown; err != msg.ErrServerClosed {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
+
+// TestServer_ServeDropsPermanentFailures asserts that the Server does not
+// redeliver a message when the Receiver returns a permanent error.
+func TestServer_ServeDropsPermanentFailures(t *testing.T) {
+	srv := mem.NewServer(make(chan *msg.Message, 1), 1)
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("poison"),
+	}
+
+	calls := make(chan struct{}, 10)
+	go func() {
+		srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			calls <- struct{}{}
+			return msg.Permanent(errors.New("cannot process message"))
+		}))
+	}()
+
+	<-calls
+
+	select {
+	case <-calls:
+		t.Fatal("expected message not to be redelivered")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := srv.Shutdown(context.Background()); err != msg.ErrServerClosed {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
+
+// TestServer_ServeHonorsRetryAfter asserts that the Server waits for the
+// delay carried by a RetryAfter error before redelivering a message.
+func TestServer_ServeHonorsRetryAfter(t *testing.T) {
+	delay := 200 * time.Millisecond
+
+	srv := mem.NewServer(make(chan *msg.Message, 1), 1)
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("retry me"),
+	}
+
+	calls := make(chan time.Time, 2)
+	attempts := 0
+	go func() {
+		srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			calls <- time.Now()
+			attempts++
+			if attempts == 1 {
+				return msg.RetryAfter(errors.New("try again later"), delay)
+			}
+			return nil
+		}))
+	}()
+
+	first := <-calls
+
+	select {
+	case second := <-calls:
+		if elapsed := second.Sub(first); elapsed < delay {
+			t.Errorf("expected redelivery after at least %v, got %v", delay, elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected message to be redelivered")
+	}
+
+	srv.Shutdown(context.Background())
+}
+
+// TestServer_ServeProvidesDeliveryInfo asserts that the Server attaches a
+// msg.DeliveryInfo to the context, and that it is updated on redelivery.
+func TestServer_ServeProvidesDeliveryInfo(t *testing.T) {
+	srv := mem.NewServer(make(chan *msg.Message, 1), 1)
+	srv.Name = "test-server"
+
+	topic := &mem.Topic{C: srv.C}
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello world!"))
+	w.Close()
+
+	infos := make(chan msg.DeliveryInfo, 2)
+	go func() {
+		srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			info, ok := msg.DeliveryInfoFromContext(ctx)
+			if !ok {
+				t.Error("expected DeliveryInfo in context")
+			}
+			infos <- info
+			if info.ReceiveCount == 1 {
+				return errors.New("try again")
+			}
+			return nil
+		}))
+	}()
+	defer srv.Shutdown(context.Background())
+
+	first, second := <-infos, <-infos
+
+	if first.MessageID == "" || first.MessageID != second.MessageID {
+		t.Errorf("expected a stable MessageID, got %q and %q", first.MessageID, second.MessageID)
+	}
+	if first.ReceiveCount != 1 || second.ReceiveCount != 2 {
+		t.Errorf("expected ReceiveCount 1 and 2, got %d and %d", first.ReceiveCount, second.ReceiveCount)
+	}
+	if first.PublishTime.IsZero() {
+		t.Error("expected PublishTime to be set")
+	}
+	if first.FirstReceived.IsZero() || !first.FirstReceived.Equal(second.FirstReceived) {
+		t.Errorf("expected a stable FirstReceived, got %v and %v", first.FirstReceived, second.FirstReceived)
+	}
+	if first.Source != "test-server" {
+		t.Errorf("expected Source to be test-server, got %q", first.Source)
+	}
+}
+
+// TestServer_ServeUsesTopicClockForPublishTime asserts that the
+// PublishTime of a Message is taken from the Clock of its Topic.
+func TestServer_ServeUsesTopicClockForPublishTime(t *testing.T) {
+	srv := mem.NewServer(make(chan *msg.Message, 1), 1)
+
+	published := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	topic := &mem.Topic{C: srv.C, Clock: mem.NewFakeClock(published)}
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte("hello world!"))
+	w.Close()
+
+	infos := make(chan msg.DeliveryInfo, 1)
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		infos <- info
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	if info := <-infos; !info.PublishTime.Equal(published) {
+		t.Errorf("expected PublishTime %v, got %v", published, info.PublishTime)
+	}
+}
+
+// TestServer_ServeRedeliversAfterVisibilityTimeout asserts that a message
+// whose Receiver does not return within the visibility timeout is
+// redelivered, with its own copy of the body.
+func TestServer_ServeRedeliversAfterVisibilityTimeout(t *testing.T) {
+	srv := mem.NewServer(make(chan *msg.Message, 1), 2, mem.WithVisibilityTimeout(100*time.Millisecond))
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("slow message"),
+	}
+
+	release := make(chan struct{})
+	bodies := make(chan string, 2)
+	go func() {
+		srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				t.Error(err)
+			}
+			bodies <- string(body)
+
+			info, _ := msg.DeliveryInfoFromContext(ctx)
+			if info.ReceiveCount == 1 {
+				<-release
+			}
+			return nil
+		}))
+	}()
+	defer srv.Shutdown(context.Background())
+	defer close(release)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case body := <-bodies:
+			if body != "slow message" {
+				t.Errorf("expected body %q, got %q", "slow message", body)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected message to be redelivered")
+		}
+	}
+}
+
+// TestServer_ServeBacksOffRedeliveries asserts that failed messages are
+// redelivered with exponential backoff.
+func TestServer_ServeBacksOffRedeliveries(t *testing.T) {
+	base := 50 * time.Millisecond
+
+	srv := mem.NewServer(make(chan *msg.Message, 1), 1, mem.WithRedeliveryBackoff(base, time.Second))
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("flaky message"),
+	}
+
+	calls := make(chan time.Time, 3)
+	go func() {
+		srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			calls <- time.Now()
+			return errors.New("try again")
+		}))
+	}()
+	defer srv.Shutdown(context.Background())
+
+	first, second, third := <-calls, <-calls, <-calls
+
+	if elapsed := second.Sub(first); elapsed < base {
+		t.Errorf("expected second delivery after at least %v, got %v", base, elapsed)
+	}
+	if elapsed := third.Sub(second); elapsed < 2*base {
+		t.Errorf("expected third delivery after at least %v, got %v", 2*base, elapsed)
+	}
+}
+
+// TestServer_ServeDeadLettersAfterMaxReceiveCount asserts that messages
+// which fail more than the max receive count are sent to the dead-letter
+// channel.
+func TestServer_ServeDeadLettersAfterMaxReceiveCount(t *testing.T) {
+	dlq := make(chan *msg.Message, 1)
+
+	srv := mem.NewServer(make(chan *msg.Message, 1), 1,
+		mem.WithMaxReceiveCount(3),
+		mem.WithDeadLetter(dlq),
+	)
+	srv.C <- &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("poison"),
+	}
+
+	var calls atomic.Int32
+	go func() {
+		srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			calls.Add(1)
+			return errors.New("cannot process message")
+		}))
+	}()
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case m := <-dlq:
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "poison" {
+			t.Errorf("expected body %q, got %q", "poison", string(body))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected message to be dead-lettered")
+	}
+
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 deliveries, got %d", n)
+	}
+}
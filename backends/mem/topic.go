@@ -2,16 +2,56 @@ package mem
 
 import (
 	"bytes"
+	"container/heap"
 	"context"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zerofox-oss/go-msg"
 )
 
+// messageIDs generates the IDs of Messages published by this package.
+var messageIDs atomic.Uint64
+
+// nextMessageID returns a new, unique Message ID.
+func nextMessageID() string {
+	return strconv.FormatUint(messageIDs.Add(1), 10)
+}
+
+// publishedBody is the Body of Messages published by a Topic. It carries
+// the ID and publish time of the Message to the Server which receives it.
+type publishedBody struct {
+	*bytes.Buffer
+
+	id   string
+	time time.Time
+}
+
+// published returns the ID and publish time of m. Messages which were sent
+// to a channel directly, rather than through a Topic, are assigned a new ID
+// and a zero publish time.
+func published(m *msg.Message) (string, time.Time) {
+	if b, ok := m.Body.(*publishedBody); ok {
+		return b.id, b.time
+	}
+	return nextMessageID(), time.Time{}
+}
+
 // Topic publishes Messages to a channel.
+//
+// Messages written with a delay are held by the Topic and sent to
+// the channel once the delay has elapsed.
 type Topic struct {
 	C chan *msg.Message
+
+	// Clock schedules delayed Messages. If nil, the system clock is used.
+	Clock Clock
+
+	mux     sync.Mutex
+	delayed delayQueue
+	timer   Timer
 }
 
 // Ensure that Topic implements msg.Topic
@@ -21,7 +61,7 @@ var _ msg.Topic = &Topic{}
 // The MessageWriter may be used to write messages to a channel.
 func (t *Topic) NewWriter(context.Context) msg.MessageWriter {
 	return &MessageWriter{
-		c: t.C,
+		publish: t.publish,
 
 		attributes: make(map[string][]string),
 		buf:        &bytes.Buffer{},
@@ -33,9 +73,11 @@ func (t *Topic) NewWriter(context.Context) msg.MessageWriter {
 type MessageWriter struct {
 	msg.MessageWriter
 
-	c chan *msg.Message
+	// publish sends a closed Message with its delay
+	publish func(*msg.Message, time.Duration)
 
 	attributes msg.Attributes
+	delay      time.Duration
 	buf        *bytes.Buffer // internal buffer
 	closed     bool
 	mux        sync.Mutex
@@ -46,7 +88,13 @@ func (w *MessageWriter) Attributes() *msg.Attributes {
 	return &w.attributes
 }
 
-func (w *MessageWriter) SetDelay(_ time.Duration) {}
+// SetDelay sets a duration to delay the delivery of the Message by.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
 
 // Close publishes a Message to a channel.
 // If the MessageWriter is already closed it will return an error.
@@ -64,7 +112,7 @@ func (w *MessageWriter) Close() error {
 			Attributes: w.attributes,
 			Body:       w.buf,
 		}
-		w.c <- msg
+		w.publish(msg, w.delay)
 	}
 
 	return nil
@@ -80,3 +128,100 @@ func (w *MessageWriter) Write(p []byte) (int, error) {
 	}
 	return w.buf.Write(p)
 }
+
+// clock returns the Clock used by the Topic.
+func (t *Topic) clock() Clock {
+	if t.Clock == nil {
+		return systemClock{}
+	}
+	return t.Clock
+}
+
+// publish sends m to the channel, or holds it until delay has elapsed.
+func (t *Topic) publish(m *msg.Message, delay time.Duration) {
+	// m was created by MessageWriter.Close, so its Body is always a buffer
+	m.Body = &publishedBody{
+		Buffer: m.Body.(*bytes.Buffer),
+		id:     nextMessageID(),
+		time:   t.clock().Now(),
+	}
+
+	if delay <= 0 {
+		t.C <- m
+		return
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	heap.Push(&t.delayed, &delayedMessage{
+		msg: m,
+		due: t.clock().Now().Add(delay),
+	})
+
+	// only re-arm the timer if m is now the next Message due
+	if t.delayed[0].msg == m {
+		t.schedule()
+	}
+}
+
+// schedule arms the timer for the next delayed Message.
+// It must be called with t.mux held.
+func (t *Topic) schedule() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if len(t.delayed) == 0 {
+		return
+	}
+
+	d := t.delayed[0].due.Sub(t.clock().Now())
+	t.timer = t.clock().AfterFunc(d, t.release)
+}
+
+// release sends all delayed Messages which are due to the channel.
+func (t *Topic) release() {
+	t.mux.Lock()
+
+	now := t.clock().Now()
+
+	var due []*msg.Message
+	for len(t.delayed) > 0 && !t.delayed[0].due.After(now) {
+		dm := heap.Pop(&t.delayed).(*delayedMessage)
+		due = append(due, dm.msg)
+	}
+	t.timer = nil
+	t.schedule()
+	t.mux.Unlock()
+
+	for _, m := range due {
+		t.C <- m
+	}
+}
+
+// delayedMessage is a Message held by a Topic until it is due.
+type delayedMessage struct {
+	msg *msg.Message
+	due time.Time
+}
+
+// delayQueue is a min-heap of delayed Messages ordered by when they are due.
+type delayQueue []*delayedMessage
+
+func (q delayQueue) Len() int           { return len(q) }
+func (q delayQueue) Less(i, j int) bool { return q[i].due.Before(q[j].due) }
+func (q delayQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *delayQueue) Push(x any) {
+	*q = append(*q, x.(*delayedMessage))
+}
+
+func (q *delayQueue) Pop() any {
+	old := *q
+	n := len(old)
+	dm := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return dm
+}
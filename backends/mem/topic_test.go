@@ -3,6 +3,7 @@ package mem_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/zerofox-oss/go-msg"
 	"github.com/zerofox-oss/go-msg/backends/mem"
@@ -109,3 +110,85 @@ func TestMesageWriter_CloseEmpty(t *testing.T) {
 		t.Errorf("got %d messages in channel, wanted 0", count)
 	}
 }
+
+// asserts MessageWriter holds delayed messages until they are due.
+func TestMessageWriter_SetDelay(t *testing.T) {
+	clock := mem.NewFakeClock(time.Now())
+	channel := make(chan *msg.Message, 3)
+	testTopic := &mem.Topic{
+		C:     channel,
+		Clock: clock,
+	}
+
+	publish := func(body string, delay time.Duration) {
+		w := testTopic.NewWriter(context.Background())
+		w.SetDelay(delay)
+		w.Write([]byte(body))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish("third", 3*time.Minute)
+	publish("first", time.Minute)
+	publish("now", 0)
+
+	expectBodies := func(expected ...string) {
+		t.Helper()
+
+		if len(channel) != len(expected) {
+			t.Fatalf("got %d messages in channel, wanted %d", len(channel), len(expected))
+		}
+		for _, e := range expected {
+			body, err := msg.DumpBody(<-channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != e {
+				t.Errorf("expected %s got %s", e, string(body))
+			}
+		}
+	}
+
+	expectBodies("now")
+
+	clock.Advance(59 * time.Second)
+	expectBodies()
+
+	clock.Advance(time.Second)
+	expectBodies("first")
+
+	// a message scheduled before the next due message is released first
+	publish("second", time.Minute)
+
+	clock.Advance(time.Minute)
+	expectBodies("second")
+
+	clock.Advance(time.Minute)
+	expectBodies("third")
+}
+
+// asserts delayed messages are released by the system clock when no
+// Clock is set.
+func TestMessageWriter_SetDelaySystemClock(t *testing.T) {
+	channel := make(chan *msg.Message, 1)
+	testTopic := &mem.Topic{
+		C: channel,
+	}
+
+	delay := 50 * time.Millisecond
+	start := time.Now()
+
+	w := testTopic.NewWriter(context.Background())
+	w.SetDelay(delay)
+	w.Write([]byte("delayed"))
+	w.Close()
+
+	select {
+	case <-channel:
+		if elapsed := time.Since(start); elapsed < delay {
+			t.Errorf("expected message after at least %v, got %v", delay, elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected delayed message to be released")
+	}
+}
@@ -0,0 +1,214 @@
+package mqtt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/zerofox-oss/go-msg"
+	msgmqtt "github.com/zerofox-oss/go-msg/backends/mqtt"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// broker is an in-process MQTT broker.
+type broker struct {
+	addr string
+
+	// acks receives the ID of a client whenever it acknowledges a
+	// Message.
+	acks chan string
+}
+
+// runBroker starts an in-process MQTT broker, which is closed when the
+// test completes.
+func runBroker(t *testing.T) *broker {
+	t.Helper()
+
+	b := &broker{acks: make(chan string, 100)}
+	srv := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := srv.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.AddHook(&ackHook{acks: b.acks}, nil); err != nil {
+		t.Fatal(err)
+	}
+	l := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := srv.AddListener(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	b.addr = l.Address()
+	return b
+}
+
+// acked reports whether the client id acknowledged a Message, waiting up
+// to d for it.
+func (b *broker) acked(id string, d time.Duration) bool {
+	timeout := time.After(d)
+	for {
+		select {
+		case acked := <-b.acks:
+			if acked == id {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// ackHook reports the clients which acknowledge Messages.
+type ackHook struct {
+	mochi.HookBase
+	acks chan string
+}
+
+func (h *ackHook) ID() string { return "acks" }
+
+func (h *ackHook) Provides(b byte) bool { return b == mochi.OnQosComplete }
+
+func (h *ackHook) OnQosComplete(cl *mochi.Client, _ packets.Packet) {
+	select {
+	case h.acks <- cl.ID:
+	default:
+	}
+}
+
+// connect returns a client connected to the broker at addr, with manual
+// acknowledgements and a session which outlives the connection. The
+// client is disconnected when the test completes. Any handlers are
+// called for every Message the client receives.
+func connect(t *testing.T, addr, id string, handlers ...func(paho.PublishReceived) (bool, error)) *paho.Client {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := paho.NewClient(paho.ClientConfig{
+		ClientID:                   id,
+		Conn:                       conn,
+		OnPublishReceived:          handlers,
+		EnableManualAcknowledgment: true,
+		SendAcksInterval:           10 * time.Millisecond,
+	})
+
+	expiry := uint32(60)
+	_, err = c.Connect(context.Background(), &paho.Connect{
+		ClientID:   id,
+		KeepAlive:  30,
+		CleanStart: false,
+		Properties: &paho.ConnectProperties{
+			SessionExpiryInterval: &expiry,
+			RequestProblemInfo:    true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Disconnect(&paho.Disconnect{}) })
+	return c
+}
+
+// subscribe makes the session of c subscribe to filter with qos, as a
+// worker's session would be from an earlier run, so that Messages
+// published before Serve is called are not lost.
+func subscribe(t *testing.T, c *paho.Client, filter string, qos byte) {
+	t.Helper()
+
+	_, err := c.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: filter, QoS: qos}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// subscriber connects a client which subscribes to filter with qos and
+// acknowledges every Message it receives right away. It returns the
+// Messages as they arrive.
+func subscriber(t *testing.T, addr, filter string, qos byte) <-chan *paho.Publish {
+	t.Helper()
+
+	received := make(chan *paho.Publish, 100)
+	c := connect(t, addr, "subscriber", func(p paho.PublishReceived) (bool, error) {
+		received <- p.Packet
+		return true, p.Client.Ack(p.Packet)
+	})
+	subscribe(t, c, filter, qos)
+	return received
+}
+
+// server returns a Server for filter with a client of its own, whose
+// session is already subscribed to filter.
+func server(t *testing.T, b *broker, filter string, cc int, opts ...msgmqtt.ServerOption) *msgmqtt.Server {
+	t.Helper()
+
+	c := connect(t, b.addr, "server")
+	srv := msgmqtt.NewServer(c, map[string]byte{filter: 1}, cc, opts...)
+	subscribe(t, c, filter, 1)
+	return srv
+}
+
+// message returns the Message published in p.
+func message(p *paho.Publish) *msg.Message {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewReader(p.Payload),
+	}
+	if p.Properties != nil {
+		for _, u := range p.Properties.User {
+			k := textproto.CanonicalMIMEHeaderKey(u.Key)
+			m.Attributes[k] = append(m.Attributes[k], u.Value)
+		}
+	}
+	return m
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		b := runBroker(t)
+		received := subscriber(t, b.addr, "messages", 1)
+
+		return msgtest.TopicFixture{
+			Topic: msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case p := <-received:
+					return message(p), nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		b := runBroker(t)
+
+		return msgtest.ServerFixture{
+			Server: server(t, b, "messages", 10,
+				msgmqtt.WithRetryBackoff(10*time.Millisecond, 100*time.Millisecond),
+			),
+			Topic: msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"),
+		}
+	})
+}
@@ -0,0 +1,368 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server subscribes to MQTT topic filters and delivers the Messages
+// published to them to a Receiver.
+//
+// Brokers only deliver unacknowledged Messages again when the client
+// reconnects, so the Server retries failed Messages itself, holding them
+// until they succeed, fail permanently or reach the max receive count.
+// Only then is the Message acknowledged. The client sends acknowledgements
+// in the order Messages arrived, so a Message which is being retried holds
+// back the acknowledgements of those which arrived after it.
+//
+// The Server handles the Messages of the client which match its topic
+// filters from the moment it is created, so that none are lost between
+// connecting with a persistent session and calling Serve. Messages which
+// arrive before Serve is called wait for it.
+type Server struct {
+	Client *paho.Client
+
+	// Filters maps the topic filters to subscribe to to the maximum
+	// quality of service to receive them with.
+	Filters map[string]byte
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	maxReceiveCount int
+	backoffBase     time.Duration
+	backoffMax      time.Duration
+
+	receiver      msg.Receiver
+	serving       chan struct{}
+	serveOnce     sync.Once
+	removeHandler func()
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithMaxReceiveCount sets the number of times a Message may be delivered
+// before it is acknowledged and dropped. A zero count, the default, means
+// Messages are retried until they succeed.
+func WithMaxReceiveCount(n int) ServerOption {
+	return func(s *Server) {
+		s.maxReceiveCount = n
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry of a failed
+// Message, which doubles with every retry up to max. The default is
+// 100ms, up to 5s. A delay requested by the Receiver via msg.RetryAfter
+// takes precedence.
+func WithRetryBackoff(base, max time.Duration) ServerOption {
+	return func(s *Server) {
+		s.backoffBase = base
+		s.backoffMax = max
+	}
+}
+
+// ErrServing is returned by Serve if the Server is already serving.
+var ErrServing = errors.New("mqtt: Server is already serving")
+
+// Serve subscribes to the topic filters of the Server, then delivers the
+// Messages published to them to r. It always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed. If Serve was
+// already called, it returns ErrServing.
+func (s *Server) Serve(r msg.Receiver) error {
+	serving := false
+	s.serveOnce.Do(func() {
+		serving = true
+		s.receiver = r
+		close(s.serving)
+	})
+	if !serving {
+		return ErrServing
+	}
+	defer s.removeHandler()
+
+	subscribe := &paho.Subscribe{}
+	for filter, qos := range s.Filters {
+		subscribe.Subscriptions = append(subscribe.Subscriptions, paho.SubscribeOptions{
+			Topic: filter,
+			QoS:   qos,
+		})
+	}
+	if _, err := s.Client.Subscribe(s.listenerCtx, subscribe); err != nil {
+		if s.listenerCtx.Err() != nil {
+			return msg.ErrServerClosed
+		}
+		return err
+	}
+
+	<-s.listenerCtx.Done()
+
+	unsubscribe := &paho.Unsubscribe{}
+	for filter := range s.Filters {
+		unsubscribe.Topics = append(unsubscribe.Topics, filter)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := s.Client.Unsubscribe(ctx, unsubscribe); err != nil {
+		log.Printf("could not unsubscribe %s", err)
+	}
+	return msg.ErrServerClosed
+}
+
+// route hands the Messages which match the topic filters of the Server
+// to handle.
+func (s *Server) route(p paho.PublishReceived) (bool, error) {
+	if p.AlreadyHandled || !s.matches(p.Packet.Topic) {
+		return false, nil
+	}
+
+	// handlers must not block, so that the client can keep routing
+	go s.handle(p.Packet)
+	return true, nil
+}
+
+// matches reports whether topic matches one of the topic filters of the
+// Server, so that Servers may share a client.
+func (s *Server) matches(topic string) bool {
+	for filter := range s.Filters {
+		if match(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether topic matches the topic filter, which may contain
+// the + and # wildcards, and may be a shared subscription.
+func match(filter, topic string) bool {
+	if rest, ok := strings.CutPrefix(filter, "$share/"); ok {
+		if _, filter, ok = strings.Cut(rest, "/"); !ok {
+			return false
+		}
+	}
+
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// handle waits for Serve and a free slot, and delivers p. Messages which
+// arrive after Shutdown are left unacknowledged.
+func (s *Server) handle(p *paho.Publish) {
+	// wait for Serve, then acquire "lock"
+	select {
+	case <-s.listenerCtx.Done():
+		return
+	case <-s.serving:
+	}
+	select {
+	case <-s.listenerCtx.Done():
+		return
+	case s.maxConcurrentReceives <- struct{}{}:
+	}
+	defer func() {
+		<-s.maxConcurrentReceives
+	}()
+
+	attrs, deliverAt := decode(p)
+	if err := s.sleep(time.Until(deliverAt)); err != nil {
+		return
+	}
+
+	if s.deliver(s.receiverCtx, s.receiver, attrs, p.Payload) {
+		if err := s.Client.Ack(p); err != nil {
+			log.Printf("could not acknowledge message %s", err)
+		}
+	}
+}
+
+// decode returns the attributes of p, and the time it is due.
+func decode(p *paho.Publish) (msg.Attributes, time.Time) {
+	attrs := msg.Attributes{}
+	if p.Properties == nil {
+		return attrs, time.Time{}
+	}
+
+	var deliverAt time.Time
+	for _, u := range p.Properties.User {
+		k := textproto.CanonicalMIMEHeaderKey(u.Key)
+		if k == propertyDeliverAt {
+			if ms, err := strconv.ParseInt(u.Value, 10, 64); err == nil {
+				deliverAt = time.UnixMilli(ms)
+			}
+			continue
+		}
+		attrs[k] = append(attrs[k], u.Value)
+	}
+	return attrs, deliverAt
+}
+
+// deliver delivers a Message to r until it succeeds, fails permanently
+// or reaches the max receive count. It returns false if the Server was
+// shut down before then.
+func (s *Server) deliver(ctx context.Context, r msg.Receiver, attrs msg.Attributes, body []byte) bool {
+	info := msg.DeliveryInfo{
+		FirstReceived: time.Now(),
+		Source:        s.Name,
+	}
+
+	for {
+		info.ReceiveCount++
+
+		// every attempt gets its own copy of the attributes, so that
+		// changes made by r do not leak into the next one
+		m := msg.WithBody(&msg.Message{Attributes: attrs}, bytes.NewReader(body))
+
+		err := r.Receive(msg.WithDeliveryInfo(ctx, info), m)
+		if err == nil {
+			return true
+		}
+		log.Printf("could not receive message %s", err)
+
+		if !msg.IsRetryable(err) || (s.maxReceiveCount > 0 && info.ReceiveCount >= s.maxReceiveCount) {
+			log.Printf("dropping message %s", err)
+			return true
+		}
+
+		delay, ok := msg.RetryDelay(err)
+		if !ok {
+			delay = s.backoff(info.ReceiveCount - 1)
+		}
+		if err := s.sleep(delay); err != nil {
+			return false
+		}
+	}
+}
+
+// backoff returns how long to wait before retry n, counting from zero.
+func (s *Server) backoff(n int) time.Duration {
+	delay := s.backoffBase
+	for i := 0; i < n; i++ {
+		delay *= 2
+		if s.backoffMax > 0 && delay >= s.backoffMax {
+			return s.backoffMax
+		}
+	}
+	return delay
+}
+
+// sleep waits for d, or until the Server is shut down.
+func (s *Server) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-s.listenerCtx.Done():
+		return msg.ErrServerClosed
+	}
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server unsubscribes from its topic
+// filters and then it waits for all of the active goroutines to complete.
+// Messages waiting for a retry or for their delay are left
+// unacknowledged, so the broker delivers them again when the client
+// reconnects with the same session.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which subscribes to
+// filters, a map of topic filters to the maximum quality of service to
+// receive them with. The client must be connected, and must have manual
+// acknowledgements enabled.
+func NewServer(client *paho.Client, filters map[string]byte, cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		Client:      client,
+		Filters:     filters,
+		Concurrency: cc,
+
+		backoffBase: 100 * time.Millisecond,
+		backoffMax:  5 * time.Second,
+
+		serving:               make(chan struct{}),
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	srv.removeHandler = client.AddOnPublishReceived(srv.route)
+	return srv
+}
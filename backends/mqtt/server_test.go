@@ -0,0 +1,220 @@
+package mqtt_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/zerofox-oss/go-msg"
+	msgmqtt "github.com/zerofox-oss/go-msg/backends/mqtt"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+func publish(t *testing.T, topic msg.Topic, body string, delay time.Duration) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("X-Request-Id", "1234")
+	w.SetDelay(delay)
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts srv in the background and shuts it down when the test
+// completes.
+func serve(t *testing.T, srv *msgmqtt.Server, r msg.ReceiverFunc) {
+	go srv.Serve(r)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+}
+
+// receive returns the next Message from received.
+func receive(t *testing.T, received <-chan *paho.Publish) *paho.Publish {
+	t.Helper()
+
+	select {
+	case p := <-received:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a message to be published")
+		return nil
+	}
+}
+
+// TestTopic_PublishesUserProperties asserts that the body of a Message is
+// published as the payload, and each value of its attributes as a user
+// property.
+func TestTopic_PublishesUserProperties(t *testing.T) {
+	b := runBroker(t)
+	received := subscriber(t, b.addr, "sensors/#", 2)
+
+	w := msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "sensors/1", msgmqtt.WithQoS(2)).NewWriter(context.Background())
+	(*w.Attributes())["Accept"] = []string{"text/plain", "application/json"}
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := receive(t, received)
+	if p.Topic != "sensors/1" {
+		t.Errorf("expected topic sensors/1, got %s", p.Topic)
+	}
+	if p.QoS != 2 {
+		t.Errorf("expected QoS 2, got %d", p.QoS)
+	}
+	if string(p.Payload) != "hello world" {
+		t.Errorf("expected payload %q, got %q", "hello world", p.Payload)
+	}
+	expected := []string{"text/plain", "application/json"}
+	if got := p.Properties.User.GetAll("Accept"); strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected user properties Accept %q, got %q", expected, got)
+	}
+}
+
+// TestServer_AcksAfterReceive asserts that a Message is only acknowledged
+// once the Receiver has processed it.
+func TestServer_AcksAfterReceive(t *testing.T) {
+	b := runBroker(t)
+
+	release := make(chan struct{})
+	srv := server(t, b, "messages", 1)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		<-release
+		msgtest.AssertAttribute(t, m, "X-Request-Id", "1234")
+		msgtest.AssertBody(t, m, "hello world")
+		return nil
+	})
+	publish(t, msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"), "hello world", 0)
+
+	if b.acked("server", 200*time.Millisecond) {
+		t.Fatal("expected the message not to be acknowledged during Receive")
+	}
+	close(release)
+	if !b.acked("server", time.Second) {
+		t.Fatal("expected the message to be acknowledged after Receive")
+	}
+}
+
+func TestServer_RetriesUntilMaxReceiveCount(t *testing.T) {
+	b := runBroker(t)
+
+	received := make(chan int, 3)
+	srv := server(t, b, "messages", 1,
+		msgmqtt.WithMaxReceiveCount(3),
+		msgmqtt.WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		received <- info.ReceiveCount
+		return errors.New("try again")
+	})
+	publish(t, msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"), "hello world", 0)
+
+	for want := 1; want <= 3; want++ {
+		if got := <-received; got != want {
+			t.Errorf("expected ReceiveCount %d, got %d", want, got)
+		}
+	}
+	if !b.acked("server", time.Second) {
+		t.Error("expected the message to be acknowledged once dropped")
+	}
+}
+
+// TestServer_RetryClonesAttributes asserts that changes made to the
+// attributes of a failed attempt are not seen by the next one.
+func TestServer_RetryClonesAttributes(t *testing.T) {
+	b := runBroker(t)
+
+	received := make(chan string, 2)
+	srv := server(t, b, "messages", 1,
+		msgmqtt.WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		received <- m.Attributes.Get("X-Request-Id")
+		if info, _ := msg.DeliveryInfoFromContext(ctx); info.ReceiveCount == 1 {
+			m.Attributes.Set("X-Request-Id", "changed")
+			return errors.New("try again")
+		}
+		return nil
+	})
+	publish(t, msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"), "hello world", 0)
+
+	for i := 0; i < 2; i++ {
+		if got := <-received; got != "1234" {
+			t.Errorf("expected X-Request-Id 1234 on attempt %d, got %q", i+1, got)
+		}
+	}
+}
+
+// TestServer_LeavesUnackedOnShutdown asserts that a Message waiting for a
+// retry is not acknowledged, so that the broker delivers it again.
+func TestServer_LeavesUnackedOnShutdown(t *testing.T) {
+	b := runBroker(t)
+
+	received := make(chan struct{}, 1)
+	srv := server(t, b, "messages", 1)
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- struct{}{}
+		return msg.RetryAfter(errors.New("busy"), time.Hour)
+	}))
+	publish(t, msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"), "hello world", 0)
+
+	<-received
+	if err := srv.Shutdown(context.Background()); err != msg.ErrServerClosed {
+		t.Fatalf("expected ErrServerClosed, got %v", err)
+	}
+	if b.acked("server", 200*time.Millisecond) {
+		t.Error("expected the message not to be acknowledged")
+	}
+}
+
+func TestServer_DeliversRawPayloads(t *testing.T) {
+	b := runBroker(t)
+
+	received := make(chan *msg.Message, 1)
+	serve(t, server(t, b, "sensors/+", 1), func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	})
+
+	_, err := connect(t, b.addr, "device").Publish(context.Background(), &paho.Publish{
+		Topic:   "sensors/1",
+		QoS:     1,
+		Payload: []byte(`{"temperature":21.5}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := <-received
+	msgtest.AssertBody(t, m, `{"temperature":21.5}`)
+	if len(m.Attributes) != 0 {
+		t.Errorf("expected no attributes, got %v", m.Attributes)
+	}
+}
+
+func TestServer_HonorsDelay(t *testing.T) {
+	b := runBroker(t)
+
+	received := make(chan *msg.Message, 1)
+	serve(t, server(t, b, "messages", 1), func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	})
+
+	start := time.Now()
+	publish(t, msgmqtt.NewTopic(connect(t, b.addr, "publisher"), "messages"), "hello world", 300*time.Millisecond)
+
+	// the due time is stored with millisecond precision
+	m := <-received
+	if d := time.Since(start); d < 299*time.Millisecond {
+		t.Errorf("expected the message to be delayed by at least 300ms, got %s", d)
+	}
+	if got := m.Attributes.Get("Msg-Deliver-At"); got != "" {
+		t.Errorf("expected the delay property to be removed, got %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+// Package mqtt provides a backend which exchanges Messages through an MQTT
+// broker.
+//
+// A Topic publishes every Message to an MQTT topic, and a Server subscribes
+// to topic filters and delivers the Messages published to them. The client
+// speaks MQTT 5: the body of a Message is the payload as it is, and its
+// attributes are user properties, one for every value. Messages published
+// by other clients are delivered with whatever user properties they carry.
+//
+// A Server acknowledges a QoS 1 or 2 Message only once it has been
+// processed, so the broker delivers it again if the Server stops before
+// then. This requires the client to be created with manual
+// acknowledgements, and a session which outlives the connection. Some
+// brokers strip user properties unless problem information is requested:
+//
+//	client := paho.NewClient(paho.ClientConfig{
+//		ClientID:                   "worker",
+//		Conn:                       conn,
+//		EnableManualAcknowledgment: true,
+//	})
+//	expiry := uint32(3600)
+//	client.Connect(ctx, &paho.Connect{
+//		ClientID:   "worker",
+//		KeepAlive:  30,
+//		CleanStart: false,
+//		Properties: &paho.ConnectProperties{
+//			SessionExpiryInterval: &expiry,
+//			RequestProblemInfo:    true,
+//		},
+//	})
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// propertyDeliverAt holds the time, in unix milliseconds, before which a
+// delayed Message must not be delivered. It is removed from the attributes
+// of received Messages.
+const propertyDeliverAt = "Msg-Deliver-At"
+
+// Topic publishes Messages to an MQTT topic.
+type Topic struct {
+	Client *paho.Client
+	Topic  string
+
+	qos      byte
+	retained bool
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// TopicOption is a functional option for the Topic.
+type TopicOption func(*Topic)
+
+// WithQoS sets the quality of service Messages are published with:
+// 0 (at most once), 1 (at least once) or 2 (exactly once).
+// The default is 1.
+func WithQoS(qos byte) TopicOption {
+	return func(t *Topic) {
+		t.qos = qos
+	}
+}
+
+// WithRetained makes the broker retain the last Message published to the
+// topic, and deliver it to new subscribers.
+func WithRetained(retained bool) TopicOption {
+	return func(t *Topic) {
+		t.retained = retained
+	}
+}
+
+// NewTopic returns a Topic which publishes Messages to topic.
+// The client must be connected.
+func NewTopic(client *paho.Client, topic string, opts ...TopicOption) *Topic {
+	t := &Topic{
+		Client: client,
+		Topic:  topic,
+		qos:    1,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to publish a single Message.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to publish a single Message to an MQTT topic.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// MQTT has no delayed delivery, so the Message is published immediately
+// and the Server holds it until it is due.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close publishes the Message. For QoS 1 and 2, it waits for the broker
+// to acknowledge it, or for the context of the MessageWriter to be done.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	props := &paho.PublishProperties{}
+	for k, vv := range w.attributes {
+		for _, v := range vv {
+			props.User.Add(k, v)
+		}
+	}
+	if w.delay > 0 {
+		deliverAt := time.Now().Add(w.delay).UnixMilli()
+		props.User.Add(propertyDeliverAt, strconv.FormatInt(deliverAt, 10))
+	}
+
+	_, err := w.topic.Client.Publish(w.ctx, &paho.Publish{
+		Topic:      w.topic.Topic,
+		QoS:        w.topic.qos,
+		Retain:     w.topic.retained,
+		Payload:    w.buf.Bytes(),
+		Properties: props,
+	})
+	return err
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,131 @@
+package nats_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zerofox-oss/go-msg"
+	msgnats "github.com/zerofox-oss/go-msg/backends/nats"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// runServer starts an in-process NATS server with JetStream enabled, which
+// is shut down when the test completes. The returned options restart it
+// on the same port and storage.
+func runServer(t *testing.T) (*server.Server, *server.Options) {
+	t.Helper()
+
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	ns := natstest.RunServer(&opts)
+	t.Cleanup(ns.Shutdown)
+
+	opts.Port = ns.Addr().(*net.TCPAddr).Port
+	return ns, &opts
+}
+
+// jetStream connects to ns and creates the "messages" stream, which
+// captures the "messages" subject. The connection is closed when the test
+// completes.
+func jetStream(t *testing.T, ns *server.Server) (jetstream.JetStream, jetstream.Stream) {
+	t.Helper()
+
+	nc, err := nats.Connect(ns.ClientURL(),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "messages",
+		Subjects: []string{"messages"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js, stream
+}
+
+// consumer creates a durable pull consumer of stream with explicit
+// acknowledgements.
+func consumer(t *testing.T, stream jetstream.Stream) jetstream.Consumer {
+	t.Helper()
+
+	c, err := stream.CreateOrUpdateConsumer(context.Background(), jetstream.ConsumerConfig{
+		Durable:   "consumer",
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// published returns the Message stored in stream with sequence seq,
+// waiting for it until ctx is done.
+func published(ctx context.Context, stream jetstream.Stream, seq uint64) (*jetstream.RawStreamMsg, error) {
+	for {
+		m, err := stream.GetMsg(ctx, seq)
+		if err == nil {
+			return m, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		ns, _ := runServer(t)
+		js, stream := jetStream(t, ns)
+		var seq uint64
+
+		return msgtest.TopicFixture{
+			Topic: msgnats.NewTopic(js, "messages"),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				seq++
+				m, err := published(ctx, stream, seq)
+				if err != nil {
+					return nil, err
+				}
+				message := msgtest.NewMessage(string(m.Data))
+				for k, vv := range m.Header {
+					message.Attributes[k] = vv
+				}
+				return message, nil
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		ns, _ := runServer(t)
+		js, stream := jetStream(t, ns)
+
+		return msgtest.ServerFixture{
+			Server: msgnats.NewServer(consumer(t, stream), 10, msgnats.WithMaxWait(100*time.Millisecond)),
+			Topic:  msgnats.NewTopic(js, "messages"),
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server reads Messages from a JetStream pull consumer.
+//
+// Messages are acknowledged once Receive returns nil, and terminated if it
+// returns a permanent error. Other failed Messages are negatively
+// acknowledged, with the delay requested via msg.RetryAfter if there is
+// one, and JetStream delivers them again until the MaxDeliver of the
+// consumer is reached.
+type Server struct {
+	Consumer jetstream.Consumer
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	maxWait time.Duration
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithMaxWait sets how long a single pull request waits for Messages.
+// Shutdown waits up to this long for the pending request to expire.
+// The default is 1s.
+func WithMaxWait(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.maxWait = d
+	}
+}
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed. Errors fetching
+// Messages are logged, and Serve keeps fetching until it is shut down.
+func (s *Server) Serve(r msg.Receiver) error {
+	for {
+		n, ok := s.acquire()
+		if !ok {
+			return msg.ErrServerClosed
+		}
+
+		batch, err := s.Consumer.Fetch(n, jetstream.FetchMaxWait(s.maxWait))
+		if err != nil {
+			s.release(n)
+			if s.listenerCtx.Err() != nil {
+				return msg.ErrServerClosed
+			}
+			log.Printf("could not fetch messages %s", err)
+
+			// wait before fetching again, rather than failing in a loop
+			// while the server is unreachable
+			if !s.sleep(s.maxWait) {
+				return msg.ErrServerClosed
+			}
+			continue
+		}
+
+		fetched := 0
+		for m := range batch.Messages() {
+			fetched++
+			go func(ctx context.Context, m jetstream.Msg) {
+				defer func() {
+					<-s.maxConcurrentReceives
+				}()
+
+				s.deliver(ctx, r, m)
+			}(s.receiverCtx, m)
+		}
+		s.release(n - fetched)
+
+		err = batch.Error()
+		if err != nil && !errors.Is(err, jetstream.ErrConsumerLeadershipChanged) && s.listenerCtx.Err() == nil {
+			log.Printf("could not fetch messages %s", err)
+		}
+	}
+}
+
+// sleep waits for d. It returns false if the Server was shut down in the
+// meantime.
+func (s *Server) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.listenerCtx.Done():
+		return false
+	}
+}
+
+// acquire blocks until at least one slot is free, then acquires as many
+// free slots as are available without blocking. It returns false if the
+// Server was shut down.
+func (s *Server) acquire() (int, bool) {
+	select {
+	case <-s.listenerCtx.Done():
+		return 0, false
+	case s.maxConcurrentReceives <- struct{}{}:
+	}
+
+	n := 1
+	for n < cap(s.maxConcurrentReceives) {
+		select {
+		case s.maxConcurrentReceives <- struct{}{}:
+			n++
+		default:
+			return n, true
+		}
+	}
+	return n, true
+}
+
+// release frees n slots.
+func (s *Server) release(n int) {
+	for i := 0; i < n; i++ {
+		<-s.maxConcurrentReceives
+	}
+}
+
+// deliver delivers m to r and settles its outcome.
+func (s *Server) deliver(ctx context.Context, r msg.Receiver, m jetstream.Msg) {
+	// Messages fetched while shutting down are handed back right away
+	if s.listenerCtx.Err() != nil {
+		s.settle(m.Nak())
+		return
+	}
+
+	message, deliverAt := decode(m)
+	if wait := time.Until(deliverAt); wait > 0 {
+		s.settle(m.NakWithDelay(wait))
+		return
+	}
+
+	info := msg.DeliveryInfo{Source: s.Name}
+	if meta, err := m.Metadata(); err == nil {
+		info.MessageID = meta.Stream + "." + strconv.FormatUint(meta.Sequence.Stream, 10)
+		info.ReceiveCount = int(meta.NumDelivered)
+		info.PublishTime = meta.Timestamp
+		if meta.NumDelivered == 1 {
+			info.FirstReceived = time.Now()
+		}
+	}
+
+	err := r.Receive(msg.WithDeliveryInfo(ctx, info), message)
+	if err == nil {
+		s.settle(m.Ack())
+		return
+	}
+	log.Printf("could not receive message %s", err)
+
+	if !msg.IsRetryable(err) {
+		log.Printf("dropping message %s", err)
+		s.settle(m.Term())
+		return
+	}
+
+	if delay, ok := msg.RetryDelay(err); ok {
+		s.settle(m.NakWithDelay(delay))
+		return
+	}
+	s.settle(m.Nak())
+}
+
+// settle logs the failure to acknowledge a Message. JetStream delivers it
+// again once the AckWait of the consumer has passed.
+func (s *Server) settle(err error) {
+	if err != nil {
+		log.Printf("could not acknowledge message %s", err)
+	}
+}
+
+// decode converts m to a Message and the time it is due.
+func decode(m jetstream.Msg) (*msg.Message, time.Time) {
+	message := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewReader(m.Data()),
+	}
+
+	var deliverAt time.Time
+	for k, vv := range m.Headers() {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		if k == headerDeliverAt {
+			if len(vv) > 0 {
+				if ms, err := strconv.ParseInt(vv[0], 10, 64); err == nil {
+					deliverAt = time.UnixMilli(ms)
+				}
+			}
+			continue
+		}
+		message.Attributes[k] = append(message.Attributes[k], vv...)
+	}
+	return message, deliverAt
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops fetching new Messages
+// and then it waits for all of the active goroutines to complete.
+// Messages fetched by the pending pull request are negatively
+// acknowledged without being delivered.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned. Messages which were not acknowledged are delivered again
+// once the AckWait of the consumer has passed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which reads Messages
+// from consumer. The consumer should use explicit acknowledgements.
+func NewServer(consumer jetstream.Consumer, cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		Consumer:    consumer,
+		Concurrency: cc,
+
+		maxWait: time.Second,
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
@@ -0,0 +1,198 @@
+package nats_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/zerofox-oss/go-msg"
+	msgnats "github.com/zerofox-oss/go-msg/backends/nats"
+)
+
+func publish(t *testing.T, topic msg.Topic, body string, delay time.Duration) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("X-Request-Id", "1234")
+	w.SetDelay(delay)
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts srv in the background and shuts it down when the test
+// completes.
+func serve(t *testing.T, srv *msgnats.Server, r msg.ReceiverFunc) {
+	go srv.Serve(r)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+}
+
+func TestTopic_PublishesAttributesAsHeaders(t *testing.T) {
+	ns, _ := runServer(t)
+	js, stream := jetStream(t, ns)
+	publish(t, msgnats.NewTopic(js, "messages"), "hello world", 0)
+
+	m, err := stream.GetMsg(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "messages" {
+		t.Errorf("expected subject messages, got %s", m.Subject)
+	}
+	if got := m.Header.Get("X-Request-Id"); got != "1234" {
+		t.Errorf("expected header X-Request-Id to be 1234, got %q", got)
+	}
+	if got := string(m.Data); got != "hello world" {
+		t.Errorf("expected data %q, got %q", "hello world", got)
+	}
+}
+
+func TestServer_ProvidesDeliveryInfo(t *testing.T) {
+	ns, _ := runServer(t)
+	js, stream := jetStream(t, ns)
+	publish(t, msgnats.NewTopic(js, "messages"), "hello world", 0)
+
+	infos := make(chan msg.DeliveryInfo, 2)
+	srv := msgnats.NewServer(consumer(t, stream), 1, msgnats.WithMaxWait(100*time.Millisecond))
+	srv.Name = "nats"
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		infos <- info
+		if info.ReceiveCount == 1 {
+			return errors.New("try again")
+		}
+		return nil
+	})
+
+	first, second := <-infos, <-infos
+	if first.MessageID != "messages.1" {
+		t.Errorf("expected MessageID messages.1, got %s", first.MessageID)
+	}
+	if first.Source != "nats" {
+		t.Errorf("expected Source nats, got %s", first.Source)
+	}
+	if first.PublishTime.IsZero() || first.FirstReceived.IsZero() {
+		t.Error("expected PublishTime and FirstReceived to be set")
+	}
+	if second.ReceiveCount != 2 {
+		t.Errorf("expected ReceiveCount 2, got %d", second.ReceiveCount)
+	}
+}
+
+func TestServer_TerminatesPermanentFailures(t *testing.T) {
+	ns, _ := runServer(t)
+	js, stream := jetStream(t, ns)
+	publish(t, msgnats.NewTopic(js, "messages"), "hello world", 0)
+
+	received := make(chan struct{}, 2)
+	serve(t, msgnats.NewServer(consumer(t, stream), 1, msgnats.WithMaxWait(100*time.Millisecond)), func(ctx context.Context, m *msg.Message) error {
+		received <- struct{}{}
+		return msg.Permanent(errors.New("malformed"))
+	})
+
+	<-received
+	select {
+	case <-received:
+		t.Fatal("expected the message not to be delivered again")
+	case <-time.After(200 * time.Millisecond):
+	}
+	info, err := consumer(t, stream).Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.NumAckPending != 0 || info.NumPending != 0 {
+		t.Errorf("expected no pending messages, got %d unacknowledged and %d undelivered", info.NumAckPending, info.NumPending)
+	}
+}
+
+func TestServer_HonorsRetryAfter(t *testing.T) {
+	ns, _ := runServer(t)
+	js, stream := jetStream(t, ns)
+	publish(t, msgnats.NewTopic(js, "messages"), "hello world", 0)
+
+	received := make(chan time.Time, 2)
+	serve(t, msgnats.NewServer(consumer(t, stream), 1, msgnats.WithMaxWait(100*time.Millisecond)), func(ctx context.Context, m *msg.Message) error {
+		received <- time.Now()
+		if info, _ := msg.DeliveryInfoFromContext(ctx); info.ReceiveCount == 1 {
+			return msg.RetryAfter(errors.New("busy"), 300*time.Millisecond)
+		}
+		return nil
+	})
+
+	first, second := <-received, <-received
+	if d := second.Sub(first); d < 300*time.Millisecond {
+		t.Errorf("expected a retry after at least 300ms, got %s", d)
+	}
+}
+
+func TestServer_HonorsDelay(t *testing.T) {
+	ns, _ := runServer(t)
+	js, stream := jetStream(t, ns)
+	start := time.Now()
+	publish(t, msgnats.NewTopic(js, "messages"), "hello world", 300*time.Millisecond)
+
+	received := make(chan *msg.Message, 1)
+	serve(t, msgnats.NewServer(consumer(t, stream), 1, msgnats.WithMaxWait(100*time.Millisecond)), func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	})
+
+	// the due time is stored with millisecond precision
+	m := <-received
+	if d := time.Since(start); d < 299*time.Millisecond {
+		t.Errorf("expected the message to be delayed by at least 300ms, got %s", d)
+	}
+	if got := m.Attributes.Get("Msg-Deliver-At"); got != "" {
+		t.Errorf("expected the delay header to be removed, got %q", got)
+	}
+	if got := m.Attributes.Get("X-Request-Id"); got != "1234" {
+		t.Errorf("expected attribute X-Request-Id to be 1234, got %q", got)
+	}
+}
+
+// TestServer_SurvivesServerRestart asserts that Serve keeps fetching
+// while the NATS server is unavailable, and delivers Messages once it is
+// back.
+func TestServer_SurvivesServerRestart(t *testing.T) {
+	ns, opts := runServer(t)
+	js, stream := jetStream(t, ns)
+
+	received := make(chan string, 1)
+	srv := msgnats.NewServer(consumer(t, stream), 1, msgnats.WithMaxWait(100*time.Millisecond))
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, _ := msg.DumpBody(m)
+			received <- string(body)
+			return nil
+		}))
+	}()
+
+	ns.Shutdown()
+	select {
+	case err := <-served:
+		t.Fatalf("expected Serve to keep running, got %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	ns = natstest.RunServer(opts)
+	t.Cleanup(ns.Shutdown)
+	publish(t, msgnats.NewTopic(js, "messages"), "hello world", 0)
+
+	select {
+	case body := <-received:
+		if body != "hello world" {
+			t.Errorf("expected body %q, got %q", "hello world", body)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the message to be delivered after the restart")
+	}
+
+	srv.Shutdown(context.Background())
+	if err := <-served; !errors.Is(err, msg.ErrServerClosed) {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
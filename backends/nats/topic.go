@@ -0,0 +1,132 @@
+// Package nats provides a backend which uses NATS JetStream as a durable
+// queue.
+//
+// A Topic publishes every Message to a subject, with its attributes as
+// NATS headers. A Server reads Messages from a JetStream pull consumer and
+// acknowledges them once they have been processed. Failed Messages are
+// negatively acknowledged, so that JetStream delivers them again, after
+// the delay requested with msg.RetryAfter if there is one.
+package nats
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// headerDeliverAt holds the time, in unix milliseconds, before which a
+// delayed Message must not be delivered. It is removed from the attributes
+// of received Messages.
+const headerDeliverAt = "Msg-Deliver-At"
+
+// Topic publishes Messages to a JetStream subject.
+type Topic struct {
+	JetStream jetstream.JetStream
+	Subject   string
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// NewTopic returns a Topic which publishes Messages to subject. A stream
+// must capture the subject, or publishing fails.
+func NewTopic(js jetstream.JetStream, subject string) *Topic {
+	return &Topic{
+		JetStream: js,
+		Subject:   subject,
+	}
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to publish a single Message.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to publish a single Message to JetStream.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// JetStream has no delayed publishing, so the Message is stored
+// immediately and the Server negatively acknowledges it with a delay
+// until it is due. Those deliveries count towards the MaxDeliver of the
+// consumer.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close publishes the Message and waits for JetStream to acknowledge that
+// it was stored.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	header := make(nats.Header, len(w.attributes)+1)
+	for k, vv := range w.attributes {
+		header[k] = append([]string(nil), vv...)
+	}
+	if w.delay > 0 {
+		deliverAt := time.Now().Add(w.delay).UnixMilli()
+		header.Set(headerDeliverAt, strconv.FormatInt(deliverAt, 10))
+	}
+
+	_, err := w.topic.JetStream.PublishMsg(w.ctx, &nats.Msg{
+		Subject: w.topic.Subject,
+		Header:  header,
+		Data:    w.buf.Bytes(),
+	})
+	return err
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
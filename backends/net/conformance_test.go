@@ -0,0 +1,82 @@
+package net_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+	msgnet "github.com/zerofox-oss/go-msg/backends/net"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// listen returns a Server listening on a local TCP port and a Topic
+// connected to it, which are closed when the test completes.
+func listen(t *testing.T, opts ...msgnet.TopicOption) (*msgnet.Server, *msgnet.Topic) {
+	t.Helper()
+
+	srv, err := msgnet.Listen("tcp", "127.0.0.1:0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Listener.Close() })
+
+	topic := msgnet.NewTopic("tcp", srv.Listener.Addr().String(), opts...)
+	t.Cleanup(func() { topic.Close() })
+
+	return srv, topic
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		srv, topic := listen(t)
+
+		c := make(chan *msg.Message, 100)
+		go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			c <- msg.WithBody(m, bytes.NewReader(body))
+			return nil
+		}))
+		t.Cleanup(func() { srv.Shutdown(context.Background()) })
+
+		return msgtest.TopicFixture{
+			Topic: topic,
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				select {
+				case m := <-c:
+					return m, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			},
+		}
+	})
+}
+
+// asyncWriter sends its Message in the background, since the suite
+// publishes Messages before it starts the Server, and Close waits for
+// the Message to be acknowledged.
+type asyncWriter struct {
+	msg.MessageWriter
+}
+
+func (w asyncWriter) Close() error {
+	go w.MessageWriter.Close()
+	return nil
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		srv, topic := listen(t)
+
+		return msgtest.ServerFixture{
+			Server: srv,
+			Topic: msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+				return asyncWriter{topic.NewWriter(ctx)}
+			}),
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package net
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Frames are exchanged over a connection in both directions. Every frame
+// starts with a fixed header, followed by a payload which depends on its
+// type. Integers are big-endian; strings are prefixed with their length
+// as an unsigned varint.
+//
+//	length  uint32 // length of the rest of the frame
+//	type    uint8
+//	id      uint64 // identifies the Message within the connection
+//	payload []byte
+//
+// A message frame is sent by the Topic:
+//
+//	delay      int64  // nanoseconds to wait before delivery
+//	count      uvarint
+//	attributes [count]{key string; n uvarint; values [n]string}
+//	body       []byte // the rest of the frame
+//
+// The Server answers every message frame with an ack frame, which has no
+// payload, once the Receiver processed it, or a nack frame if it failed:
+//
+//	flags      uint8 // flagPermanent
+//	retryAfter int64 // nanoseconds requested by the Receiver, or zero
+//	reason     []byte // the rest of the frame
+const headerSize = 4 + 1 + 8
+
+const (
+	frameMessage byte = 1
+	frameAck     byte = 2
+	frameNack    byte = 3
+)
+
+// flagPermanent marks a nack for a Message which must not be retried.
+const flagPermanent byte = 1
+
+// maxFrameSize is the largest frame accepted from a peer.
+const maxFrameSize = 64 << 20
+
+// errFrameTooLarge is returned when a peer announces a frame larger
+// than maxFrameSize.
+var errFrameTooLarge = errors.New("net: frame too large")
+
+// frame is a decoded frame.
+type frame struct {
+	typ byte
+	id  uint64
+
+	// message frames
+	attributes msg.Attributes
+	body       []byte
+	delay      time.Duration
+
+	// nack frames
+	permanent  bool
+	retryAfter time.Duration
+	reason     string
+}
+
+// encode returns the wire encoding of f.
+func (f *frame) encode() []byte {
+	b := make([]byte, headerSize, headerSize+64+len(f.body))
+	b[4] = f.typ
+	binary.BigEndian.PutUint64(b[5:13], f.id)
+
+	switch f.typ {
+	case frameMessage:
+		b = binary.BigEndian.AppendUint64(b, uint64(f.delay))
+		b = binary.AppendUvarint(b, uint64(len(f.attributes)))
+		for k, vv := range f.attributes {
+			b = appendString(b, k)
+			b = binary.AppendUvarint(b, uint64(len(vv)))
+			for _, v := range vv {
+				b = appendString(b, v)
+			}
+		}
+		b = append(b, f.body...)
+	case frameNack:
+		var flags byte
+		if f.permanent {
+			flags |= flagPermanent
+		}
+		b = append(b, flags)
+		b = binary.BigEndian.AppendUint64(b, uint64(f.retryAfter))
+		b = append(b, f.reason...)
+	}
+
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(b)-4))
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readFrame reads a single frame from r.
+func readFrame(r *bufio.Reader) (*frame, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+	if n < headerSize-4 {
+		return nil, fmt.Errorf("net: short frame of %d bytes", n)
+	}
+
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	f := &frame{
+		typ: p[0],
+		id:  binary.BigEndian.Uint64(p[1:9]),
+	}
+	p = p[9:]
+
+	switch f.typ {
+	case frameMessage:
+		return f, f.decodeMessage(p)
+	case frameAck:
+		return f, nil
+	case frameNack:
+		if len(p) < 9 {
+			return nil, errCorruptFrame
+		}
+		f.permanent = p[0]&flagPermanent != 0
+		f.retryAfter = time.Duration(binary.BigEndian.Uint64(p[1:9]))
+		f.reason = string(p[9:])
+		return f, nil
+	default:
+		return nil, fmt.Errorf("net: unknown frame type %d", f.typ)
+	}
+}
+
+// errCorruptFrame is returned when the payload of a frame is malformed.
+var errCorruptFrame = errors.New("net: corrupt frame")
+
+func (f *frame) decodeMessage(p []byte) error {
+	if len(p) < 8 {
+		return errCorruptFrame
+	}
+	f.delay = time.Duration(binary.BigEndian.Uint64(p[0:8]))
+	p = p[8:]
+
+	// every key and value takes at least one byte, which bounds the
+	// allocations made for untrusted counts
+	n, p, err := readUvarint(p)
+	if err != nil {
+		return err
+	}
+	if n > uint64(len(p)) {
+		return errCorruptFrame
+	}
+	f.attributes = make(msg.Attributes, n)
+	for i := uint64(0); i < n; i++ {
+		var k string
+		if k, p, err = readString(p); err != nil {
+			return err
+		}
+		var nv uint64
+		if nv, p, err = readUvarint(p); err != nil {
+			return err
+		}
+		if nv > uint64(len(p)) {
+			return errCorruptFrame
+		}
+		vv := make([]string, 0, nv)
+		for j := uint64(0); j < nv; j++ {
+			var v string
+			if v, p, err = readString(p); err != nil {
+				return err
+			}
+			vv = append(vv, v)
+		}
+		f.attributes[k] = vv
+	}
+	f.body = p
+
+	return nil
+}
+
+func readUvarint(p []byte) (uint64, []byte, error) {
+	v, n := binary.Uvarint(p)
+	if n <= 0 {
+		return 0, nil, errCorruptFrame
+	}
+	return v, p[n:], nil
+}
+
+func readString(p []byte) (string, []byte, error) {
+	n, p, err := readUvarint(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(p)) < n {
+		return "", nil, errCorruptFrame
+	}
+	return string(p[:n]), p[n:], nil
+}
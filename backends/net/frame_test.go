@@ -0,0 +1,63 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+func TestFrame_RoundTrip(t *testing.T) {
+	frames := []*frame{
+		{
+			typ:        frameMessage,
+			id:         1,
+			attributes: msg.Attributes{"Content-Type": {"text/plain"}, "X-Multi": {"a", "b"}},
+			body:       []byte("hello world"),
+			delay:      time.Second,
+		},
+		{typ: frameAck, id: 1},
+		{typ: frameNack, id: 2, permanent: true, retryAfter: time.Minute, reason: "bad message"},
+	}
+
+	var buf bytes.Buffer
+	for _, f := range frames {
+		buf.Write(f.encode())
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, want := range frames {
+		got, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.typ == frameMessage && len(got.body) == 0 {
+			got.body = nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+}
+
+func TestFrame_RejectsCorruptFrames(t *testing.T) {
+	f := (&frame{
+		typ:        frameMessage,
+		attributes: msg.Attributes{"Key": {"value"}},
+		body:       []byte("hello"),
+	}).encode()
+
+	// claim more attributes than the frame can hold
+	f[headerSize+8] = 0x7f
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(f))); err == nil {
+		t.Error("expected an error for a corrupt frame")
+	}
+
+	huge := []byte{0xff, 0xff, 0xff, 0xff}
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(huge))); err != errFrameTooLarge {
+		t.Errorf("expected %v, got %v", errFrameTooLarge, err)
+	}
+}
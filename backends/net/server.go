@@ -0,0 +1,310 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server accepts connections from Topics and delivers the Messages they
+// send to a Receiver. Every Message is answered with an ack if Receive
+// returns nil, or a nack carrying the error otherwise; retrying failed
+// Messages is left to the Topic.
+type Server struct {
+	Listener net.Listener
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	connIDs atomic.Uint64
+
+	mux   sync.Mutex
+	conns map[*serverConn]struct{}
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// serverConn is a connection accepted by a Server.
+type serverConn struct {
+	id   uint64
+	conn net.Conn
+
+	writeMux sync.Mutex
+	inflight sync.WaitGroup
+}
+
+// errShuttingDown is sent to Topics for Messages which are not
+// delivered because the Server is shutting down.
+const errShuttingDown = "server is shutting down"
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed
+func (s *Server) Serve(r msg.Receiver) error {
+	for {
+		c, err := s.Listener.Accept()
+		if err != nil {
+			if s.listenerCtx.Err() != nil {
+				return msg.ErrServerClosed
+			}
+			return err
+		}
+
+		sc := &serverConn{
+			id:   s.connIDs.Add(1),
+			conn: c,
+		}
+		if !s.track(sc) {
+			c.Close()
+			return msg.ErrServerClosed
+		}
+		go s.serveConn(sc, r)
+	}
+}
+
+// track registers sc, so that Shutdown can close it. It returns false if
+// the Server is shutting down.
+func (s *Server) track(sc *serverConn) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.listenerCtx.Err() != nil {
+		return false
+	}
+	s.conns[sc] = struct{}{}
+	return true
+}
+
+// serveConn reads Messages from sc until it breaks or the Server shuts
+// down, then closes it once every Message has been answered.
+func (s *Server) serveConn(sc *serverConn, r msg.Receiver) {
+	defer func() {
+		sc.inflight.Wait()
+		sc.conn.Close()
+
+		s.mux.Lock()
+		delete(s.conns, sc)
+		s.mux.Unlock()
+	}()
+
+	br := bufio.NewReader(sc.conn)
+	for {
+		f, err := readFrame(br)
+		if err != nil {
+			return
+		}
+		if f.typ != frameMessage {
+			continue
+		}
+
+		if f.delay > 0 {
+			// the Message only takes a slot once it is due, so that it
+			// does not hold up the Messages which follow it
+			sc.inflight.Add(1)
+			go func(f *frame) {
+				defer sc.inflight.Done()
+
+				if !s.wait(f.delay) {
+					s.reply(sc, f.id, nack(errShuttingDown))
+					return
+				}
+				if s.acquire(sc, f) {
+					s.process(s.receiverCtx, sc, f, r)
+				}
+			}(f)
+			continue
+		}
+
+		if s.acquire(sc, f) {
+			sc.inflight.Add(1)
+			go func(f *frame) {
+				defer sc.inflight.Done()
+
+				s.process(s.receiverCtx, sc, f, r)
+			}(f)
+		}
+	}
+}
+
+// wait blocks for d. It returns false if the Server started shutting
+// down in the meantime.
+func (s *Server) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.listenerCtx.Done():
+		return false
+	}
+}
+
+// acquire blocks until a slot is free to process f. It returns false if
+// the Server is shutting down, in which case f is nacked.
+func (s *Server) acquire(sc *serverConn, f *frame) bool {
+	if s.listenerCtx.Err() != nil {
+		s.reply(sc, f.id, nack(errShuttingDown))
+		return false
+	}
+
+	// acquire "lock"
+	select {
+	case <-s.listenerCtx.Done():
+		s.reply(sc, f.id, nack(errShuttingDown))
+		return false
+	case s.maxConcurrentReceives <- struct{}{}:
+		return true
+	}
+}
+
+// process delivers f to r and sends the reply, then frees the slot
+// acquired for f.
+func (s *Server) process(ctx context.Context, sc *serverConn, f *frame, r msg.Receiver) {
+	defer func() {
+		<-s.maxConcurrentReceives
+	}()
+
+	s.reply(sc, f.id, s.deliver(ctx, sc, f, r))
+}
+
+// deliver delivers f to r and returns the reply to send.
+func (s *Server) deliver(ctx context.Context, sc *serverConn, f *frame, r msg.Receiver) *frame {
+	ctx = msg.WithDeliveryInfo(ctx, msg.DeliveryInfo{
+		MessageID:     fmt.Sprintf("%d-%d", sc.id, f.id),
+		ReceiveCount:  1,
+		FirstReceived: time.Now(),
+		Source:        s.Name,
+	})
+	m := &msg.Message{
+		Attributes: f.attributes,
+		Body:       bytes.NewReader(f.body),
+	}
+
+	err := r.Receive(ctx, m)
+	if err == nil {
+		return &frame{typ: frameAck}
+	}
+	log.Printf("could not receive message %s", err)
+
+	reply := nack(err.Error())
+	reply.permanent = !msg.IsRetryable(err)
+	if delay, ok := msg.RetryDelay(err); ok {
+		reply.retryAfter = delay
+	}
+	return reply
+}
+
+func nack(reason string) *frame {
+	return &frame{typ: frameNack, reason: reason}
+}
+
+// reply sends f as the answer to the Message with the given ID.
+func (s *Server) reply(sc *serverConn, id uint64, f *frame) {
+	f.id = id
+
+	sc.writeMux.Lock()
+	defer sc.writeMux.Unlock()
+
+	if _, err := sc.conn.Write(f.encode()); err != nil {
+		log.Printf("could not reply to message %s", err)
+	}
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server closes its Listener, stops
+// reading new Messages and then it waits for all of the active
+// goroutines to complete. Messages which arrive in the meantime, and
+// delayed Messages which are not due yet, are answered with a retryable
+// nack.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+	s.Listener.Close()
+
+	// unblock connections waiting for a frame
+	s.mux.Lock()
+	for sc := range s.conns {
+		sc.conn.SetReadDeadline(time.Now())
+	}
+	s.mux.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which accepts
+// connections from l.
+func NewServer(l net.Listener, cc int) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	return &Server{
+		Listener:    l,
+		Concurrency: cc,
+
+		conns:                 make(map[*serverConn]struct{}),
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+}
+
+// Listen announces on the local network address, "tcp" or "unix", and
+// returns a Server which accepts connections on it.
+func Listen(network, address string, cc int) (*Server, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(l, cc), nil
+}
@@ -0,0 +1,68 @@
+package net_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msgnet "github.com/zerofox-oss/go-msg/backends/net"
+)
+
+// TestServer_DelayDoesNotHoldSlot asserts that a delayed Message does not
+// hold up the Messages which follow it, nor a graceful Shutdown, which
+// nacks it.
+func TestServer_DelayDoesNotHoldSlot(t *testing.T) {
+	srv, err := msgnet.Listen("tcp", "127.0.0.1:0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		return nil
+	}))
+
+	topic := msgnet.NewTopic("tcp", srv.Listener.Addr().String(), msgnet.WithMaxRetries(0))
+	defer topic.Close()
+
+	delayed := make(chan error, 1)
+	go func() {
+		delayed <- publish(topic, "later", time.Hour)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		// give the delayed Message a head start
+		time.Sleep(50 * time.Millisecond)
+		done <- publish(topic, "now", 0)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a Message to be delivered while a delayed one waits")
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-shutdown:
+		if err != msg.ErrServerClosed {
+			t.Errorf("expected ErrServerClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Shutdown not to wait for the delayed Message")
+	}
+
+	select {
+	case err := <-delayed:
+		if err == nil || !msg.IsRetryable(err) {
+			t.Errorf("expected the delayed Message to be nacked, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the delayed Message to be answered")
+	}
+}
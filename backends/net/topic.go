@@ -0,0 +1,401 @@
+// Package net provides a backend which exchanges Messages between processes
+// over TCP or Unix domain sockets, without a broker.
+//
+// A Topic dials a Server and sends every Message as a frame of a small
+// length-prefixed protocol over a single, reused connection. The Server
+// acknowledges each Message once its Receiver has processed it, so that
+// MessageWriter.Close reports the outcome of the delivery. If the connection
+// breaks, the Topic reconnects and sends unacknowledged Messages again.
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// RemoteError is the reason a Server gave for rejecting a Message.
+//
+// MessageWriter.Close wraps it with msg.Permanent if the Receiver failed
+// permanently, or with msg.RetryAfter if the Receiver requested a delay.
+type RemoteError struct {
+	Reason string
+}
+
+func (e *RemoteError) Error() string {
+	return "net: message rejected: " + e.Reason
+}
+
+// ErrTopicClosed is returned by MessageWriter.Close after the Topic
+// has been closed.
+var ErrTopicClosed = errors.New("net: topic closed")
+
+// Topic publishes Messages to a Server listening at Address.
+//
+// Messages which fail with a connection error or a retryable error are
+// sent again with exponential backoff, after reconnecting if needed.
+type Topic struct {
+	Network string
+	Address string
+
+	// Dialer dials the Server. If nil, a zero net.Dialer is used.
+	Dialer *net.Dialer
+
+	maxRetries  int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+
+	mux    sync.Mutex
+	conn   *clientConn
+	closed bool
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// TopicOption is a functional option for the Topic.
+type TopicOption func(*Topic)
+
+// WithDialer sets the net.Dialer used to connect to the Server.
+func WithDialer(d *net.Dialer) TopicOption {
+	return func(t *Topic) {
+		t.Dialer = d
+	}
+}
+
+// WithMaxRetries sets how many times a failed Message is sent again.
+// The default is 3.
+func WithMaxRetries(n int) TopicOption {
+	return func(t *Topic) {
+		t.maxRetries = n
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry, which doubles
+// with every retry up to max. The default is 100ms, up to 5s. A delay
+// requested by the Receiver via msg.RetryAfter takes precedence.
+func WithRetryBackoff(base, max time.Duration) TopicOption {
+	return func(t *Topic) {
+		t.backoffBase = base
+		t.backoffMax = max
+	}
+}
+
+// NewTopic returns a Topic which publishes Messages to the Server
+// listening at address on the named network, "tcp" or "unix".
+// The connection is established when the first Message is published.
+func NewTopic(network, address string, opts ...TopicOption) *Topic {
+	t := &Topic{
+		Network:     network,
+		Address:     address,
+		maxRetries:  3,
+		backoffBase: 100 * time.Millisecond,
+		backoffMax:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to send a single Message. Close waits for
+// its acknowledgement until ctx is done.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// Close closes the connection to the Server. Messages in flight fail,
+// and the Topic may not be used afterwards.
+func (t *Topic) Close() error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.close(ErrTopicClosed)
+}
+
+// connect returns the current connection, dialing a new one if there is
+// none or the previous one broke.
+func (t *Topic) connect(ctx context.Context) (*clientConn, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.closed {
+		return nil, ErrTopicClosed
+	}
+	if t.conn != nil && !t.conn.broken() {
+		return t.conn, nil
+	}
+
+	d := t.Dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	c, err := d.DialContext(ctx, t.Network, t.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	t.conn = newClientConn(c)
+	return t.conn, nil
+}
+
+// backoff returns how long to wait before retry n, counting from zero.
+func (t *Topic) backoff(n int) time.Duration {
+	delay := t.backoffBase
+	for i := 0; i < n; i++ {
+		delay *= 2
+		if t.backoffMax > 0 && delay >= t.backoffMax {
+			return t.backoffMax
+		}
+	}
+	return delay
+}
+
+// MessageWriter is used to send a single Message to a Server.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// The delay is applied by the Server, so Close waits for it too.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close sends the Message and waits for the Server to acknowledge it.
+// If the Receiver failed, the returned error wraps a RemoteError.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	f := &frame{
+		typ:        frameMessage,
+		attributes: w.attributes,
+		body:       w.buf.Bytes(),
+		delay:      w.delay,
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := w.send(f)
+		if err == nil || !msg.IsRetryable(err) || errors.Is(err, ErrTopicClosed) ||
+			w.ctx.Err() != nil || attempt >= w.topic.maxRetries {
+			return err
+		}
+
+		delay, ok := msg.RetryDelay(err)
+		if !ok {
+			delay = w.topic.backoff(attempt)
+		}
+		if err := sleep(w.ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// send sends the Message once and waits for its outcome.
+func (w *MessageWriter) send(f *frame) error {
+	c, err := w.topic.connect(w.ctx)
+	if err != nil {
+		return err
+	}
+
+	reply, err := c.roundTrip(w.ctx, f)
+	if err != nil {
+		return err
+	}
+	if reply.typ == frameAck {
+		return nil
+	}
+
+	err = &RemoteError{Reason: reply.reason}
+	switch {
+	case reply.permanent:
+		return msg.Permanent(err)
+	case reply.retryAfter > 0:
+		return msg.RetryAfter(err, reply.retryAfter)
+	default:
+		return err
+	}
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
+
+// clientConn is a connection to a Server. Messages from concurrent
+// MessageWriters are multiplexed over it, and replies are matched to
+// them by ID.
+type clientConn struct {
+	conn net.Conn
+
+	writeMux sync.Mutex
+
+	mux     sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *frame
+	err     error
+}
+
+func newClientConn(conn net.Conn) *clientConn {
+	c := &clientConn{
+		conn:    conn,
+		pending: make(map[uint64]chan *frame),
+	}
+	go c.readLoop()
+	return c
+}
+
+// roundTrip sends f and waits for the reply to it.
+func (c *clientConn) roundTrip(ctx context.Context, f *frame) (*frame, error) {
+	reply := make(chan *frame, 1)
+
+	c.mux.Lock()
+	if c.err != nil {
+		c.mux.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = reply
+	c.mux.Unlock()
+
+	defer func() {
+		c.mux.Lock()
+		delete(c.pending, id)
+		c.mux.Unlock()
+	}()
+
+	f.id = id
+	c.writeMux.Lock()
+	_, err := c.conn.Write(f.encode())
+	c.writeMux.Unlock()
+	if err != nil {
+		c.close(err)
+		return nil, err
+	}
+
+	select {
+	case r, ok := <-reply:
+		if !ok {
+			return nil, c.failure()
+		}
+		return r, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop dispatches replies to their pending round trips until the
+// connection breaks.
+func (c *clientConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+
+		c.mux.Lock()
+		if reply, ok := c.pending[f.id]; ok {
+			reply <- f
+			delete(c.pending, f.id)
+		}
+		c.mux.Unlock()
+	}
+}
+
+// close closes the connection and fails all pending round trips with err.
+func (c *clientConn) close(err error) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.err != nil {
+		return nil
+	}
+	c.err = err
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	return c.conn.Close()
+}
+
+func (c *clientConn) broken() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.err != nil
+}
+
+func (c *clientConn) failure() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.err
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,161 @@
+package net_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msgnet "github.com/zerofox-oss/go-msg/backends/net"
+)
+
+func publish(topic msg.Topic, body string, delay time.Duration) error {
+	w := topic.NewWriter(context.Background())
+	w.SetDelay(delay)
+	w.Write([]byte(body))
+	return w.Close()
+}
+
+// TestTopic_ReportsOutcome asserts that Close reports the outcome of
+// Receive, including msg retry semantics.
+func TestTopic_ReportsOutcome(t *testing.T) {
+	srv, topic := listen(t, msgnet.WithMaxRetries(0))
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			return err
+		}
+		switch string(body) {
+		case "permanent":
+			return msg.Permanent(errors.New("bad message"))
+		case "retry":
+			return msg.RetryAfter(errors.New("slow down"), time.Minute)
+		}
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	if err := publish(topic, "ok", 0); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	err := publish(topic, "permanent", 0)
+	var remote *msgnet.RemoteError
+	if !errors.As(err, &remote) || !msg.IsPermanent(err) {
+		t.Errorf("expected a permanent RemoteError, got %v", err)
+	}
+
+	err = publish(topic, "retry", 0)
+	if delay, ok := msg.RetryDelay(err); !ok || delay != time.Minute {
+		t.Errorf("expected a retry delay of 1m, got %v (%v)", delay, err)
+	}
+}
+
+func TestTopic_RetriesFailures(t *testing.T) {
+	srv, topic := listen(t, msgnet.WithRetryBackoff(time.Millisecond, 10*time.Millisecond))
+
+	var calls atomic.Int32
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if calls.Add(1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	if err := publish(topic, "hello world", 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 deliveries, got %d", n)
+	}
+}
+
+func TestTopic_HonorsDelay(t *testing.T) {
+	srv, topic := listen(t)
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	start := time.Now()
+	if err := publish(topic, "hello world", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected delivery to be delayed by 100ms, got %s", elapsed)
+	}
+}
+
+// TestTopic_MultiplexesWriters asserts that concurrent MessageWriters
+// share a connection and each receive their own acknowledgement.
+func TestTopic_MultiplexesWriters(t *testing.T) {
+	srv, topic := listen(t, msgnet.WithMaxRetries(0))
+	go srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			return err
+		}
+		if len(body)%2 == 1 {
+			return msg.Permanent(errors.New("odd"))
+		}
+		return nil
+	}))
+	defer srv.Shutdown(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+
+			body := make([]byte, n)
+			err := publish(topic, string(body), 0)
+			if n%2 == 0 && err != nil {
+				t.Errorf("expected message of length %d to succeed, got %v", n, err)
+			}
+			if n%2 == 1 && !msg.IsPermanent(err) {
+				t.Errorf("expected message of length %d to fail, got %v", n, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestTopic_Reconnects asserts that the Topic reconnects to a Server
+// which was restarted.
+func TestTopic_Reconnects(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "msg.sock")
+	receiver := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		return nil
+	})
+
+	srv, err := msgnet.Listen("unix", addr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(receiver)
+
+	topic := msgnet.NewTopic("unix", addr, msgnet.WithRetryBackoff(10*time.Millisecond, 100*time.Millisecond))
+	defer topic.Close()
+
+	if err := publish(topic, "one", 0); err != nil {
+		t.Fatal(err)
+	}
+	srv.Shutdown(context.Background())
+
+	srv, err = msgnet.Listen("unix", addr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(receiver)
+	defer srv.Shutdown(context.Background())
+
+	if err := publish(topic, "two", 0); err != nil {
+		t.Errorf("expected message to be sent after reconnecting, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package redis_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/zerofox-oss/go-msg"
+	msgredis "github.com/zerofox-oss/go-msg/backends/redis"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// client returns a client connected to a new in-process Redis server,
+// which are closed when the test completes.
+func client(t *testing.T) *redis.Client {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		c := client(t)
+		last := "0"
+
+		return msgtest.TopicFixture{
+			Topic: msgredis.NewTopic(c, "messages"),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				streams, err := c.XRead(ctx, &redis.XReadArgs{
+					Streams: []string{"messages", last},
+					Count:   1,
+					Block:   time.Until(deadline(ctx)),
+				}).Result()
+				if err != nil {
+					return nil, err
+				}
+				xm := streams[0].Messages[0]
+				last = xm.ID
+				return message(t, xm), nil
+			},
+		}
+	})
+}
+
+func deadline(ctx context.Context) time.Time {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return time.Now().Add(time.Minute)
+	}
+	return d
+}
+
+// message returns the Message stored in xm.
+func message(t *testing.T, xm redis.XMessage) *msg.Message {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       strings.NewReader(xm.Values["body"].(string)),
+	}
+	for k, v := range xm.Values {
+		if k == "body" {
+			continue
+		}
+		var vv []string
+		if err := json.Unmarshal([]byte(v.(string)), &vv); err != nil {
+			t.Errorf("expected field %s to hold a JSON array, got %v", k, v)
+		}
+		m.Attributes[k] = vv
+	}
+	return m
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		c := client(t)
+
+		return msgtest.ServerFixture{
+			Server: msgredis.NewServer(c, "messages", "group", "consumer", 10,
+				msgredis.WithClaimMinIdle(100*time.Millisecond),
+				msgredis.WithClaimInterval(50*time.Millisecond),
+			),
+			Topic: msgredis.NewTopic(c, "messages"),
+		}
+	})
+}
@@ -0,0 +1,479 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server reads Messages from a Redis stream as a member of a consumer
+// group.
+//
+// Messages are acknowledged once Receive returns nil or a permanent error.
+// Other failed Messages stay pending and are reclaimed once they have been
+// idle for the claim min idle time, or after the delay requested with
+// msg.RetryAfter if it is shorter. Messages held by a consumer which died
+// are reclaimed the same way. Delayed Messages which are read before they
+// are due also stay pending, and are reclaimed once they are due.
+type Server struct {
+	Client   redis.UniversalClient
+	Stream   string
+	Group    string
+	Consumer string
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	claimMinIdle    time.Duration
+	claimInterval   time.Duration
+	block           time.Duration
+	maxReceiveCount int
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	// due holds, in order, the times at which pending entries become
+	// eligible to be reclaimed earlier than the claim interval. wake is
+	// signalled when one is added.
+	due  []time.Time
+	wake chan struct{}
+	mux  sync.Mutex
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithClaimMinIdle sets how long a Message must have been pending before
+// it is reclaimed. It should exceed the time it takes to process a
+// Message. The default is 30s.
+func WithClaimMinIdle(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.claimMinIdle = d
+	}
+}
+
+// WithClaimInterval sets how often the Server looks for pending Messages
+// to reclaim. The default is 5s.
+func WithClaimInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.claimInterval = d
+	}
+}
+
+// WithMaxReceiveCount sets the number of times a Message may be delivered
+// before it is acknowledged and dropped. A zero count, the default, means
+// Messages are redelivered until they succeed.
+func WithMaxReceiveCount(n int) ServerOption {
+	return func(s *Server) {
+		s.maxReceiveCount = n
+	}
+}
+
+// Serve creates the consumer group if it does not exist, then delivers
+// Messages to r. It always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed
+func (s *Server) Serve(r msg.Receiver) error {
+	err := s.Client.XGroupCreateMkStream(s.listenerCtx, s.Stream, s.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		if s.listenerCtx.Err() != nil {
+			return msg.ErrServerClosed
+		}
+		return err
+	}
+
+	go s.reclaim(r)
+
+	for {
+		n, ok := s.acquire()
+		if !ok {
+			return msg.ErrServerClosed
+		}
+
+		streams, err := s.Client.XReadGroup(s.listenerCtx, &redis.XReadGroupArgs{
+			Group:    s.Group,
+			Consumer: s.Consumer,
+			Streams:  []string{s.Stream, ">"},
+			Count:    int64(n),
+			Block:    s.block,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			s.release(n)
+			if s.listenerCtx.Err() != nil {
+				return msg.ErrServerClosed
+			}
+			return err
+		}
+
+		var messages []redis.XMessage
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+		s.dispatch(r, messages, n, false)
+	}
+}
+
+// reclaim periodically claims Messages which have been pending for too
+// long and delivers them again, until the Server is shut down.
+func (s *Server) reclaim(r msg.Receiver) {
+	for {
+		timer := time.NewTimer(s.nextClaim())
+		select {
+		case <-s.listenerCtx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		start := "0-0"
+		for {
+			n, ok := s.acquire()
+			if !ok {
+				return
+			}
+
+			messages, next, err := s.Client.XAutoClaim(s.listenerCtx, &redis.XAutoClaimArgs{
+				Stream:   s.Stream,
+				Group:    s.Group,
+				Consumer: s.Consumer,
+				MinIdle:  s.claimMinIdle,
+				Start:    start,
+				Count:    int64(n),
+			}).Result()
+			if err != nil {
+				s.release(n)
+				if s.listenerCtx.Err() == nil {
+					log.Printf("could not reclaim messages %s", err)
+				}
+				break
+			}
+			s.dispatch(r, messages, n, true)
+
+			// "0-0" means the whole pending entries list was scanned
+			if next == "0-0" {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// nextClaim returns how long reclaim waits before it looks for pending
+// entries again: the claim interval, or less if an entry becomes eligible
+// earlier. The times which have passed are forgotten.
+func (s *Server) nextClaim() time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := time.Now()
+	i := sort.Search(len(s.due), func(i int) bool { return s.due[i].After(now) })
+	s.due = s.due[i:]
+	if i > 0 {
+		return 0
+	}
+	if len(s.due) > 0 && s.due[0].Sub(now) < s.claimInterval {
+		return s.due[0].Sub(now)
+	}
+	return s.claimInterval
+}
+
+// schedule makes reclaim look for pending entries at t.
+func (s *Server) schedule(t time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	i := sort.Search(len(s.due), func(i int) bool { return s.due[i].After(t) })
+	s.due = append(s.due, time.Time{})
+	copy(s.due[i+1:], s.due[i:])
+	s.due[i] = t
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// acquire blocks until at least one slot is free, then acquires as many
+// free slots as are available without blocking. It returns false if the
+// Server was shut down.
+func (s *Server) acquire() (int, bool) {
+	select {
+	case <-s.listenerCtx.Done():
+		return 0, false
+	case s.maxConcurrentReceives <- struct{}{}:
+	}
+
+	n := 1
+	for n < cap(s.maxConcurrentReceives) {
+		select {
+		case s.maxConcurrentReceives <- struct{}{}:
+			n++
+		default:
+			return n, true
+		}
+	}
+	return n, true
+}
+
+// release frees n slots.
+func (s *Server) release(n int) {
+	for i := 0; i < n; i++ {
+		<-s.maxConcurrentReceives
+	}
+}
+
+// dispatch delivers each of messages using one of the n acquired slots,
+// and releases the slots which are left over.
+func (s *Server) dispatch(r msg.Receiver, messages []redis.XMessage, n int, reclaimed bool) {
+	for _, xm := range messages {
+		go func(ctx context.Context, xm redis.XMessage) {
+			m, deliverAt, err := decode(xm)
+			if err != nil {
+				<-s.maxConcurrentReceives
+				log.Printf("dropping message %s", err)
+				s.ack(xm.ID)
+				return
+			}
+			defer func() {
+				<-s.maxConcurrentReceives
+			}()
+
+			if wait := time.Until(deliverAt); wait > 0 {
+				s.postpone(ctx, xm.ID, wait, reclaimed)
+				return
+			}
+			s.deliver(ctx, r, xm.ID, m, reclaimed)
+		}(s.receiverCtx, xm)
+	}
+	s.release(n - len(messages))
+}
+
+// deliver delivers the stream entry id to r and settles its outcome.
+func (s *Server) deliver(ctx context.Context, r msg.Receiver, id string, m *msg.Message, reclaimed bool) {
+	info := msg.DeliveryInfo{
+		MessageID:    id,
+		ReceiveCount: 1,
+		PublishTime:  publishTime(id),
+		Source:       s.Name,
+	}
+	if reclaimed {
+		info.ReceiveCount = s.receiveCount(ctx, id)
+	} else {
+		info.FirstReceived = time.Now()
+	}
+
+	if s.maxReceiveCount > 0 && info.ReceiveCount > s.maxReceiveCount {
+		log.Printf("dropping message %s: exceeded max receive count", id)
+		s.ack(id)
+		return
+	}
+
+	err := r.Receive(msg.WithDeliveryInfo(ctx, info), m)
+	if err == nil {
+		s.ack(id)
+		return
+	}
+	log.Printf("could not receive message %s", err)
+
+	if !msg.IsRetryable(err) {
+		log.Printf("dropping message %s", err)
+		s.ack(id)
+		return
+	}
+
+	delay, _ := msg.RetryDelay(err)
+	s.retryAfter(id, info.ReceiveCount, delay)
+}
+
+// postpone leaves the entry id, which is due after wait, pending until
+// then rather than holding it, so that it neither takes a slot nor is
+// reclaimed and delivered a second time while it waits. The read which
+// returned it is not counted as a delivery.
+func (s *Server) postpone(ctx context.Context, id string, wait time.Duration, reclaimed bool) {
+	n := 0
+	if reclaimed {
+		n = s.receiveCount(ctx, id) - 1
+	}
+	s.retryAfter(id, n, wait)
+}
+
+func (s *Server) ack(id string) {
+	if err := s.Client.XAck(context.Background(), s.Stream, s.Group, id).Err(); err != nil {
+		log.Printf("could not acknowledge message %s", err)
+	}
+}
+
+// retryAfter makes the pending entry id eligible to be reclaimed after
+// delay, by pretending that it has already been idle for part of the
+// claim min idle time, and makes reclaim look for it then rather than on
+// its next interval. A delay longer than the claim min idle time is cut
+// short, and the entry is reclaimed once it has been idle for that long
+// instead. The delivery count is kept at n, since XAUTOCLAIM and some
+// servers' XCLAIM count as a delivery.
+func (s *Server) retryAfter(id string, n int, delay time.Duration) {
+	idle := s.claimMinIdle - delay
+	if idle < 0 {
+		idle = 0
+	}
+
+	err := s.Client.Do(context.Background(), "XCLAIM", s.Stream, s.Group, s.Consumer, 0, id,
+		"IDLE", idle.Milliseconds(), "RETRYCOUNT", n, "JUSTID").Err()
+	if err != nil {
+		log.Printf("could not schedule message for retry %s", err)
+		return
+	}
+	if delay > 0 {
+		s.schedule(time.Now().Add(s.claimMinIdle - idle))
+	}
+}
+
+// receiveCount returns how many times the entry id has been delivered.
+func (s *Server) receiveCount(ctx context.Context, id string) int {
+	pending, err := s.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: s.Stream,
+		Group:  s.Group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return int(pending[0].RetryCount)
+}
+
+// decode converts a stream entry to a Message and the time it is due.
+func decode(xm redis.XMessage) (*msg.Message, time.Time, error) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       &bytes.Buffer{},
+	}
+
+	var deliverAt time.Time
+	for k, v := range xm.Values {
+		s, _ := v.(string)
+		switch k {
+		case fieldBody:
+			m.Body = strings.NewReader(s)
+		case fieldDeliverAt:
+			if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+				deliverAt = time.UnixMilli(ms)
+			}
+		default:
+			var vv []string
+			if err := json.Unmarshal([]byte(s), &vv); err != nil {
+				return nil, time.Time{}, fmt.Errorf("redis: invalid attribute %s of entry %s: %w", k, xm.ID, err)
+			}
+			k = textproto.CanonicalMIMEHeaderKey(k)
+			m.Attributes[k] = append(m.Attributes[k], vv...)
+		}
+	}
+	return m, deliverAt, nil
+}
+
+// publishTime returns the time encoded in a stream entry ID, which is
+// the Redis server time at which the entry was added.
+func publishTime(id string) time.Time {
+	ms, _, _ := strings.Cut(id, "-")
+	t, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(t)
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops reading new Messages
+// and then it waits for all of the active goroutines to complete.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned. Messages which were not acknowledged stay pending, and
+// are reclaimed by other consumers of the group.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which reads from stream
+// as consumer, a member of group.
+func NewServer(client redis.UniversalClient, stream, group, consumer string, cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		Client:      client,
+		Stream:      stream,
+		Group:       group,
+		Consumer:    consumer,
+		Concurrency: cc,
+
+		claimMinIdle:  30 * time.Second,
+		claimInterval: 5 * time.Second,
+		block:         time.Second,
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+		wake:                  make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
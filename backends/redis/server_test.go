@@ -0,0 +1,269 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zerofox-oss/go-msg"
+	msgredis "github.com/zerofox-oss/go-msg/backends/redis"
+)
+
+func publish(t *testing.T, topic msg.Topic, body string, delay time.Duration) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	w.Attributes().Set("X-Request-Id", "1234")
+	w.SetDelay(delay)
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve starts srv in the background and shuts it down when the test
+// completes.
+func serve(t *testing.T, srv *msgredis.Server, r msg.ReceiverFunc) {
+	go srv.Serve(r)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+}
+
+func TestTopic_StoresAttributesAsFields(t *testing.T) {
+	c := client(t)
+	publish(t, msgredis.NewTopic(c, "messages"), "hello world", 0)
+
+	entries, err := c.XRange(context.Background(), "messages", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if got := entries[0].Values["X-Request-Id"]; got != `["1234"]` {
+		t.Errorf("expected field X-Request-Id to be %q, got %v", `["1234"]`, got)
+	}
+	if got := entries[0].Values["body"]; got != "hello world" {
+		t.Errorf("expected field body to be %q, got %v", "hello world", got)
+	}
+}
+
+// TestServer_RoundTripsAttributes asserts that attributes with several
+// values, or with keys which clash with reserved fields, arrive intact.
+func TestServer_RoundTripsAttributes(t *testing.T) {
+	c := client(t)
+
+	w := msgredis.NewTopic(c, "messages").NewWriter(context.Background())
+	(*w.Attributes())["Accept"] = []string{"text/plain", "application/json, text/html"}
+	(*w.Attributes())["body"] = []string{"not the body"}
+	(*w.Attributes())["deliver-at"] = []string{"0"}
+	w.Write([]byte("hello world"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *msg.Message, 1)
+	serve(t, msgredis.NewServer(c, "messages", "group", "consumer", 1), func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	})
+
+	var m *msg.Message
+	select {
+	case m = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be delivered")
+	}
+
+	body, _ := msg.DumpBody(m)
+	if string(body) != "hello world" {
+		t.Errorf("expected body %q, got %q", "hello world", body)
+	}
+	expected := []string{"text/plain", "application/json, text/html"}
+	if got := m.Attributes["Accept"]; strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected Accept to be %q, got %q", expected, got)
+	}
+	if got := m.Attributes.Get("Body"); got != "not the body" {
+		t.Errorf("expected attribute Body to be %q, got %q", "not the body", got)
+	}
+	if got := m.Attributes.Get("Deliver-At"); got != "0" {
+		t.Errorf("expected attribute Deliver-At to be %q, got %q", "0", got)
+	}
+}
+
+// TestServer_ReclaimsStuckMessages asserts that Messages read by a
+// consumer which never acknowledged them are delivered again.
+func TestServer_ReclaimsStuckMessages(t *testing.T) {
+	c := client(t)
+	ctx := context.Background()
+	publish(t, msgredis.NewTopic(c, "messages"), "hello world", 0)
+
+	// another consumer reads the Message and dies
+	if err := c.XGroupCreateMkStream(ctx, "messages", "group", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	err := c.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    "group",
+		Consumer: "dead",
+		Streams:  []string{"messages", ">"},
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan msg.DeliveryInfo, 1)
+	srv := msgredis.NewServer(c, "messages", "group", "consumer", 1,
+		msgredis.WithClaimMinIdle(50*time.Millisecond),
+		msgredis.WithClaimInterval(20*time.Millisecond),
+	)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		received <- info
+		return nil
+	})
+
+	select {
+	case info := <-received:
+		if info.ReceiveCount != 2 {
+			t.Errorf("expected receive count 2, got %d", info.ReceiveCount)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message to be reclaimed")
+	}
+
+	srv.Shutdown(ctx)
+	pending, err := c.XPending(ctx, "messages", "group").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 0 {
+		t.Errorf("expected no pending messages, got %d", pending.Count)
+	}
+}
+
+// TestServer_HonorsRetryAfter asserts that a Message which fails with
+// msg.RetryAfter is redelivered after the delay, rather than the claim
+// min idle time.
+func TestServer_HonorsRetryAfter(t *testing.T) {
+	c := client(t)
+	publish(t, msgredis.NewTopic(c, "messages"), "hello world", 0)
+
+	done := make(chan time.Duration, 1)
+	var first time.Time
+	srv := msgredis.NewServer(c, "messages", "group", "consumer", 1,
+		msgredis.WithClaimMinIdle(time.Hour),
+		msgredis.WithClaimInterval(20*time.Millisecond),
+	)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		if info.ReceiveCount == 1 {
+			first = time.Now()
+			return msg.RetryAfter(errors.New("slow down"), 200*time.Millisecond)
+		}
+		done <- time.Since(first)
+		return nil
+	})
+
+	select {
+	case elapsed := <-done:
+		if elapsed < 200*time.Millisecond {
+			t.Errorf("expected redelivery after 200ms, got %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message to be redelivered")
+	}
+}
+
+func TestServer_DropsAfterMaxReceiveCount(t *testing.T) {
+	c := client(t)
+	ctx := context.Background()
+	publish(t, msgredis.NewTopic(c, "messages"), "hello world", 0)
+
+	calls := make(chan struct{}, 10)
+	srv := msgredis.NewServer(c, "messages", "group", "consumer", 1,
+		msgredis.WithClaimMinIdle(10*time.Millisecond),
+		msgredis.WithClaimInterval(10*time.Millisecond),
+		msgredis.WithMaxReceiveCount(2),
+	)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		calls <- struct{}{}
+		return errors.New("always fails")
+	})
+
+	deadline := time.After(5 * time.Second)
+	for {
+		pending, err := c.XPending(ctx, "messages", "group").Result()
+		if err == nil && pending.Count == 0 && len(calls) > 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for message to be dropped")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if n := len(calls); n != 2 {
+		t.Errorf("expected 2 deliveries, got %d", n)
+	}
+}
+
+func TestServer_HonorsDelay(t *testing.T) {
+	c := client(t)
+	start := time.Now()
+	publish(t, msgredis.NewTopic(c, "messages"), "hello world", 200*time.Millisecond)
+
+	received := make(chan time.Time, 1)
+	srv := msgredis.NewServer(c, "messages", "group", "consumer", 1)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		received <- time.Now()
+		return nil
+	})
+
+	select {
+	case at := <-received:
+		if elapsed := at.Sub(start); elapsed < 200*time.Millisecond {
+			t.Errorf("expected delivery to be delayed by 200ms, got %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message to be delivered")
+	}
+}
+
+// TestServer_DelaysLongerThanClaimMinIdle asserts that a Message delayed
+// for longer than the claim min idle time is delivered once, when it is
+// due, rather than each time it could have been reclaimed.
+func TestServer_DelaysLongerThanClaimMinIdle(t *testing.T) {
+	c := client(t)
+	start := time.Now()
+	publish(t, msgredis.NewTopic(c, "messages"), "hello world", 500*time.Millisecond)
+
+	received := make(chan msg.DeliveryInfo, 10)
+	srv := msgredis.NewServer(c, "messages", "group", "consumer", 1,
+		msgredis.WithClaimMinIdle(50*time.Millisecond),
+		msgredis.WithClaimInterval(20*time.Millisecond),
+	)
+	serve(t, srv, func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		received <- info
+		return nil
+	})
+
+	select {
+	case info := <-received:
+		if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+			t.Errorf("expected delivery to be delayed by 500ms, got %s", elapsed)
+		}
+		if info.ReceiveCount != 1 {
+			t.Errorf("expected receive count 1, got %d", info.ReceiveCount)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message to be delivered")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if n := len(received); n != 0 {
+		t.Errorf("expected a single delivery, got %d more", n)
+	}
+}
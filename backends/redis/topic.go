@@ -0,0 +1,176 @@
+// Package redis provides a backend which uses Redis Streams as a durable
+// queue.
+//
+// A Topic appends every Message to a stream with XADD. Its attributes are
+// stored as fields of the entry, named by their canonical key and holding
+// a JSON array of their values, and its body in the reserved "body" field.
+//
+// A Server reads entries as a member of a consumer group and acknowledges
+// them with XACK once they have been processed. Entries which are not
+// acknowledged, because the Receiver failed or the consumer died, are
+// reclaimed with XAUTOCLAIM and delivered again.
+package redis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Reserved fields of stream entries. They are lowercase, so they never
+// collide with the canonical keys which attributes are stored under.
+const (
+	fieldBody      = "body"
+	fieldDeliverAt = "deliver-at"
+)
+
+// Topic publishes Messages to a Redis stream.
+type Topic struct {
+	Client redis.UniversalClient
+	Stream string
+
+	maxLen int64
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// TopicOption is a functional option for the Topic.
+type TopicOption func(*Topic)
+
+// WithMaxLen caps the stream at approximately n entries. Older entries
+// are trimmed as new ones are added, whether or not they were processed.
+func WithMaxLen(n int64) TopicOption {
+	return func(t *Topic) {
+		t.maxLen = n
+	}
+}
+
+// NewTopic returns a Topic which publishes Messages to stream.
+func NewTopic(client redis.UniversalClient, stream string, opts ...TopicOption) *Topic {
+	t := &Topic{
+		Client: client,
+		Stream: stream,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to add a single entry to the stream.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to publish a single Message to a Redis stream.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+// Streams have no delayed delivery, so the entry is added immediately
+// and left pending by the Server which reads it until it is due.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close adds the Message to the stream.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	values, err := encodeAttributes(w.attributes)
+	if err != nil {
+		return err
+	}
+	values = append(values, fieldBody, w.buf.Bytes())
+	if w.delay > 0 {
+		deliverAt := time.Now().Add(w.delay).UnixMilli()
+		values = append(values, fieldDeliverAt, strconv.FormatInt(deliverAt, 10))
+	}
+
+	args := &redis.XAddArgs{
+		Stream: w.topic.Stream,
+		Values: values,
+	}
+	if w.topic.maxLen > 0 {
+		args.MaxLen = w.topic.maxLen
+		args.Approx = true
+	}
+	return w.topic.Client.XAdd(w.ctx, args).Err()
+}
+
+// encodeAttributes returns the fields of an entry for attrs, as
+// alternating keys and values. Keys are canonicalized, and the values of
+// keys which only differ in case are merged.
+func encodeAttributes(attrs msg.Attributes) ([]interface{}, error) {
+	canonical := make(map[string][]string, len(attrs))
+	for k, vv := range attrs {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		canonical[k] = append(canonical[k], vv...)
+	}
+
+	values := make([]interface{}, 0, 2*len(canonical)+4)
+	for k, vv := range canonical {
+		b, err := json.Marshal(vv)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, k, string(b))
+	}
+	return values, nil
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,90 @@
+package sql_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msgsql "github.com/zerofox-oss/go-msg/backends/sql"
+	"github.com/zerofox-oss/go-msg/msgtest"
+	_ "modernc.org/sqlite"
+)
+
+// open returns a new SQLite database with an outbox table, which is
+// closed when the test completes.
+func open(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "msg.db") + "?_pragma=busy_timeout(5000)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE outbox (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		attributes    TEXT NOT NULL,
+		body          BLOB NOT NULL,
+		available_at  BIGINT NOT NULL,
+		created_at    BIGINT NOT NULL,
+		receive_count INTEGER NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTopic_Conformance(t *testing.T) {
+	msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+		db := open(t)
+		var last int64
+
+		return msgtest.TopicFixture{
+			Topic: msgsql.NewTopic(db, "outbox", msgsql.SQLite),
+			Next: func(ctx context.Context) (*msg.Message, error) {
+				for {
+					var (
+						attrs string
+						body  []byte
+					)
+					err := db.QueryRowContext(ctx,
+						"SELECT id, attributes, body FROM outbox WHERE id > ? ORDER BY id LIMIT 1", last,
+					).Scan(&last, &attrs, &body)
+					if err == nil {
+						m := &msg.Message{Body: bytes.NewReader(body)}
+						return m, json.Unmarshal([]byte(attrs), &m.Attributes)
+					}
+					if err != sql.ErrNoRows {
+						return nil, err
+					}
+
+					select {
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					case <-time.After(time.Millisecond):
+					}
+				}
+			},
+		}
+	})
+}
+
+func TestServer_Conformance(t *testing.T) {
+	msgtest.TestServer(t, func(t *testing.T) msgtest.ServerFixture {
+		db := open(t)
+
+		return msgtest.ServerFixture{
+			Server: msgsql.NewServer(db, "outbox", msgsql.SQLite, 10,
+				msgsql.WithPollInterval(10*time.Millisecond),
+			),
+			Topic: msgsql.NewTopic(db, "outbox", msgsql.SQLite),
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package sql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect describes how to write queries for a database.
+type Dialect struct {
+	// Placeholder returns the placeholder for the nth argument of a
+	// query, counting from 1.
+	Placeholder func(n int) string
+
+	// Lock is appended to the query which selects the rows a Server
+	// claims, so that concurrent Servers skip the rows locked by each
+	// other instead of waiting for them.
+	Lock string
+}
+
+// Dialects of common databases.
+var (
+	Postgres = Dialect{
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		Lock:        "FOR UPDATE SKIP LOCKED",
+	}
+	MySQL = Dialect{
+		Placeholder: func(int) string { return "?" },
+		Lock:        "FOR UPDATE SKIP LOCKED",
+	}
+
+	// SQLite has no row locks; its writers are serialized instead.
+	SQLite = Dialect{
+		Placeholder: func(int) string { return "?" },
+	}
+)
+
+// query replaces the placeholders of q, written as "?", with those of
+// the dialect.
+func (d Dialect) query(q string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString(d.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,14 @@
+package sql
+
+import "testing"
+
+func TestDialect_Query(t *testing.T) {
+	q := "UPDATE outbox SET available_at = ? WHERE id = ?"
+
+	if got, want := Postgres.query(q), "UPDATE outbox SET available_at = $1 WHERE id = $2"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := SQLite.query(q); got != q {
+		t.Errorf("expected %q, got %q", q, got)
+	}
+}
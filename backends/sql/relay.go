@@ -0,0 +1,30 @@
+package sql
+
+import (
+	"context"
+	"io"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Relay returns a Receiver which publishes every Message to t, with the
+// same attributes and body. Serving an outbox table with it copies the
+// Messages to t, and deletes each of them once t accepted it:
+//
+//	srv := sql.NewServer(db, "outbox", sql.Postgres, 1)
+//	err := srv.Serve(sql.Relay(topic))
+//
+// A Server with a concurrency of 1 relays Messages in the order they were
+// inserted, except for those which are retried.
+func Relay(t msg.Topic) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		w := t.NewWriter(ctx)
+		for k, vv := range m.Attributes {
+			(*w.Attributes())[k] = append([]string(nil), vv...)
+		}
+		if _, err := io.Copy(w, m.Body); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
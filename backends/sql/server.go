@@ -0,0 +1,340 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Server polls a table for due Messages and delivers them to a Receiver.
+//
+// Rows are claimed for the lease duration before they are delivered, so
+// that other Servers polling the same table skip them. A row is deleted
+// once Receive returns nil or a permanent error. Otherwise it is made
+// available again, after the delay requested with msg.RetryAfter if
+// there is one. Rows claimed by a Server which stopped are delivered
+// again once their lease expires.
+type Server struct {
+	DB      *sql.DB
+	Table   string
+	Dialect Dialect
+
+	// Concurrency is the maximum number of Messages that can be processed
+	// concurrently by the Server.
+	Concurrency int
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the Receiver.
+	Name string
+
+	pollInterval    time.Duration
+	lease           time.Duration
+	maxReceiveCount int
+
+	// maxConcurrentReceives is a buffered channel which acts as
+	// a shared lock that limits the number of concurrent goroutines
+	maxConcurrentReceives chan struct{}
+
+	listenerCtx        context.Context
+	listenerCancelFunc context.CancelFunc
+
+	receiverCtx        context.Context
+	receiverCancelFunc context.CancelFunc
+}
+
+// Ensure that Server implements msg.Server
+var _ msg.Server = &Server{}
+
+// ServerOption is a functional option for the Server.
+type ServerOption func(*Server)
+
+// WithPollInterval sets how long the Server waits before polling the
+// table again when it found no due Messages. The default is 1s.
+func WithPollInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pollInterval = d
+	}
+}
+
+// WithLease sets how long a claimed Message is hidden from other Servers.
+// It should exceed the time it takes to process a Message. The default
+// is 30s.
+func WithLease(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.lease = d
+	}
+}
+
+// WithMaxReceiveCount sets the number of times a Message may be delivered
+// before it is deleted. A zero count, the default, means Messages are
+// redelivered until they succeed.
+func WithMaxReceiveCount(n int) ServerOption {
+	return func(s *Server) {
+		s.maxReceiveCount = n
+	}
+}
+
+// row is a claimed row of the table.
+type row struct {
+	id           int64
+	attributes   msg.Attributes
+	body         []byte
+	createdAt    int64
+	receiveCount int
+}
+
+// Serve always returns a non-nil error.
+// After Shutdown, the returned error is ErrServerClosed
+//
+// Errors claiming Messages, such as a lost connection to the database,
+// are logged and the table is polled again after the poll interval.
+func (s *Server) Serve(r msg.Receiver) error {
+	for {
+		n, ok := s.acquire()
+		if !ok {
+			return msg.ErrServerClosed
+		}
+
+		rows, err := s.claim(n)
+		if err != nil && s.listenerCtx.Err() == nil {
+			log.Printf("could not claim messages %s", err)
+		}
+
+		for _, rw := range rows {
+			go func(ctx context.Context, rw *row) {
+				defer func() {
+					<-s.maxConcurrentReceives
+				}()
+
+				s.deliver(ctx, r, rw)
+			}(s.receiverCtx, rw)
+		}
+		s.release(n - len(rows))
+
+		if len(rows) == 0 {
+			select {
+			case <-time.After(s.pollInterval):
+			case <-s.listenerCtx.Done():
+			}
+		}
+	}
+}
+
+// acquire blocks until at least one slot is free, then acquires as many
+// free slots as are available without blocking. It returns false if the
+// Server was shut down.
+func (s *Server) acquire() (int, bool) {
+	select {
+	case <-s.listenerCtx.Done():
+		return 0, false
+	case s.maxConcurrentReceives <- struct{}{}:
+	}
+
+	n := 1
+	for n < cap(s.maxConcurrentReceives) {
+		select {
+		case s.maxConcurrentReceives <- struct{}{}:
+			n++
+		default:
+			return n, true
+		}
+	}
+	return n, true
+}
+
+// release frees n slots.
+func (s *Server) release(n int) {
+	for i := 0; i < n; i++ {
+		<-s.maxConcurrentReceives
+	}
+}
+
+// claim selects up to n due rows and hides them from other Servers for
+// the lease duration.
+func (s *Server) claim(n int) ([]*row, error) {
+	tx, err := s.DB.BeginTx(s.listenerCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	q := "SELECT id, attributes, body, created_at, receive_count FROM " + s.Table +
+		" WHERE available_at <= ? ORDER BY id LIMIT " + strconv.Itoa(n) + " " + s.Dialect.Lock
+	result, err := tx.QueryContext(s.listenerCtx, s.Dialect.query(q), now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*row
+	for result.Next() {
+		var (
+			rw    row
+			attrs string
+		)
+		if err := result.Scan(&rw.id, &attrs, &rw.body, &rw.createdAt, &rw.receiveCount); err != nil {
+			result.Close()
+			return nil, err
+		}
+		rw.attributes = decodeAttributes(attrs)
+		rows = append(rows, &rw)
+	}
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+
+	q = "UPDATE " + s.Table + " SET available_at = ?, receive_count = receive_count + 1 WHERE id = ?"
+	for _, rw := range rows {
+		rw.receiveCount++
+		if _, err := tx.ExecContext(s.listenerCtx, s.Dialect.query(q), now.Add(s.lease).UnixMilli(), rw.id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// deliver delivers rw to r and settles its outcome.
+func (s *Server) deliver(ctx context.Context, r msg.Receiver, rw *row) {
+	info := msg.DeliveryInfo{
+		MessageID:    strconv.FormatInt(rw.id, 10),
+		ReceiveCount: rw.receiveCount,
+		PublishTime:  time.UnixMilli(rw.createdAt),
+		Source:       s.Name,
+	}
+	if rw.receiveCount == 1 {
+		info.FirstReceived = time.Now()
+	}
+
+	if s.maxReceiveCount > 0 && rw.receiveCount > s.maxReceiveCount {
+		log.Printf("dropping message %d: exceeded max receive count", rw.id)
+		s.delete(rw)
+		return
+	}
+
+	m := &msg.Message{
+		Attributes: rw.attributes,
+		Body:       bytes.NewReader(rw.body),
+	}
+	err := r.Receive(msg.WithDeliveryInfo(ctx, info), m)
+	if err == nil {
+		s.delete(rw)
+		return
+	}
+	log.Printf("could not receive message %s", err)
+
+	if !msg.IsRetryable(err) {
+		log.Printf("dropping message %s", err)
+		s.delete(rw)
+		return
+	}
+
+	delay, _ := msg.RetryDelay(err)
+	s.retryAfter(rw, delay)
+}
+
+// delete deletes rw, unless its lease expired and another Server
+// claimed it in the meantime.
+func (s *Server) delete(rw *row) {
+	q := "DELETE FROM " + s.Table + " WHERE id = ? AND receive_count = ?"
+	if _, err := s.DB.Exec(s.Dialect.query(q), rw.id, rw.receiveCount); err != nil {
+		log.Printf("could not delete message %s", err)
+	}
+}
+
+// retryAfter makes rw available again after delay, unless its lease
+// expired and another Server claimed it in the meantime.
+func (s *Server) retryAfter(rw *row, delay time.Duration) {
+	q := "UPDATE " + s.Table + " SET available_at = ? WHERE id = ? AND receive_count = ?"
+	availableAt := time.Now().Add(delay).UnixMilli()
+	if _, err := s.DB.Exec(s.Dialect.query(q), availableAt, rw.id, rw.receiveCount); err != nil {
+		log.Printf("could not schedule message for retry %s", err)
+	}
+}
+
+// decodeAttributes decodes the JSON object of a row's attributes.
+func decodeAttributes(s string) msg.Attributes {
+	var raw map[string][]string
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return msg.Attributes{}
+	}
+
+	attrs := make(msg.Attributes, len(raw))
+	for k, vv := range raw {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		attrs[k] = append(attrs[k], vv...)
+	}
+	return attrs
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown attempts to gracefully shut down the Server without
+// interrupting any messages in flight.
+// When Shutdown is signalled, the Server stops polling the table
+// and then it waits for all of the active goroutines to complete.
+//
+// If the provided context expires before the shutdown is complete,
+// then any remaining goroutines will be killed and the context's error
+// is returned. Messages which were not settled are delivered again once
+// their lease expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if ctx == nil {
+		panic("invalid context (nil)")
+	}
+	s.listenerCancelFunc()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.receiverCancelFunc()
+			return ctx.Err()
+
+		case <-ticker.C:
+			if len(s.maxConcurrentReceives) == 0 {
+				return msg.ErrServerClosed
+			}
+		}
+	}
+}
+
+// NewServer creates and initializes a new Server which polls table.
+func NewServer(db *sql.DB, table string, dialect Dialect, cc int, opts ...ServerOption) *Server {
+	listenerCtx, listenerCancelFunc := context.WithCancel(context.Background())
+	receiverCtx, receiverCancelFunc := context.WithCancel(context.Background())
+
+	srv := &Server{
+		DB:          db,
+		Table:       table,
+		Dialect:     dialect,
+		Concurrency: cc,
+
+		pollInterval: time.Second,
+		lease:        30 * time.Second,
+
+		listenerCtx:           listenerCtx,
+		listenerCancelFunc:    listenerCancelFunc,
+		receiverCtx:           receiverCtx,
+		receiverCancelFunc:    receiverCancelFunc,
+		maxConcurrentReceives: make(chan struct{}, cc),
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
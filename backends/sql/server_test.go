@@ -0,0 +1,191 @@
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msgsql "github.com/zerofox-oss/go-msg/backends/sql"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// serve starts srv in the background and shuts it down when the test
+// completes.
+func serve(t *testing.T, srv *msgsql.Server, r msg.Receiver) {
+	go srv.Serve(r)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+}
+
+// fastPoll returns opts, preceded by an option which makes the Server poll
+// the table often.
+func fastPoll(opts ...msgsql.ServerOption) []msgsql.ServerOption {
+	return append([]msgsql.ServerOption{msgsql.WithPollInterval(10 * time.Millisecond)}, opts...)
+}
+
+func TestServer_DeletesProcessedMessages(t *testing.T) {
+	db := open(t)
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 0)
+
+	received := make(chan *msg.Message, 1)
+	srv := msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll()...)
+	serve(t, srv, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	}))
+
+	m := <-received
+	msgtest.AssertAttribute(t, m, "X-Request-Id", "1234")
+	msgtest.AssertBody(t, m, "hello world")
+
+	srv.Shutdown(context.Background())
+	if n := rows(t, db); n != 0 {
+		t.Errorf("expected no rows, got %d", n)
+	}
+}
+
+// TestServer_KeepsPollingAfterClaimErrors asserts that the Server keeps
+// polling the table when claiming Messages fails.
+func TestServer_KeepsPollingAfterClaimErrors(t *testing.T) {
+	db := open(t)
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 0)
+
+	// claims fail until the table the Server polls exists
+	received := make(chan *msg.Message, 1)
+	srv := msgsql.NewServer(db, "inbox", msgsql.SQLite, 1, fastPoll()...)
+	serve(t, srv, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- m
+		return nil
+	}))
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := db.Exec("ALTER TABLE outbox RENAME TO inbox"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-received:
+		msgtest.AssertBody(t, m, "hello world")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the Message to be delivered once claims succeed")
+	}
+}
+
+// TestServer_ReclaimsExpiredLeases asserts that Messages claimed by a
+// Server which stopped are delivered again once their lease expires.
+func TestServer_ReclaimsExpiredLeases(t *testing.T) {
+	db := open(t)
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 0)
+
+	// a Server claims the Message and does not settle it in time
+	block := make(chan struct{})
+	claimed := make(chan struct{})
+	stuck := msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll(msgsql.WithLease(200*time.Millisecond))...)
+	serve(t, stuck, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		close(claimed)
+		<-block
+		return nil
+	}))
+	t.Cleanup(func() { close(block) })
+	<-claimed
+
+	infos := make(chan msg.DeliveryInfo, 1)
+	serve(t, msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll()...), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		info, _ := msg.DeliveryInfoFromContext(ctx)
+		infos <- info
+		return nil
+	}))
+
+	select {
+	case info := <-infos:
+		if info.ReceiveCount != 2 {
+			t.Errorf("expected ReceiveCount 2, got %d", info.ReceiveCount)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the message to be delivered again")
+	}
+}
+
+func TestServer_HonorsRetryAfter(t *testing.T) {
+	db := open(t)
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 0)
+
+	received := make(chan time.Time, 2)
+	serve(t, msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll()...), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- time.Now()
+		if info, _ := msg.DeliveryInfoFromContext(ctx); info.ReceiveCount == 1 {
+			return msg.RetryAfter(errors.New("busy"), 300*time.Millisecond)
+		}
+		return nil
+	}))
+
+	first, second := <-received, <-received
+	if d := second.Sub(first); d < 299*time.Millisecond {
+		t.Errorf("expected a retry after at least 300ms, got %s", d)
+	}
+}
+
+func TestServer_DropsAfterMaxReceiveCount(t *testing.T) {
+	db := open(t)
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 0)
+
+	received := make(chan struct{}, 3)
+	srv := msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll(msgsql.WithMaxReceiveCount(2))...)
+	serve(t, srv, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- struct{}{}
+		return errors.New("try again")
+	}))
+
+	<-received
+	<-received
+	deadline := time.Now().Add(time.Second)
+	for rows(t, db) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the message to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(received) != 0 {
+		t.Error("expected the message to be delivered twice")
+	}
+}
+
+func TestServer_HonorsDelay(t *testing.T) {
+	db := open(t)
+	start := time.Now()
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 300*time.Millisecond)
+
+	received := make(chan struct{}, 1)
+	serve(t, msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll()...), msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		received <- struct{}{}
+		return nil
+	}))
+
+	// the due time is stored with millisecond precision
+	<-received
+	if d := time.Since(start); d < 299*time.Millisecond {
+		t.Errorf("expected the message to be delayed by at least 300ms, got %s", d)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db := open(t)
+	publish(t, context.Background(), msgsql.NewTopic(db, "outbox", msgsql.SQLite), "hello world", 0)
+
+	topic := &msgtest.RecordingTopic{}
+	srv := msgsql.NewServer(db, "outbox", msgsql.SQLite, 1, fastPoll()...)
+	serve(t, srv, msgsql.Relay(topic))
+
+	deadline := time.Now().Add(time.Second)
+	for len(topic.Messages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the message to be relayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m := topic.Messages()[0].Message()
+	msgtest.AssertAttribute(t, m, "X-Request-Id", "1234")
+	msgtest.AssertBody(t, m, "hello world")
+}
@@ -0,0 +1,155 @@
+// Package sql provides a backend which stores Messages in a table of a
+// database/sql database, for use as a transactional outbox or as a queue.
+//
+// A Topic inserts every Message as a row of the table. If the context
+// passed to NewWriter carries a transaction, see WithTx, the row is
+// inserted within it, so that the Message is published if and only if
+// the transaction commits.
+//
+// A Server polls the table, claims due rows and delivers them to a
+// Receiver, deleting them once they have been processed. Serving the
+// table with the Receiver returned by Relay copies its Messages to any
+// other msg.Topic.
+//
+// The table must have the following columns. Times are stored as unix
+// milliseconds, so that the same schema works across databases:
+//
+//	CREATE TABLE outbox (
+//		id            BIGSERIAL PRIMARY KEY, -- INTEGER PRIMARY KEY AUTOINCREMENT on SQLite
+//		attributes    TEXT NOT NULL,         -- JSON object
+//		body          BYTEA NOT NULL,        -- BLOB on MySQL and SQLite
+//		available_at  BIGINT NOT NULL,
+//		created_at    BIGINT NOT NULL,
+//		receive_count INTEGER NOT NULL DEFAULT 0
+//	);
+//	CREATE INDEX outbox_available_at ON outbox (available_at);
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+type txKey struct{}
+
+// WithTx returns a copy of ctx which carries tx. MessageWriters created
+// with it insert their Message within tx.
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx, if any.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// Topic inserts Messages into a table.
+type Topic struct {
+	DB      *sql.DB
+	Table   string
+	Dialect Dialect
+}
+
+// Ensure that Topic implements msg.Topic
+var _ msg.Topic = &Topic{}
+
+// NewTopic returns a Topic which inserts Messages into table.
+func NewTopic(db *sql.DB, table string, dialect Dialect) *Topic {
+	return &Topic{
+		DB:      db,
+		Table:   table,
+		Dialect: dialect,
+	}
+}
+
+// NewWriter returns a MessageWriter.
+// The MessageWriter may be used to insert a single Message, within the
+// transaction carried by ctx if there is one.
+func (t *Topic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &MessageWriter{
+		ctx:   ctx,
+		topic: t,
+
+		attributes: make(map[string][]string),
+		buf:        &bytes.Buffer{},
+	}
+}
+
+// MessageWriter is used to insert a single Message into a table.
+// Once all of the data has been written and closed, it may not be used again.
+type MessageWriter struct {
+	msg.MessageWriter
+
+	ctx   context.Context
+	topic *Topic
+
+	attributes msg.Attributes
+	delay      time.Duration
+	buf        *bytes.Buffer // internal buffer
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *MessageWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay sets a duration to delay the delivery of the Message by.
+func (w *MessageWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close inserts the Message into the table.
+// If the MessageWriter is already closed it will return an error.
+func (w *MessageWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+
+	attrs, err := json.Marshal(w.attributes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	q := w.topic.Dialect.query("INSERT INTO " + w.topic.Table +
+		" (attributes, body, available_at, created_at) VALUES (?, ?, ?, ?)")
+	args := []interface{}{string(attrs), w.buf.Bytes(), now.Add(w.delay).UnixMilli(), now.UnixMilli()}
+
+	if tx, ok := TxFromContext(w.ctx); ok {
+		_, err = tx.ExecContext(w.ctx, q, args...)
+	} else {
+		_, err = w.topic.DB.ExecContext(w.ctx, q, args...)
+	}
+	return err
+}
+
+// Write writes bytes to an internal buffer.
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
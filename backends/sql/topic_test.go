@@ -0,0 +1,63 @@
+package sql_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	msgsql "github.com/zerofox-oss/go-msg/backends/sql"
+)
+
+func publish(t *testing.T, ctx context.Context, topic msg.Topic, body string, delay time.Duration) {
+	t.Helper()
+
+	w := topic.NewWriter(ctx)
+	w.Attributes().Set("X-Request-Id", "1234")
+	w.SetDelay(delay)
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rows returns the number of rows in the outbox table.
+func rows(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM outbox").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTopic_WritesWithinTx(t *testing.T) {
+	db := open(t)
+	topic := msgsql.NewTopic(db, "outbox", msgsql.SQLite)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, msgsql.WithTx(context.Background(), tx), topic, "rolled back", 0)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := rows(t, db); n != 0 {
+		t.Fatalf("expected no rows after rollback, got %d", n)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish(t, msgsql.WithTx(context.Background(), tx), topic, "committed", 0)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := rows(t, db); n != 1 {
+		t.Fatalf("expected 1 row after commit, got %d", n)
+	}
+}
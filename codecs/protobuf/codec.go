@@ -0,0 +1,74 @@
+// Package protobuf provides a msg.Codec for Protocol Buffers messages.
+//
+// It can be used with msg.TypedTopic and msg.TypedReceiver, where the
+// type parameter is a generated message type such as *pb.Order.
+package protobuf
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/zerofox-oss/go-msg"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec is a msg.Codec which uses the Protocol Buffers wire format.
+type Codec struct{}
+
+// Ensure that Codec implements msg.Codec
+var _ msg.Codec = Codec{}
+
+// ContentType returns "application/x-protobuf".
+func (Codec) ContentType() string { return "application/x-protobuf" }
+
+// Encode writes the wire encoding of v to w.
+// v must be a proto.Message.
+func (Codec) Encode(w io.Writer, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Decode reads the wire encoding of a message from r into v.
+// v must be a proto.Message or a pointer to one, in which case a new
+// message is allocated if it is nil.
+func (Codec) Decode(r io.Reader, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		m, ok = allocate(v)
+	}
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, m)
+}
+
+// allocate returns the proto.Message pointed to by v, allocating it if
+// it is nil. This supports decoding into a *T where T is *pb.Message.
+func allocate(v interface{}) (proto.Message, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return nil, false
+	}
+
+	elem := rv.Elem()
+	if elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+	m, ok := elem.Interface().(proto.Message)
+	return m, ok
+}
@@ -0,0 +1,57 @@
+package protobuf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	topic := msg.NewTypedTopic[*wrapperspb.StringValue](&mem.Topic{C: c}, Codec{})
+
+	if err := topic.Publish(context.Background(), wrapperspb.String("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	m := <-c
+
+	if ct := m.Attributes.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("expected Content-Type application/x-protobuf, got %s", ct)
+	}
+
+	var actual string
+	r := msg.NewTypedReceiver(Codec{}, func(ctx context.Context, m *msg.Message, v *wrapperspb.StringValue) error {
+		actual = v.GetValue()
+		return nil
+	})
+	if err := r.Receive(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if actual != "hello world" {
+		t.Errorf("expected %q, got %q", "hello world", actual)
+	}
+}
+
+func TestCodec_NotAProtoMessage(t *testing.T) {
+	if err := (Codec{}).Encode(&bytes.Buffer{}, "hello"); err == nil {
+		t.Error("expected an error encoding a string")
+	}
+
+	r := msg.NewTypedReceiver(Codec{}, func(ctx context.Context, m *msg.Message, v string) error {
+		return nil
+	})
+	err := r.Receive(context.Background(), &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       &bytes.Buffer{},
+	})
+
+	var decodeErr *msg.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("expected a DecodeError, got %v", err)
+	}
+}
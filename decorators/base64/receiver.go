@@ -2,34 +2,49 @@ package base64
 
 import (
 	"context"
-	"encoding/base64"
 
 	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
+	"github.com/zerofox-oss/go-msg/decorators/internal/limit"
 )
 
 // Decoder wraps a msg.Receiver with base64 decoding functionality.
-// It only attempts to decode the Message.Body if Content-Transfer-Encoding
-// is set to base64.
-func Decoder(next msg.Receiver) msg.Receiver {
+// It only attempts to decode the Message.Body if a Variant of base64 is
+// the encoding applied last, in Content-Transfer-Encoding, and passes
+// next a copy of the Message without it. Line-wrapped bodies are decoded too.
+//
+// A Message whose decoded body exceeds the maximum size fails with a
+// permanent *msg.DecodeLimitError.
+func Decoder(next msg.Receiver, opts ...Option) msg.Receiver {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	limits := limit.Limits{MaxSize: options.MaxDecodedSize}
+
 	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if isBase64Encoded(m) {
-				m.Body = base64.NewDecoder(base64.StdEncoding, m.Body)
+			if !isBase64Encoded(m) {
+				return next.Receive(ctx, m)
 			}
 
-			return next.Receive(ctx, m)
+			variant := encodings.Last(m.Attributes, "Content-Transfer-Encoding")
+			encoded := &limit.Counter{R: m.Body}
+			r := limit.NewReader(variant, NewReader(encoded), encoded, limits)
+			decoded := msg.WithBody(m, r)
+			encodings.Pop(decoded.Attributes, "Content-Transfer-Encoding")
+			return r.Check(next.Receive(ctx, decoded))
 		}
 	})
 }
 
-// isBase64Encoded returns true if Content-Transfer-Encoding is set to
-// "base64" in the passed Message's Attributes.
-//
-// Note: MIMEHeader.Get() is used to fetch this value. In the case of a list of
-// values, .Get() returns the 0th value.
+// isBase64Encoded returns true if a Variant of base64 is the encoding
+// applied last to the body of the passed Message, in its
+// Content-Transfer-Encoding.
 func isBase64Encoded(m *msg.Message) bool {
-	return m.Attributes.Get("Content-Transfer-Encoding") == "base64"
+	key, name, err := encodings.Outer(m.Attributes)
+	return err == nil && key == "Content-Transfer-Encoding" && isVariant(name)
 }
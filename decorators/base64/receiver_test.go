@@ -3,6 +3,8 @@ package base64
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"errors"
 	"io/ioutil"
 	"testing"
 
@@ -136,3 +138,122 @@ func TestIsBase64Encoded_FalseContentTransferNotSet(t *testing.T) {
 		t.Error("Expected m not to be base64 encoded but got true.")
 	}
 }
+
+// Tests that a Message whose decoded body exceeds the maximum size fails
+// with a permanent DecodeLimitError.
+func TestDecoder_RejectsBodiesExceedingMaxSize(t *testing.T) {
+	r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		_, err := ioutil.ReadAll(m.Body)
+		return err
+	}), WithMaxDecodedSize(5))
+
+	// YWJjMTIz == abc123
+	m := &msg.Message{
+		Body:       bytes.NewBufferString("YWJjMTIz"),
+		Attributes: msg.Attributes{},
+	}
+	m.Attributes.Set("Content-Transfer-Encoding", "base64")
+
+	err := r.Receive(context.Background(), m)
+	var lerr *msg.DecodeLimitError
+	if !errors.As(err, &lerr) || lerr.MaxSize != 5 {
+		t.Errorf("expected a DecodeLimitError, got %v", err)
+	}
+	if msg.IsRetryable(err) {
+		t.Errorf("expected %v not to be retryable", err)
+	}
+}
+
+// Tests that every Variant is detected, including line-wrapped bodies.
+func TestDecoder_DecodesVariants(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		body    string
+	}{
+		{variant: StdEncoding, body: "+/8/AA=="},
+		{variant: URLEncoding, body: "-_8_AA=="},
+		{variant: RawStdEncoding, body: "+/8/AA"},
+		{variant: RawURLEncoding, body: "-_8_AA"},
+		{variant: StdEncoding, body: "+/8/\r\nAA==\r\n"},
+		{variant: RawURLEncoding, body: "-_8_\nAA\n"},
+	}
+
+	for _, tt := range tests {
+		m := &msg.Message{
+			Body:       bytes.NewBufferString(tt.body),
+			Attributes: msg.Attributes{},
+		}
+		m.Attributes.Set("Content-Transfer-Encoding", string(tt.variant))
+
+		var (
+			got      []byte
+			received msg.Attributes
+		)
+		r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			var err error
+			got, err = ioutil.ReadAll(m.Body)
+			received = m.Attributes
+			return err
+		}))
+		if err := r.Receive(context.Background(), m); err != nil {
+			t.Errorf("%s %q: %v", tt.variant, tt.body, err)
+			continue
+		}
+		if want := "\xfb\xff\x3f\x00"; string(got) != want {
+			t.Errorf("%s %q: expected %q, got %q", tt.variant, tt.body, want, got)
+		}
+		if v := received.Get("Content-Transfer-Encoding"); v != "" {
+			t.Errorf("expected Content-Transfer-Encoding to be removed, got %q", v)
+		}
+		if v := m.Attributes.Get("Content-Transfer-Encoding"); v != string(tt.variant) {
+			t.Errorf("expected the attributes of the received Message to be unchanged, got %q", v)
+		}
+	}
+}
+
+// Tests that padding is only accepted where it completes the last quantum
+// of the body.
+func TestNewReader_Padding(t *testing.T) {
+	valid := map[string]string{
+		"YQ==":       "a",
+		"YQ":         "a",
+		"YWI=":       "ab",
+		"YWI":        "ab",
+		"YWJj":       "abc",
+		"YQ=\r\n=\n": "a",
+	}
+	for in, want := range valid {
+		got, err := ioutil.ReadAll(NewReader(bytes.NewBufferString(in)))
+		if err != nil || string(got) != want {
+			t.Errorf("%q: expected %q, got %q, %v", in, want, got, err)
+		}
+	}
+
+	for _, in := range []string{"YQ==YQ==", "YQ=YQ", "Y=Q=", "YQ===", "YQ=", "YWJj=", "=YWJj"} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewBufferString(in)))
+		var cerr base64.CorruptInputError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%q: expected a CorruptInputError, got %v", in, err)
+		}
+	}
+}
+
+// Tests that a Message with padding in the middle of its body fails with
+// a permanent error.
+func TestDecoder_RejectsMisplacedPadding(t *testing.T) {
+	r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		_, err := ioutil.ReadAll(m.Body)
+		return err
+	}))
+
+	m := &msg.Message{
+		Body:       bytes.NewBufferString("YQ==YQ=="),
+		Attributes: msg.Attributes{},
+	}
+	m.Attributes.Set("Content-Transfer-Encoding", "base64")
+
+	err := r.Receive(context.Background(), m)
+	if err == nil || msg.IsRetryable(err) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
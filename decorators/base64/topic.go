@@ -1,20 +1,56 @@
 package base64
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
+	"io"
 	"sync"
 	"time"
 
 	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
 )
 
-// Encoder wraps a topic with another which base64-encodes a Message.
-func Encoder(next msg.Topic) msg.Topic {
+// Options configures the Encoder and the Decoder.
+type Options struct {
+	Variant        Variant
+	MaxDecodedSize int64
+}
+
+// Option is a functional option for the Encoder and the Decoder.
+type Option func(*Options)
+
+// WithVariant sets the Variant the Encoder uses. The default is
+// StdEncoding. The Decoder detects the Variant of each Message.
+func WithVariant(v Variant) Option {
+	return func(o *Options) {
+		o.Variant = v
+	}
+}
+
+// WithMaxDecodedSize sets the maximum number of bytes a Receiver can read
+// from a decoded Message.Body. The default is no limit.
+func WithMaxDecodedSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxDecodedSize = n
+	}
+}
+
+// Encoder wraps a topic with another which base64-encodes a Message,
+// and appends the name of the Variant it uses to its
+// Content-Transfer-Encoding.
+func Encoder(next msg.Topic, opts ...Option) msg.Topic {
+	options := &Options{Variant: StdEncoding}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		nextW := next.NewWriter(ctx)
 		return &encodeWriter{
-			Next: next.NewWriter(ctx),
+			Next:    nextW,
+			Writer:  base64.NewEncoder(options.Variant.encoding(), nextW),
+			variant: options.Variant,
 		}
 	})
 }
@@ -22,7 +58,14 @@ func Encoder(next msg.Topic) msg.Topic {
 type encodeWriter struct {
 	Next msg.MessageWriter
 
-	buf    bytes.Buffer
+	Writer  io.WriteCloser
+	variant Variant
+
+	// encoded is set once the variant was appended to
+	// Content-Transfer-Encoding, which happens before any bytes reach
+	// the next MessageWriter.
+	encoded bool
+
 	closed bool
 	mux    sync.Mutex
 }
@@ -36,8 +79,8 @@ func (w *encodeWriter) SetDelay(delay time.Duration) {
 	w.Next.SetDelay(delay)
 }
 
-// Close base64-encodes the contents of the buffer before
-// writing them to the next MessageWriter.
+// Close flushes any partially encoded block to the next MessageWriter
+// before closing it.
 func (w *encodeWriter) Close() error {
 	w.mux.Lock()
 	defer w.mux.Unlock()
@@ -47,20 +90,14 @@ func (w *encodeWriter) Close() error {
 	}
 	w.closed = true
 
-	attrs := *w.Attributes()
-	attrs["Content-Transfer-Encoding"] = []string{"base64"}
-
-	src := w.buf.Bytes()
-	buf := make([]byte, base64.StdEncoding.EncodedLen(len(src)))
-	base64.StdEncoding.Encode(buf, src)
-
-	if _, err := w.Next.Write(buf); err != nil {
+	w.encode()
+	if err := w.Writer.Close(); err != nil {
 		return err
 	}
 	return w.Next.Close()
 }
 
-// Write writes bytes to an internal buffer.
+// Write base64-encodes bytes into the next MessageWriter.
 func (w *encodeWriter) Write(b []byte) (int, error) {
 	w.mux.Lock()
 	defer w.mux.Unlock()
@@ -68,5 +105,14 @@ func (w *encodeWriter) Write(b []byte) (int, error) {
 	if w.closed {
 		return 0, msg.ErrClosedMessageWriter
 	}
-	return w.buf.Write(b)
+	w.encode()
+	return w.Writer.Write(b)
+}
+
+// encode pushes the variant onto Content-Transfer-Encoding, once.
+func (w *encodeWriter) encode() {
+	if !w.encoded {
+		encodings.Push(*w.Attributes(), "Content-Transfer-Encoding", string(w.variant))
+		w.encoded = true
+	}
 }
@@ -3,6 +3,7 @@ package base64
 import (
 	"context"
 	"testing"
+	"time"
 
 	msg "github.com/zerofox-oss/go-msg"
 	"github.com/zerofox-oss/go-msg/backends/mem"
@@ -59,3 +60,76 @@ func TestEncoder_SingleUse(t *testing.T) {
 		t.Errorf("expected ErrClosedMessageWriter, got %v", err)
 	}
 }
+
+// Tests that each Variant is used to encode a Message, and advertised
+// in its Content-Transfer-Encoding.
+func TestEncoder_Variants(t *testing.T) {
+	tests := []struct {
+		variant Variant
+		want    string
+	}{
+		{variant: StdEncoding, want: "+/8/"},
+		{variant: URLEncoding, want: "-_8_"},
+		{variant: RawStdEncoding, want: "+/8/"},
+		{variant: RawURLEncoding, want: "-_8_"},
+	}
+
+	for _, tt := range tests {
+		for _, body := range []string{"\xfb\xff\x3f", "\xfb\xff\x3f\x00"} {
+			c := make(chan *msg.Message, 1)
+			w := Encoder(&mem.Topic{C: c}, WithVariant(tt.variant)).NewWriter(context.Background())
+			w.Write([]byte(body))
+			w.Close()
+
+			m := <-c
+			if got := m.Attributes.Get("Content-Transfer-Encoding"); got != string(tt.variant) {
+				t.Errorf("expected Content-Transfer-Encoding %s, got %s", tt.variant, got)
+			}
+
+			want := tt.want
+			if len(body) == 4 {
+				want += "AA"
+				if tt.variant == StdEncoding || tt.variant == URLEncoding {
+					want += "=="
+				}
+			}
+			if got, _ := msg.DumpBody(m); string(got) != want {
+				t.Errorf("%s: expected %s, got %s", tt.variant, want, got)
+			}
+		}
+	}
+}
+
+// writerFunc is a MessageWriter which passes written bytes to a func.
+type writerFunc func([]byte)
+
+func (f writerFunc) Attributes() *msg.Attributes {
+	return &msg.Attributes{}
+}
+
+func (f writerFunc) SetDelay(time.Duration) {}
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	f(b)
+	return len(b), nil
+}
+
+func (f writerFunc) Close() error {
+	return nil
+}
+
+// Tests that the Encoder streams the encoded body to the next
+// MessageWriter rather than buffering it until Close.
+func TestEncoder_Streams(t *testing.T) {
+	var written int
+	next := msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return writerFunc(func(b []byte) { written += len(b) })
+	})
+
+	w := Encoder(next).NewWriter(context.Background())
+	w.Write(make([]byte, 3000))
+	if written != 4000 {
+		t.Errorf("expected 4000 bytes to be written before Close, got %d", written)
+	}
+	w.Close()
+}
@@ -0,0 +1,117 @@
+package base64
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// Variant is a variant of base64. Its value is the
+// Content-Transfer-Encoding of Messages encoded with it.
+type Variant string
+
+// Variants of base64, as defined by RFC 4648.
+const (
+	StdEncoding    Variant = "base64"
+	URLEncoding    Variant = "base64url"
+	RawStdEncoding Variant = "base64-raw"
+	RawURLEncoding Variant = "base64url-raw"
+)
+
+// Variants holds every Variant.
+var Variants = []Variant{StdEncoding, URLEncoding, RawStdEncoding, RawURLEncoding}
+
+func (v Variant) encoding() *base64.Encoding {
+	switch v {
+	case URLEncoding:
+		return base64.URLEncoding
+	case RawStdEncoding:
+		return base64.RawStdEncoding
+	case RawURLEncoding:
+		return base64.RawURLEncoding
+	}
+	return base64.StdEncoding
+}
+
+// isVariant returns true if name is the name of a Variant.
+func isVariant(name string) bool {
+	for _, v := range Variants {
+		if name == string(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewReader returns a Reader which decodes r, encoded with any Variant.
+// Line breaks in r are ignored, so line-wrapped input, as produced by
+// MIME encoders, is decoded as well.
+func NewReader(r io.Reader) io.Reader {
+	return base64.NewDecoder(base64.RawStdEncoding, &normalizer{r: r})
+}
+
+// normalizer translates the URL alphabet into the standard alphabet,
+// and drops padding, so that a single decoder decodes every Variant.
+// Line breaks are dropped as well.
+//
+// Padding is only accepted at the end of the input, where it must
+// complete the last quantum of four characters. Any other '=' fails
+// with a base64.CorruptInputError.
+type normalizer struct {
+	r io.Reader
+
+	offset int64 // of the next byte read from r
+	data   int64 // number of characters of the alphabet read so far
+	pad    int   // number of padding characters read so far
+}
+
+func (n *normalizer) Read(p []byte) (int, error) {
+	for {
+		c, err := n.r.Read(p)
+
+		i := 0
+		for _, b := range p[:c] {
+			offset := n.offset
+			n.offset++
+
+			switch b {
+			case '\r', '\n':
+				continue
+			case '=':
+				n.pad++
+				if n.pad > n.padding() {
+					return i, base64.CorruptInputError(offset)
+				}
+				continue
+			case '-':
+				b = '+'
+			case '_':
+				b = '/'
+			}
+			if n.pad > 0 {
+				return i, base64.CorruptInputError(offset)
+			}
+			n.data++
+			p[i] = b
+			i++
+		}
+		if err == io.EOF && n.pad > 0 && n.pad != n.padding() {
+			return i, base64.CorruptInputError(n.offset)
+		}
+
+		// Read must not return 0 bytes without an error, unless p is empty
+		if i > 0 || err != nil || len(p) == 0 {
+			return i, err
+		}
+	}
+}
+
+// padding returns how many padding characters complete the last quantum.
+func (n *normalizer) padding() int {
+	switch n.data % 4 {
+	case 2:
+		return 2
+	case 3:
+		return 1
+	}
+	return 0
+}
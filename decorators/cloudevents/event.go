@@ -0,0 +1,176 @@
+// Package cloudevents provides decorators which publish and receive
+// Messages as CloudEvents (https://cloudevents.io).
+//
+// In binary mode, the default, the context attributes of an event are
+// carried in attributes prefixed with "Ce-", e.g. Ce-Id and Ce-Type, and
+// the body of the Message is the data of the event, described by its
+// Content-Type. In structured mode, the whole event, context attributes
+// and data, is encoded as a JSON document in the body, with the
+// Content-Type application/cloudevents+json.
+package cloudevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// SpecVersion is the version of the CloudEvents specification
+// implemented by this package.
+const SpecVersion = "1.0"
+
+// Attributes which carry context attributes in binary mode.
+const (
+	AttributeID          = "Ce-Id"
+	AttributeSource      = "Ce-Source"
+	AttributeType        = "Ce-Type"
+	AttributeSpecVersion = "Ce-Specversion"
+	AttributeTime        = "Ce-Time"
+	AttributeSubject     = "Ce-Subject"
+	AttributeDataSchema  = "Ce-Dataschema"
+
+	// attributePrefix is the prefix of all context attributes, including
+	// extensions, in binary mode.
+	attributePrefix = "Ce-"
+)
+
+// contentTypeStructured is the Content-Type of events in structured mode.
+const contentTypeStructured = "application/cloudevents+json"
+
+// EventContext holds the context attributes of an event.
+type EventContext struct {
+	ID          string
+	Source      string
+	Type        string
+	SpecVersion string
+
+	// Optional attributes
+	Time            time.Time
+	Subject         string
+	DataContentType string
+	DataSchema      string
+
+	// Extensions holds extension attributes by their lowercase name.
+	Extensions map[string]string
+}
+
+// Validate returns a *ValidationError if a required context attribute
+// is missing, or if the event does not follow SpecVersion.
+func (ec *EventContext) Validate() error {
+	var missing []string
+	if ec.ID == "" {
+		missing = append(missing, "id")
+	}
+	if ec.Source == "" {
+		missing = append(missing, "source")
+	}
+	if ec.Type == "" {
+		missing = append(missing, "type")
+	}
+	if ec.SpecVersion == "" {
+		missing = append(missing, "specversion")
+	}
+	if len(missing) > 0 {
+		return &ValidationError{Reason: "missing required attributes " + strings.Join(missing, ", ")}
+	}
+	if ec.SpecVersion != SpecVersion {
+		return &ValidationError{Reason: fmt.Sprintf("unsupported specversion %q", ec.SpecVersion)}
+	}
+	return nil
+}
+
+// ValidationError is returned by Receivers for Messages which are not
+// valid events. Receivers wrap it with msg.Permanent, since the Message
+// cannot become valid by retrying.
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "cloudevents: invalid event: " + e.Reason
+}
+
+type eventContextKey struct{}
+
+// WithEventContext returns a copy of ctx which carries ec.
+//
+// The Topic decorator uses the attributes of ec which are set for
+// the events it publishes with ctx, and the Receiver decorator passes
+// the context of received events to the next Receiver this way.
+func WithEventContext(ctx context.Context, ec EventContext) context.Context {
+	return context.WithValue(ctx, eventContextKey{}, ec)
+}
+
+// EventContextFromContext returns the EventContext carried by ctx, if any.
+func EventContextFromContext(ctx context.Context) (EventContext, bool) {
+	ec, ok := ctx.Value(eventContextKey{}).(EventContext)
+	return ec, ok
+}
+
+// fromAttributes returns the context attributes of an event in binary mode.
+func fromAttributes(attrs msg.Attributes) (EventContext, error) {
+	ec := EventContext{
+		ID:              attrs.Get(AttributeID),
+		Source:          attrs.Get(AttributeSource),
+		Type:            attrs.Get(AttributeType),
+		SpecVersion:     attrs.Get(AttributeSpecVersion),
+		Subject:         attrs.Get(AttributeSubject),
+		DataContentType: attrs.Get("Content-Type"),
+		DataSchema:      attrs.Get(AttributeDataSchema),
+	}
+
+	if s := attrs.Get(AttributeTime); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return ec, &ValidationError{Reason: fmt.Sprintf("invalid time %q", s)}
+		}
+		ec.Time = t
+	}
+
+	for k := range attrs {
+		if !strings.HasPrefix(k, attributePrefix) || isContextAttribute(k) {
+			continue
+		}
+		if ec.Extensions == nil {
+			ec.Extensions = make(map[string]string)
+		}
+		ec.Extensions[strings.ToLower(strings.TrimPrefix(k, attributePrefix))] = attrs.Get(k)
+	}
+	return ec, nil
+}
+
+// setAttributes sets the context attributes of ec which are not already
+// set in attrs, for an event in binary mode.
+func setAttributes(attrs msg.Attributes, ec EventContext) {
+	set := func(k, v string) {
+		if v != "" && attrs.Get(k) == "" {
+			attrs.Set(k, v)
+		}
+	}
+
+	set(AttributeID, ec.ID)
+	set(AttributeSource, ec.Source)
+	set(AttributeType, ec.Type)
+	set(AttributeSpecVersion, ec.SpecVersion)
+	if !ec.Time.IsZero() {
+		set(AttributeTime, ec.Time.UTC().Format(time.RFC3339Nano))
+	}
+	set(AttributeSubject, ec.Subject)
+	set(AttributeDataSchema, ec.DataSchema)
+	set("Content-Type", ec.DataContentType)
+	for name, v := range ec.Extensions {
+		set(attributePrefix+name, v)
+	}
+}
+
+func isContextAttribute(k string) bool {
+	switch k {
+	case AttributeID, AttributeSource, AttributeType, AttributeSpecVersion,
+		AttributeTime, AttributeSubject, AttributeDataSchema:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Receiver wraps a msg.Receiver with another which validates and parses
+// events, in binary or structured mode.
+//
+// The context attributes of the event are passed to next through the
+// context, see EventContextFromContext, and the body of the Message is
+// the data of the event. For events in structured mode, the Content-Type
+// attribute is replaced with the datacontenttype of the event.
+//
+// Messages which are not valid events are rejected with a permanent
+// *ValidationError, without calling next.
+func Receiver(next msg.Receiver) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			var (
+				ec  EventContext
+				err error
+			)
+			if isStructured(m) {
+				ec, err = parseStructured(m)
+			} else {
+				ec, err = fromAttributes(m.Attributes)
+			}
+			if err == nil {
+				err = ec.Validate()
+			}
+			if err != nil {
+				return msg.Permanent(err)
+			}
+
+			return next.Receive(WithEventContext(ctx, ec), m)
+		}
+	})
+}
+
+// isStructured returns true if the Content-Type of m denotes an event in
+// structured mode.
+func isStructured(m *msg.Message) bool {
+	mt, _, err := mime.ParseMediaType(m.Attributes.Get("Content-Type"))
+	return err == nil && mt == contentTypeStructured
+}
+
+// parseStructured parses the event in the body of m, and replaces the
+// body with the data of the event.
+func parseStructured(m *msg.Message) (EventContext, error) {
+	var (
+		ec    EventContext
+		event map[string]json.RawMessage
+	)
+
+	b, err := io.ReadAll(m.Body)
+	if err != nil {
+		return ec, err
+	}
+	if err := json.Unmarshal(b, &event); err != nil {
+		return ec, &ValidationError{Reason: err.Error()}
+	}
+
+	str := func(name string) (string, error) {
+		raw, ok := event[name]
+		delete(event, name)
+		if !ok {
+			return "", nil
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", &ValidationError{Reason: fmt.Sprintf("%s is not a string", name)}
+		}
+		return s, nil
+	}
+
+	for name, v := range map[string]*string{
+		"id":              &ec.ID,
+		"source":          &ec.Source,
+		"type":            &ec.Type,
+		"specversion":     &ec.SpecVersion,
+		"subject":         &ec.Subject,
+		"datacontenttype": &ec.DataContentType,
+		"dataschema":      &ec.DataSchema,
+	} {
+		if *v, err = str(name); err != nil {
+			return ec, err
+		}
+	}
+
+	s, err := str("time")
+	if err != nil {
+		return ec, err
+	}
+	if s != "" {
+		if ec.Time, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			return ec, &ValidationError{Reason: fmt.Sprintf("invalid time %q", s)}
+		}
+	}
+
+	data, err := parseData(event, ec.DataContentType)
+	if err != nil {
+		return ec, err
+	}
+	delete(event, "data")
+	delete(event, "data_base64")
+
+	for name, raw := range event {
+		if ec.Extensions == nil {
+			ec.Extensions = make(map[string]string)
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw)
+		}
+		ec.Extensions[name] = s
+	}
+
+	m.Body = bytes.NewReader(data)
+	if ec.DataContentType != "" {
+		m.Attributes.Set("Content-Type", ec.DataContentType)
+	} else {
+		delete(m.Attributes, "Content-Type")
+	}
+	return ec, nil
+}
+
+// parseData returns the data of a structured mode event.
+func parseData(event map[string]json.RawMessage, contentType string) ([]byte, error) {
+	if raw, ok := event["data_base64"]; ok {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, &ValidationError{Reason: "data_base64 is not a string"}
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, &ValidationError{Reason: "invalid data_base64"}
+		}
+		return data, nil
+	}
+
+	raw, ok := event["data"]
+	if !ok {
+		return nil, nil
+	}
+	if !isJSON(contentType) && strings.HasPrefix(string(raw), `"`) {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return []byte(s), nil
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,202 @@
+package cloudevents
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	msg "github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+type receipt struct {
+	ec EventContext
+	m  *msg.Message
+}
+
+// receive passes m to a Receiver wrapped by Receiver and returns what the
+// wrapped Receiver got, if it was called.
+func receive(t *testing.T, m *msg.Message) (*receipt, error) {
+	t.Helper()
+
+	var got *receipt
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		ec, ok := EventContextFromContext(ctx)
+		if !ok {
+			t.Error("expected the context to carry an EventContext")
+		}
+		got = &receipt{ec: ec, m: m}
+		return nil
+	}))
+	return got, r.Receive(context.Background(), m)
+}
+
+func TestReceiver_BinaryMode(t *testing.T) {
+	m := msgtest.NewMessage(`{"id":1}`,
+		"Ce-Id", "1234",
+		"Ce-Source", "/orders",
+		"Ce-Type", "com.example.order.created",
+		"Ce-Specversion", "1.0",
+		"Ce-Time", "2024-01-02T03:04:05.5Z",
+		"Ce-Partitionkey", "1",
+		"Content-Type", "application/json",
+	)
+
+	got, err := receive(t, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := EventContext{
+		ID:              "1234",
+		Source:          "/orders",
+		Type:            "com.example.order.created",
+		SpecVersion:     "1.0",
+		Time:            time.Date(2024, 1, 2, 3, 4, 5, 5e8, time.UTC),
+		DataContentType: "application/json",
+		Extensions:      map[string]string{"partitionkey": "1"},
+	}
+	assertEventContext(t, got.ec, want)
+	msgtest.AssertBody(t, got.m, `{"id":1}`)
+}
+
+func TestReceiver_StructuredMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		data        string
+	}{
+		{
+			name:        "json",
+			body:        `{"datacontenttype":"application/json","data":{"id":1}}`,
+			contentType: "application/json",
+			data:        `{"id":1}`,
+		},
+		{
+			name:        "text",
+			body:        `{"datacontenttype":"text/plain","data":"hello world"}`,
+			contentType: "text/plain",
+			data:        "hello world",
+		},
+		{
+			name:        "binary",
+			body:        `{"datacontenttype":"application/octet-stream","data_base64":"aGVsbG8="}`,
+			contentType: "application/octet-stream",
+			data:        "hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"id":"1234","source":"/orders","type":"com.example.order.created","specversion":"1.0","partitionkey":"1",` + tt.body[1:]
+			got, err := receive(t, msgtest.NewMessage(body, "Content-Type", "application/cloudevents+json; charset=utf-8"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := EventContext{
+				ID:              "1234",
+				Source:          "/orders",
+				Type:            "com.example.order.created",
+				SpecVersion:     "1.0",
+				DataContentType: tt.contentType,
+				Extensions:      map[string]string{"partitionkey": "1"},
+			}
+			assertEventContext(t, got.ec, want)
+			msgtest.AssertAttribute(t, got.m, "Content-Type", tt.contentType)
+			msgtest.AssertBody(t, got.m, tt.data)
+		})
+	}
+}
+
+// Tests that invalid events are rejected with a permanent error.
+func TestReceiver_RejectsInvalidEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *msg.Message
+	}{
+		{
+			name: "not an event",
+			m:    msgtest.NewMessage("hello world"),
+		},
+		{
+			name: "missing type",
+			m:    msgtest.NewMessage("", "Ce-Id", "1", "Ce-Source", "/orders", "Ce-Specversion", "1.0"),
+		},
+		{
+			name: "unsupported specversion",
+			m:    msgtest.NewMessage("", "Ce-Id", "1", "Ce-Source", "/orders", "Ce-Type", "t", "Ce-Specversion", "0.3"),
+		},
+		{
+			name: "invalid time",
+			m:    msgtest.NewMessage("", "Ce-Id", "1", "Ce-Source", "/orders", "Ce-Type", "t", "Ce-Specversion", "1.0", "Ce-Time", "yesterday"),
+		},
+		{
+			name: "invalid json",
+			m:    msgtest.NewMessage("{", "Content-Type", "application/cloudevents+json"),
+		},
+		{
+			name: "invalid data_base64",
+			m: msgtest.NewMessage(`{"id":"1","source":"/orders","type":"t","specversion":"1.0","data_base64":"!"}`,
+				"Content-Type", "application/cloudevents+json"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := receive(t, tt.m)
+			if got != nil {
+				t.Error("expected the next Receiver not to be called")
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if msg.IsRetryable(err) {
+				t.Error("expected a permanent error")
+			}
+		})
+	}
+}
+
+// Tests that events written by Topic are received by Receiver, in either mode.
+func TestRoundTrip(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"binary":     nil,
+		"structured": {WithStructuredMode()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := make(chan *msg.Message, 1)
+			topic := Topic(&mem.Topic{C: c}, "/orders", "com.example.order.created", opts...)
+			write(t, context.Background(), topic, "hello world", "Content-Type", "text/plain")
+
+			got, err := receive(t, <-c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ec.Source != "/orders" || got.ec.Type != "com.example.order.created" || got.ec.Time.IsZero() {
+				t.Errorf("unexpected event context %+v", got.ec)
+			}
+			msgtest.AssertAttribute(t, got.m, "Content-Type", "text/plain")
+			msgtest.AssertBody(t, got.m, "hello world")
+		})
+	}
+}
+
+func assertEventContext(t *testing.T, got, want EventContext) {
+	t.Helper()
+
+	if !got.Time.Equal(want.Time) {
+		t.Errorf("expected time %s, got %s", want.Time, got.Time)
+	}
+	got.Time, want.Time = time.Time{}, time.Time{}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,212 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Options configures the Topic decorator.
+type Options struct {
+	Structured bool
+	NewID      func() string
+}
+
+// Option is a functional option for the Topic decorator.
+type Option func(*Options)
+
+// WithStructuredMode makes the Topic encode events in structured mode
+// rather than binary mode.
+func WithStructuredMode() Option {
+	return func(o *Options) {
+		o.Structured = true
+	}
+}
+
+// WithIDFunc sets the function which generates the id of events.
+// The default generates a random UUID.
+func WithIDFunc(f func() string) Option {
+	return func(o *Options) {
+		o.NewID = f
+	}
+}
+
+// Topic wraps a msg.Topic with another which publishes every Message
+// as an event with the given source and type.
+//
+// Context attributes which are already set, either on the attributes of
+// the MessageWriter or by an EventContext carried by the context passed
+// to NewWriter, take precedence over the ones filled in by Topic. The
+// id of the event is generated, and its time is the time it is written.
+func Topic(next msg.Topic, source, eventType string, opts ...Option) msg.Topic {
+	options := &Options{
+		NewID: newUUID,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		ec, _ := EventContextFromContext(ctx)
+		if ec.Source == "" {
+			ec.Source = source
+		}
+		if ec.Type == "" {
+			ec.Type = eventType
+		}
+
+		return &eventWriter{
+			Next:    next.NewWriter(ctx),
+			ec:      ec,
+			options: options,
+		}
+	})
+}
+
+type eventWriter struct {
+	Next msg.MessageWriter
+
+	ec      EventContext
+	options *Options
+
+	buf    bytes.Buffer
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *eventWriter) Attributes() *msg.Attributes {
+	return w.Next.Attributes()
+}
+
+func (w *eventWriter) SetDelay(delay time.Duration) {
+	w.Next.SetDelay(delay)
+}
+
+// Close fills in the context attributes of the event, then writes it
+// to the next MessageWriter.
+func (w *eventWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	attrs := *w.Attributes()
+	setAttributes(attrs, w.ec)
+	setAttributes(attrs, EventContext{
+		ID:          w.options.NewID(),
+		SpecVersion: SpecVersion,
+		Time:        time.Now(),
+	})
+
+	body := w.buf.Bytes()
+	if w.options.Structured {
+		var err error
+		if body, err = structure(attrs, body); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Next.Write(body); err != nil {
+		return err
+	}
+	return w.Next.Close()
+}
+
+// Write writes bytes to an internal buffer.
+func (w *eventWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(b)
+}
+
+// structure moves the context attributes of a binary mode event from
+// attrs into a structured mode event, and returns its JSON encoding.
+func structure(attrs msg.Attributes, data []byte) ([]byte, error) {
+	ec, err := fromAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	event := map[string]interface{}{
+		"id":          ec.ID,
+		"source":      ec.Source,
+		"type":        ec.Type,
+		"specversion": ec.SpecVersion,
+	}
+	if !ec.Time.IsZero() {
+		event["time"] = ec.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if ec.Subject != "" {
+		event["subject"] = ec.Subject
+	}
+	if ec.DataContentType != "" {
+		event["datacontenttype"] = ec.DataContentType
+	}
+	if ec.DataSchema != "" {
+		event["dataschema"] = ec.DataSchema
+	}
+	for name, v := range ec.Extensions {
+		event[name] = v
+	}
+
+	switch {
+	case len(data) == 0:
+	case isJSON(ec.DataContentType) && json.Valid(data):
+		event["data"] = json.RawMessage(data)
+	case utf8.Valid(data) && !isJSON(ec.DataContentType):
+		event["data"] = string(data)
+	default:
+		event["data_base64"] = base64.StdEncoding.EncodeToString(data)
+	}
+
+	for k := range attrs {
+		if strings.HasPrefix(k, attributePrefix) {
+			delete(attrs, k)
+		}
+	}
+	attrs.Set("Content-Type", contentTypeStructured)
+
+	return json.Marshal(event)
+}
+
+// isJSON returns true if contentType denotes JSON data. Data without a
+// content type is JSON, as in structured mode.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,161 @@
+package cloudevents
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	msg "github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+func write(t *testing.T, ctx context.Context, topic msg.Topic, body string, kv ...string) {
+	t.Helper()
+
+	w := topic.NewWriter(ctx)
+	for i := 0; i+1 < len(kv); i += 2 {
+		w.Attributes().Set(kv[i], kv[i+1])
+	}
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopic_BinaryMode(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	topic := Topic(&mem.Topic{C: c}, "/orders", "com.example.order.created", WithIDFunc(func() string { return "1234" }))
+
+	before := time.Now()
+	write(t, context.Background(), topic, `{"id":1}`, "Content-Type", "application/json")
+
+	m := <-c
+	msgtest.AssertAttribute(t, m, "Ce-Id", "1234")
+	msgtest.AssertAttribute(t, m, "Ce-Source", "/orders")
+	msgtest.AssertAttribute(t, m, "Ce-Type", "com.example.order.created")
+	msgtest.AssertAttribute(t, m, "Ce-Specversion", "1.0")
+	msgtest.AssertAttribute(t, m, "Content-Type", "application/json")
+	msgtest.AssertBody(t, m, `{"id":1}`)
+
+	ts, err := time.Parse(time.RFC3339Nano, m.Attributes.Get("Ce-Time"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Before(before) || ts.After(time.Now()) {
+		t.Errorf("expected the time the event was written, got %s", ts)
+	}
+}
+
+// Tests that context attributes which are already set are kept.
+func TestTopic_KeepsContextAttributes(t *testing.T) {
+	c := make(chan *msg.Message, 2)
+	topic := Topic(&mem.Topic{C: c}, "/orders", "com.example.order.created")
+
+	write(t, context.Background(), topic, "hello world", "Ce-Id", "abc", "Ce-Type", "com.example.order.cancelled")
+	m := <-c
+	msgtest.AssertAttribute(t, m, "Ce-Id", "abc")
+	msgtest.AssertAttribute(t, m, "Ce-Type", "com.example.order.cancelled")
+	msgtest.AssertAttribute(t, m, "Ce-Source", "/orders")
+
+	ctx := WithEventContext(context.Background(), EventContext{
+		Subject:    "order-1",
+		Extensions: map[string]string{"partitionkey": "1"},
+	})
+	write(t, ctx, topic, "hello world")
+	m = <-c
+	msgtest.AssertAttribute(t, m, "Ce-Subject", "order-1")
+	msgtest.AssertAttribute(t, m, "Ce-Partitionkey", "1")
+}
+
+func TestTopic_GeneratesUniqueIDs(t *testing.T) {
+	c := make(chan *msg.Message, 2)
+	topic := Topic(&mem.Topic{C: c}, "/orders", "com.example.order.created")
+
+	write(t, context.Background(), topic, "hello world")
+	write(t, context.Background(), topic, "hello world")
+	if a, b := (<-c).Attributes.Get("Ce-Id"), (<-c).Attributes.Get("Ce-Id"); a == "" || a == b {
+		t.Errorf("expected unique ids, got %q and %q", a, b)
+	}
+}
+
+func TestTopic_StructuredMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        map[string]interface{}
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"id":1}`,
+			want:        map[string]interface{}{"datacontenttype": "application/json", "data": map[string]interface{}{"id": float64(1)}},
+		},
+		{
+			name:        "text",
+			contentType: "text/plain",
+			body:        "hello world",
+			want:        map[string]interface{}{"datacontenttype": "text/plain", "data": "hello world"},
+		},
+		{
+			name:        "binary",
+			contentType: "application/octet-stream",
+			body:        "\xff\xfe",
+			want:        map[string]interface{}{"datacontenttype": "application/octet-stream", "data_base64": "//4="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := make(chan *msg.Message, 1)
+			topic := Topic(&mem.Topic{C: c}, "/orders", "com.example.order.created",
+				WithStructuredMode(), WithIDFunc(func() string { return "1234" }))
+
+			write(t, context.Background(), topic, tt.body, "Content-Type", tt.contentType, "X-Request-Id", "1")
+
+			m := <-c
+			msgtest.AssertAttribute(t, m, "Content-Type", "application/cloudevents+json")
+			msgtest.AssertAttribute(t, m, "X-Request-Id", "1")
+			msgtest.AssertAttribute(t, m, "Ce-Id", "")
+
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var event map[string]interface{}
+			if err := json.Unmarshal(body, &event); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]interface{}{
+				"id":          "1234",
+				"source":      "/orders",
+				"type":        "com.example.order.created",
+				"specversion": "1.0",
+			}
+			for k, v := range tt.want {
+				want[k] = v
+			}
+			for k, v := range want {
+				if got, _ := json.Marshal(event[k]); string(got) != string(mustMarshal(t, v)) {
+					t.Errorf("expected %s to be %s, got %s", k, mustMarshal(t, v), got)
+				}
+			}
+			if _, ok := event["time"]; !ok {
+				t.Error("expected the event to have a time")
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
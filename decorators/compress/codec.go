@@ -0,0 +1,74 @@
+// Package compress provides decorators which compress the body of
+// Messages with one of several codecs, and decompress it on receipt.
+//
+// The codec used to compress a Message is advertised by its
+// Content-Encoding attribute, so a single Decoder decompresses Messages
+// compressed with any registered Codec. Messages compressed by the lz4
+// decorators can be decompressed by the Decoder as well. To undo every
+// encoding applied to a Message, including base64, use the Decoder of
+// the encoding package instead.
+package compress
+
+import (
+	"io"
+	"sync"
+)
+
+// Level is a compression level. Each Codec maps it to one of its own
+// levels, so the same Level may trade speed for size differently with
+// different codecs.
+type Level int
+
+const (
+	// LevelDefault is the default level of the codec.
+	LevelDefault Level = iota
+	LevelFastest
+	LevelBetter
+	LevelBest
+)
+
+// A Codec compresses and decompresses streams.
+type Codec interface {
+	// Name is the value of the Content-Encoding attribute of Messages
+	// compressed with the Codec.
+	Name() string
+
+	// NewWriter returns a WriteCloser which compresses the bytes written
+	// to it into w. Close flushes any buffered data.
+	NewWriter(w io.Writer, level Level) (io.WriteCloser, error)
+
+	// NewReader returns a ReadCloser which decompresses r. Close releases
+	// any resources held by the reader, without closing r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var registry = struct {
+	codecs map[string]Codec
+	mux    sync.RWMutex
+}{
+	codecs: make(map[string]Codec),
+}
+
+// Register makes c available to Decoders under its name.
+// It replaces any Codec previously registered with the same name.
+func Register(c Codec) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	registry.codecs[c.Name()] = c
+}
+
+// Lookup returns the Codec registered with name, if any.
+func Lookup(name string) (Codec, bool) {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+
+	c, ok := registry.codecs[name]
+	return c, ok
+}
+
+func init() {
+	for _, c := range []Codec{Gzip, Zstd, Snappy, LZ4} {
+		Register(c)
+	}
+}
@@ -0,0 +1,109 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codecs registered by default.
+var (
+	Gzip   Codec = gzipCodec{}
+	Zstd   Codec = zstdCodec{}
+	Snappy Codec = snappyCodec{}
+	LZ4    Codec = lz4Codec{}
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) NewWriter(w io.Writer, level Level) (io.WriteCloser, error) {
+	l := gzip.DefaultCompression
+	switch level {
+	case LevelFastest:
+		l = gzip.BestSpeed
+	case LevelBetter:
+		l = 7
+	case LevelBest:
+		l = gzip.BestCompression
+	}
+	return gzip.NewWriterLevel(w, l)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (zstdCodec) NewWriter(w io.Writer, level Level) (io.WriteCloser, error) {
+	l := zstd.SpeedDefault
+	switch level {
+	case LevelFastest:
+		l = zstd.SpeedFastest
+	case LevelBetter:
+		l = zstd.SpeedBetterCompression
+	case LevelBest:
+		l = zstd.SpeedBestCompression
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(l), zstd.WithEncoderConcurrency(1))
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// snappyCodec uses the snappy framing format, which allows messages to be
+// decompressed as a stream.
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return "snappy" }
+
+func (snappyCodec) NewWriter(w io.Writer, level Level) (io.WriteCloser, error) {
+	opts := []s2.WriterOption{s2.WriterSnappyCompat(), s2.WriterConcurrency(1)}
+	switch level {
+	case LevelBetter:
+		opts = append(opts, s2.WriterBetterCompression())
+	case LevelBest:
+		opts = append(opts, s2.WriterBestCompression())
+	}
+	return s2.NewWriter(w, opts...), nil
+}
+
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(s2.NewReader(r)), nil
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string { return "lz4" }
+
+func (lz4Codec) NewWriter(w io.Writer, level Level) (io.WriteCloser, error) {
+	l := lz4.Fast
+	switch level {
+	case LevelBetter:
+		l = lz4.Level5
+	case LevelBest:
+		l = lz4.Level9
+	}
+
+	lw := lz4.NewWriter(w)
+	if err := lw.Apply(lz4.CompressionLevelOption(l)); err != nil {
+		return nil, err
+	}
+	return lw, nil
+}
+
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
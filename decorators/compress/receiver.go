@@ -0,0 +1,57 @@
+package compress
+
+import (
+	"context"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
+	"github.com/zerofox-oss/go-msg/decorators/internal/limit"
+)
+
+// Decoder wraps a msg.Receiver with decompression functionality.
+// It decompresses the Message.Body with the Codec registered under the
+// encoding applied last, if it is in Content-Encoding, and passes next a
+// copy of the Message without it. The Message is passed on unchanged if
+// another encoding was applied last or no Codec is registered for it.
+// This should be used in conjunction with the base64 decode decorator,
+// when the message queue doesn't support binary. In this case the base64
+// decorator should be the outermost decorator in order to run first.
+//
+// Bodies which cannot be decompressed, because they are corrupt, are
+// rejected with a permanent error, whether the Codec detects it up front
+// or while next reads the body.
+// A Message whose body exceeds the limits set by the options fails with
+// a permanent *msg.DecodeLimitError.
+func Decoder(next msg.Receiver, opts ...Option) msg.Receiver {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	limits := limit.Limits{
+		MaxSize:  options.MaxDecodedSize,
+		MaxRatio: options.MaxRatio,
+	}
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		key, name, err := encodings.Outer(m.Attributes)
+		if err != nil || key != "Content-Encoding" {
+			return next.Receive(ctx, m)
+		}
+		codec, ok := Lookup(name)
+		if !ok {
+			return next.Receive(ctx, m)
+		}
+
+		encoded := &limit.Counter{R: m.Body}
+		rc, err := codec.NewReader(encoded)
+		if err != nil {
+			return msg.Permanent(err)
+		}
+		defer rc.Close()
+
+		r := limit.NewReader(codec.Name(), rc, encoded, limits)
+		decoded := msg.WithBody(m, r)
+		encodings.Pop(decoded.Attributes, "Content-Encoding")
+		return r.Check(next.Receive(ctx, decoded))
+	})
+}
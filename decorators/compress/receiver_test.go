@@ -0,0 +1,150 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	msg "github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"github.com/zerofox-oss/go-msg/decorators/base64"
+	"github.com/zerofox-oss/go-msg/decorators/lz4"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+// Tests that the body of a Message is not changed if Content-Encoding
+// does not name a registered Codec.
+func TestDecoder_DoesNotModifyUnknownEncodings(t *testing.T) {
+	for _, enc := range []string{"", "br"} {
+		m := &msg.Message{
+			Attributes: msg.Attributes{},
+			Body:       bytes.NewBufferString("abc123"),
+		}
+		if enc != "" {
+			m.Attributes.Set("Content-Encoding", enc)
+		}
+
+		if got := receive(t, m); got != "abc123" {
+			t.Errorf("expected body abc123 with Content-Encoding %q, got %q", enc, got)
+		}
+	}
+}
+
+// Tests that Messages compressed by the lz4 decorator are decompressed.
+func TestDecoder_DecodesLz4Decorator(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	write(t, lz4.Encoder(&mem.Topic{C: c}), body)
+
+	if got := receive(t, <-c); got != body {
+		t.Errorf("expected the original body, got %q", got)
+	}
+}
+
+// Tests that a body which was compressed before being base64-encoded is
+// passed on for base64 to be decoded first, and that the attributes of
+// the received Message are left unchanged.
+func TestDecoder_FollowsEncodingOrder(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	write(t, Encoder(base64.Encoder(&mem.Topic{C: c}), Gzip), body)
+	m := <-c
+
+	if got := receive(t, m); got == body {
+		t.Error("expected the base64-encoded body to be passed on")
+	}
+
+	c = make(chan *msg.Message, 1)
+	write(t, base64.Encoder(Encoder(&mem.Topic{C: c}, Gzip)), body)
+	m = <-c
+
+	var attrs msg.Attributes
+	r := Decoder(base64.Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		attrs = m.Attributes
+		msgtest.AssertBody(t, m, body)
+		return nil
+	})))
+	if err := r.Receive(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 0 {
+		t.Errorf("expected every encoding to be removed, got %v", attrs)
+	}
+	if got := m.Attributes.Get("Msg-Encodings"); got != "base64, gzip" {
+		t.Errorf("expected the attributes of the received Message to be unchanged, got Msg-Encodings %q", got)
+	}
+}
+
+// Tests that corrupt bodies are rejected with a permanent error.
+func TestDecoder_RejectsCorruptBodies(t *testing.T) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("not gzip"),
+	}
+	m.Attributes.Set("Content-Encoding", "gzip")
+
+	r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		t.Error("expected the next Receiver not to be called")
+		return nil
+	}))
+	err := r.Receive(context.Background(), m)
+	if err == nil || msg.IsRetryable(err) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
+
+// Tests that a body which turns out to be corrupt while the next Receiver
+// reads it fails with a permanent error, whatever the Receiver returns.
+func TestDecoder_RejectsCorruptStreams(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(body))
+	zw.Close()
+
+	// corrupt the checksum at the end of the stream
+	b := buf.Bytes()
+	b[len(b)-5] ^= 0xff
+
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewReader(b),
+	}
+	m.Attributes.Set("Content-Encoding", "gzip")
+
+	r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		_, err := io.ReadAll(m.Body)
+		return err
+	}))
+	err := r.Receive(context.Background(), m)
+	if err == nil || msg.IsRetryable(err) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
+
+// Tests that a Message whose body exceeds the limits of the Decoder fails
+// with a permanent DecodeLimitError, with every Codec.
+func TestDecoder_RejectsDecompressionBombs(t *testing.T) {
+	for _, codec := range []Codec{Gzip, Zstd, Snappy, LZ4} {
+		for _, opt := range []Option{WithMaxDecodedSize(1024), WithMaxRatio(10)} {
+			c := make(chan *msg.Message, 1)
+			w := Encoder(&mem.Topic{C: c}, codec).NewWriter(context.Background())
+			w.Write(make([]byte, 1<<20))
+			w.Close()
+
+			r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				_, err := io.ReadAll(m.Body)
+				return err
+			}), opt)
+
+			err := r.Receive(context.Background(), <-c)
+			var lerr *msg.DecodeLimitError
+			if !errors.As(err, &lerr) || lerr.Encoding != codec.Name() {
+				t.Errorf("%s: expected a DecodeLimitError, got %v", codec.Name(), err)
+			}
+			if msg.IsRetryable(err) {
+				t.Errorf("%s: expected %v not to be retryable", codec.Name(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
+)
+
+// Options configures the Encoder and the Decoder.
+type Options struct {
+	Level   Level
+	MinSize int
+
+	MaxDecodedSize int64
+	MaxRatio       float64
+}
+
+// Option is a functional option for the Encoder and the Decoder.
+type Option func(*Options)
+
+// WithLevel sets the compression level. The default is LevelDefault.
+func WithLevel(l Level) Option {
+	return func(o *Options) {
+		o.Level = l
+	}
+}
+
+// WithMinSize sets the size in bytes below which the body of a Message
+// is sent uncompressed, since compressing small bodies costs more than
+// it saves. The default is 0, which compresses every non-empty body.
+func WithMinSize(n int) Option {
+	return func(o *Options) {
+		o.MinSize = n
+	}
+}
+
+// WithMaxDecodedSize sets the maximum number of bytes a Receiver can read
+// from a decompressed Message.Body. The default is no limit.
+func WithMaxDecodedSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxDecodedSize = n
+	}
+}
+
+// WithMaxRatio sets the maximum ratio of decompressed to compressed bytes
+// of a Message.Body. The default is no limit.
+func WithMaxRatio(r float64) Option {
+	return func(o *Options) {
+		o.MaxRatio = r
+	}
+}
+
+// Encoder wraps a topic with another which compresses a Message with
+// codec, and appends the name of codec to its Content-Encoding.
+// This should be used in conjunction with the base64 encoder
+// if the underlying message queue does not support binary (eg SQS)
+func Encoder(next msg.Topic, codec Codec, opts ...Option) msg.Topic {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		return &encodeWriter{
+			Next:    next.NewWriter(ctx),
+			codec:   codec,
+			options: options,
+		}
+	})
+}
+
+type encodeWriter struct {
+	Next msg.MessageWriter
+
+	codec   Codec
+	options *Options
+
+	// buf holds the body until it reaches the minimum size, then the
+	// body is compressed into Next by writer.
+	buf    bytes.Buffer
+	writer io.WriteCloser
+
+	closed bool
+	mux    sync.Mutex
+}
+
+// Attributes returns the attributes associated with the MessageWriter.
+func (w *encodeWriter) Attributes() *msg.Attributes {
+	return w.Next.Attributes()
+}
+
+func (w *encodeWriter) SetDelay(delay time.Duration) {
+	w.Next.SetDelay(delay)
+}
+
+// Close flushes the compressed body to the next MessageWriter, or
+// writes the body uncompressed if it is below the minimum size.
+func (w *encodeWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	if w.writer == nil {
+		if _, err := w.Next.Write(w.buf.Bytes()); err != nil {
+			return err
+		}
+		return w.Next.Close()
+	}
+
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	return w.Next.Close()
+}
+
+// Write writes bytes to the compressing writer, once the body reached
+// the minimum size, and to an internal buffer until then.
+func (w *encodeWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+
+	w.buf.Write(b)
+	if w.buf.Len() == 0 || w.buf.Len() < w.options.MinSize {
+		return len(b), nil
+	}
+
+	writer, err := w.codec.NewWriter(w.Next, w.options.Level)
+	if err != nil {
+		return 0, err
+	}
+	w.writer = writer
+
+	// pushed before anything reaches Next, so that the encodings Next
+	// applies are recorded after this one
+	encodings.Push(*w.Attributes(), "Content-Encoding", w.codec.Name())
+
+	if _, err := w.writer.Write(w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf.Reset()
+	return len(b), nil
+}
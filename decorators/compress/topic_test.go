@@ -0,0 +1,131 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	msg "github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+)
+
+var body = strings.Repeat("hello, world! ", 100)
+
+func write(t *testing.T, topic msg.Topic, body string) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	// write in chunks, as a streaming producer would
+	for i := 0; i < len(body); i += 100 {
+		end := i + 100
+		if end > len(body) {
+			end = len(body)
+		}
+		if _, err := w.Write([]byte(body[i:end])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that Messages compressed with each Codec, at each Level, are
+// decompressed by Decoder.
+func TestEncoder_RoundTrip(t *testing.T) {
+	for _, codec := range []Codec{Gzip, Zstd, Snappy, LZ4} {
+		for _, level := range []Level{LevelDefault, LevelFastest, LevelBetter, LevelBest} {
+			c := make(chan *msg.Message, 1)
+			write(t, Encoder(&mem.Topic{C: c}, codec, WithLevel(level)), body)
+
+			m := <-c
+			if got := m.Attributes.Get("Content-Encoding"); got != codec.Name() {
+				t.Fatalf("%s: expected Content-Encoding %q, got %q", codec.Name(), codec.Name(), got)
+			}
+
+			compressed, err := msg.DumpBody(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(compressed) >= len(body) {
+				t.Errorf("%s: expected the body to be compressed, got %d bytes", codec.Name(), len(compressed))
+			}
+
+			got := receive(t, m)
+			if got != body {
+				t.Errorf("%s at level %d: expected the original body, got %q", codec.Name(), level, got)
+			}
+		}
+	}
+}
+
+// Tests that bodies below the minimum size are sent uncompressed.
+func TestEncoder_MinSize(t *testing.T) {
+	c := make(chan *msg.Message, 2)
+	topic := Encoder(&mem.Topic{C: c}, Zstd, WithMinSize(len(body)))
+
+	write(t, topic, body[:len(body)-1])
+	m := <-c
+	if enc := m.Attributes.Get("Content-Encoding"); enc != "" {
+		t.Errorf("expected no Content-Encoding, got %q", enc)
+	}
+	if b, _ := msg.DumpBody(m); string(b) != body[:len(body)-1] {
+		t.Errorf("expected the body to be sent uncompressed, got %q", b)
+	}
+
+	write(t, topic, body)
+	m = <-c
+	if enc := m.Attributes.Get("Content-Encoding"); enc != "zstd" {
+		t.Errorf("expected Content-Encoding zstd, got %q", enc)
+	}
+	if got := receive(t, m); got != body {
+		t.Errorf("expected the original body, got %q", got)
+	}
+}
+
+// Tests that a compressing MessageWriter can be only be used once
+func TestEncoder_SingleUse(t *testing.T) {
+	c := make(chan *msg.Message, 1)
+	w := Encoder(&mem.Topic{C: c}, Gzip).NewWriter(context.Background())
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-c
+
+	if _, err := w.Write([]byte(body)); err != msg.ErrClosedMessageWriter {
+		t.Errorf("expected ErrClosedMessageWriter, got %v", err)
+	}
+	if err := w.Close(); err != msg.ErrClosedMessageWriter {
+		t.Errorf("expected ErrClosedMessageWriter, got %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"gzip", "zstd", "snappy", "lz4"} {
+		c, ok := Lookup(name)
+		if !ok || c.Name() != name {
+			t.Errorf("expected a Codec registered as %s", name)
+		}
+	}
+	if _, ok := Lookup("br"); ok {
+		t.Error("expected no Codec registered as br")
+	}
+}
+
+// receive returns the body of m, as it is passed by Decoder to the next
+// Receiver.
+func receive(t *testing.T, m *msg.Message) string {
+	t.Helper()
+
+	var got bytes.Buffer
+	r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		_, err := got.ReadFrom(m.Body)
+		return err
+	}))
+	if err := r.Receive(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	return got.String()
+}
@@ -0,0 +1,82 @@
+// Package encoding provides a decorator which undoes every encoding
+// applied to the body of a Message, in the reverse of the order its
+// publisher applied them in.
+//
+// Encoders append the name of the encoding they apply to the
+// Content-Encoding or Content-Transfer-Encoding attribute, so each of
+// them holds the ordered list of encodings applied to the body, and to
+// Msg-Encodings, which holds the order across both. The Decoder undoes
+// them last applied first, with the Codec registered under each name.
+// Messages without Msg-Encodings, such as those of other publishers,
+// are decoded as MIME prescribes: first the encodings in
+// Content-Transfer-Encoding, then those in Content-Encoding. The
+// compression codecs of the compress package are registered by
+// default, as well as every variant of base64.
+//
+// Using the Decoder rather than nesting the decoders of each encoding
+// by hand means the consumer does not have to mirror the order of the
+// publisher's encoders.
+package encoding
+
+import (
+	"io"
+	"sync"
+
+	"github.com/zerofox-oss/go-msg/decorators/base64"
+	"github.com/zerofox-oss/go-msg/decorators/compress"
+)
+
+// A Codec decodes streams. compress.Codec implements it.
+type Codec interface {
+	// Name is the name of the encoding in Content-Encoding or
+	// Content-Transfer-Encoding.
+	Name() string
+
+	// NewReader returns a ReadCloser which decodes r. Close releases
+	// any resources held by the reader, without closing r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var registry = struct {
+	codecs map[string]Codec
+	mux    sync.RWMutex
+}{
+	codecs: make(map[string]Codec),
+}
+
+// Register makes c available to Decoders under its name.
+// It replaces any Codec previously registered with the same name.
+func Register(c Codec) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	registry.codecs[c.Name()] = c
+}
+
+// Lookup returns the Codec registered with name, if any. Codecs
+// registered with compress.Register are found as well.
+func Lookup(name string) (Codec, bool) {
+	registry.mux.RLock()
+	c, ok := registry.codecs[name]
+	registry.mux.RUnlock()
+	if ok {
+		return c, true
+	}
+	return compress.Lookup(name)
+}
+
+func init() {
+	for _, v := range base64.Variants {
+		Register(base64Codec{variant: v})
+	}
+}
+
+type base64Codec struct {
+	variant base64.Variant
+}
+
+func (c base64Codec) Name() string { return string(c.variant) }
+
+func (base64Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(base64.NewReader(r)), nil
+}
@@ -0,0 +1,103 @@
+package encoding
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
+	"github.com/zerofox-oss/go-msg/decorators/internal/limit"
+)
+
+// Options configures the Decoder.
+type Options struct {
+	MaxDecodedSize int64
+	MaxRatio       float64
+}
+
+// Option is a functional option for the Decoder.
+type Option func(*Options)
+
+// WithMaxDecodedSize sets the maximum number of bytes a Receiver can read
+// from a decoded Message.Body. The default is no limit.
+func WithMaxDecodedSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxDecodedSize = n
+	}
+}
+
+// WithMaxRatio sets the maximum ratio of decoded bytes to the bytes of
+// the Message.Body as it was received. The default is no limit.
+func WithMaxRatio(r float64) Option {
+	return func(o *Options) {
+		o.MaxRatio = r
+	}
+}
+
+// Decoder wraps a msg.Receiver with another which undoes every encoding
+// listed in the Content-Transfer-Encoding and Content-Encoding of a
+// Message, last applied first, and passes next a Message without them.
+// The attributes of the Message it receives are left unchanged.
+//
+// A Message with an encoding for which no Codec is registered fails with
+// a permanent error, rather than reaching next with a body its
+// attributes do not describe, as does a Message whose Msg-Encodings
+// does not match its other attributes. A Message whose body exceeds the
+// limits set by the options fails with a permanent
+// *msg.DecodeLimitError.
+func Decoder(next msg.Receiver, opts ...Option) msg.Receiver {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	limits := limit.Limits{
+		MaxSize:  options.MaxDecodedSize,
+		MaxRatio: options.MaxRatio,
+	}
+
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		encoded := &limit.Counter{R: m.Body}
+		decoded := msg.WithBody(m, encoded)
+
+		var codecs []Codec
+		for {
+			key, name, err := encodings.Outer(decoded.Attributes)
+			if err != nil {
+				return msg.Permanent(err)
+			}
+			if key == "" {
+				break
+			}
+			c, ok := Lookup(name)
+			if !ok {
+				return msg.Permanent(fmt.Errorf("encoding: no codec registered for %s %q", key, name))
+			}
+			codecs = append(codecs, c)
+			encodings.Pop(decoded.Attributes, key)
+		}
+		if len(codecs) == 0 {
+			return next.Receive(ctx, m)
+		}
+
+		var (
+			body  io.Reader = encoded
+			names []string
+		)
+		for _, c := range codecs {
+			rc, err := c.NewReader(body)
+			if err != nil {
+				return msg.Permanent(err)
+			}
+			defer rc.Close()
+
+			body = rc
+			names = append(names, c.Name())
+		}
+
+		r := limit.NewReader(strings.Join(names, ", "), body, encoded, limits)
+		decoded.Body = r
+		return r.Check(next.Receive(ctx, decoded))
+	})
+}
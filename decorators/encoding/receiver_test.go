@@ -0,0 +1,202 @@
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	msg "github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
+	"github.com/zerofox-oss/go-msg/decorators/base64"
+	"github.com/zerofox-oss/go-msg/decorators/compress"
+	"github.com/zerofox-oss/go-msg/decorators/lz4"
+)
+
+var body = strings.Repeat("hello, world! ", 100)
+
+func write(t *testing.T, topic msg.Topic, body string) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	w.Write([]byte(body))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive passes m to a Receiver wrapped by Decoder, and returns the
+// Message the wrapped Receiver got, with its body read into a buffer.
+func receive(t *testing.T, m *msg.Message, opts ...Option) (*msg.Message, error) {
+	t.Helper()
+
+	var got *msg.Message
+	r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(m.Body); err != nil {
+			return err
+		}
+		got = &msg.Message{Attributes: m.Attributes, Body: &buf}
+		return nil
+	}), opts...)
+	return got, r.Receive(context.Background(), m)
+}
+
+// Tests that stacks of encodings are undone, whatever the order they
+// were applied in.
+func TestDecoder_UndoesEncodings(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    func(next msg.Topic) msg.Topic
+		encoding string
+		transfer string
+		order    string
+	}{
+		{
+			name:     "zstd then base64",
+			topic:    func(next msg.Topic) msg.Topic { return compress.Encoder(base64.Encoder(next), compress.Zstd) },
+			encoding: "zstd",
+			transfer: "base64",
+			order:    "zstd, base64",
+		},
+		{
+			name: "snappy then unpadded base64url",
+			topic: func(next msg.Topic) msg.Topic {
+				return compress.Encoder(base64.Encoder(next, base64.WithVariant(base64.RawURLEncoding)), compress.Snappy)
+			},
+			encoding: "snappy",
+			transfer: "base64url-raw",
+			order:    "snappy, base64url-raw",
+		},
+		{
+			name:     "lz4 then gzip",
+			topic:    func(next msg.Topic) msg.Topic { return lz4.Encoder(compress.Encoder(next, compress.Gzip)) },
+			encoding: "lz4, gzip",
+			order:    "lz4, gzip",
+		},
+		{
+			name: "gzip then lz4 then base64",
+			topic: func(next msg.Topic) msg.Topic {
+				return compress.Encoder(lz4.Encoder(base64.Encoder(next)), compress.Gzip)
+			},
+			encoding: "gzip, lz4",
+			transfer: "base64",
+			order:    "gzip, lz4, base64",
+		},
+		{
+			name:     "base64 then gzip",
+			topic:    func(next msg.Topic) msg.Topic { return base64.Encoder(compress.Encoder(next, compress.Gzip)) },
+			encoding: "gzip",
+			transfer: "base64",
+			order:    "base64, gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := make(chan *msg.Message, 1)
+			write(t, tt.topic(&mem.Topic{C: c}), body)
+
+			m := <-c
+			if got := m.Attributes.Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("expected Content-Encoding %q, got %q", tt.encoding, got)
+			}
+			if got := m.Attributes.Get("Content-Transfer-Encoding"); got != tt.transfer {
+				t.Errorf("expected Content-Transfer-Encoding %q, got %q", tt.transfer, got)
+			}
+			if got := m.Attributes.Get("Msg-Encodings"); got != tt.order {
+				t.Errorf("expected Msg-Encodings %q, got %q", tt.order, got)
+			}
+
+			got, err := receive(t, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := msg.DumpBody(got); string(b) != body {
+				t.Errorf("expected the original body, got %q", b)
+			}
+			for _, key := range []string{"Content-Encoding", "Content-Transfer-Encoding", "Msg-Encodings"} {
+				if v, ok := got.Attributes[key]; ok {
+					t.Errorf("expected %s to be removed, got %q", key, v)
+				}
+			}
+			if got := m.Attributes.Get("Msg-Encodings"); got != tt.order {
+				t.Errorf("expected the attributes of the received Message to be unchanged, got Msg-Encodings %q", got)
+			}
+		})
+	}
+}
+
+func TestDecoder_DoesNotModifyMessageWithoutEncodings(t *testing.T) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("abc123"),
+	}
+	m.Attributes.Set("Content-Encoding", "identity")
+
+	got, err := receive(t, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := msg.DumpBody(got); string(b) != "abc123" {
+		t.Errorf("expected body abc123, got %q", b)
+	}
+}
+
+// Tests that a Message with an unknown encoding is rejected with a
+// permanent error, rather than delivered partially decoded.
+func TestDecoder_RejectsUnknownEncodings(t *testing.T) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("YWJjMTIz"),
+	}
+	m.Attributes.Set("Content-Encoding", "br")
+	m.Attributes.Set("Content-Transfer-Encoding", "base64")
+
+	got, err := receive(t, m)
+	if got != nil {
+		t.Error("expected the next Receiver not to be called")
+	}
+	if err == nil || msg.IsRetryable(err) {
+		t.Errorf("expected a permanent error, got %v", err)
+	}
+}
+
+// Tests that a Message whose Msg-Encodings does not match its other
+// attributes is rejected with a permanent error.
+func TestDecoder_RejectsMismatchedOrder(t *testing.T) {
+	for _, order := range []string{"gzip", "base64, gzip, lz4", "base64, lz4"} {
+		m := &msg.Message{
+			Attributes: msg.Attributes{},
+			Body:       bytes.NewBufferString("H4sIAAAAAAAA/w=="),
+		}
+		m.Attributes.Set("Content-Encoding", "gzip")
+		m.Attributes.Set("Content-Transfer-Encoding", "base64")
+		m.Attributes.Set("Msg-Encodings", order)
+
+		got, err := receive(t, m)
+		if got != nil {
+			t.Errorf("%q: expected the next Receiver not to be called", order)
+		}
+		if err == nil || msg.IsRetryable(err) {
+			t.Errorf("%q: expected a permanent error, got %v", order, err)
+		}
+	}
+}
+
+func TestDecoder_RejectsDecompressionBombs(t *testing.T) {
+	for _, opt := range []Option{WithMaxDecodedSize(1024), WithMaxRatio(100)} {
+		c := make(chan *msg.Message, 1)
+		write(t, compress.Encoder(base64.Encoder(&mem.Topic{C: c}), compress.Zstd), string(make([]byte, 1<<20)))
+
+		_, err := receive(t, <-c, opt)
+		var lerr *msg.DecodeLimitError
+		if !errors.As(err, &lerr) || lerr.Encoding != "base64, zstd" {
+			t.Errorf("expected a DecodeLimitError, got %v", err)
+		}
+		if msg.IsRetryable(err) {
+			t.Errorf("expected %v not to be retryable", err)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Package filter provides SNS-compatible subscription filter policies and a
+// decorator which only passes matching Messages on to a Receiver.
+//
+// A policy is a JSON object whose keys are attribute names and whose values
+// are arrays of conditions. A Message matches a policy if, for every key,
+// at least one of the conditions matches the attribute:
+//
+//	{
+//		"store": ["example_corp"],
+//		"event": [{"anything-but": "order_cancelled"}],
+//		"price_usd": [{"numeric": [">=", 100]}],
+//		"customer_interests": [{"prefix": "rugby"}, "football"],
+//		"encrypted": [{"exists": false}]
+//	}
+//
+// The supported conditions are exact string and numeric matches, "prefix",
+// "suffix", "equals-ignore-case", "anything-but", "numeric" and "exists".
+// A top-level "$or" key holding an array of policies matches if any of them
+// matches. See https://docs.aws.amazon.com/sns/latest/dg/sns-subscription-filter-policies.html
+//
+// Attribute names are matched case insensitively, following msg.Attributes.
+// If an attribute has multiple values, a condition matches if any of the
+// values matches.
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Policy is a parsed filter policy.
+type Policy struct {
+	keys map[string][]condition
+	or   []*Policy
+}
+
+// condition reports whether the values of an attribute satisfy it.
+// values is nil if the attribute is not present.
+type condition func(values []string) bool
+
+// ParsePolicy parses a JSON filter policy.
+func ParsePolicy(b []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := p.UnmarshalJSON(b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UnmarshalJSON parses a JSON filter policy into p.
+func (p *Policy) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("filter: policy must be a JSON object: %w", err)
+	}
+
+	p.keys = make(map[string][]condition, len(raw))
+	p.or = nil
+
+	for key, value := range raw {
+		if key == "$or" {
+			var policies []*Policy
+			if err := json.Unmarshal(value, &policies); err != nil {
+				return fmt.Errorf("filter: $or must be an array of policies: %w", err)
+			}
+			p.or = policies
+			continue
+		}
+
+		conditions, err := parseConditions(value)
+		if err != nil {
+			return fmt.Errorf("filter: invalid conditions for %q: %w", key, err)
+		}
+		p.keys[key] = conditions
+	}
+	return nil
+}
+
+// Match reports whether attrs satisfy the policy.
+func (p *Policy) Match(attrs msg.Attributes) bool {
+	for key, conditions := range p.keys {
+		values := textproto.MIMEHeader(attrs).Values(key)
+		if !matchAny(conditions, values) {
+			return false
+		}
+	}
+
+	if len(p.or) == 0 {
+		return true
+	}
+	for _, or := range p.or {
+		if or.Match(attrs) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(conditions []condition, values []string) bool {
+	for _, c := range conditions {
+		if c(values) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyValue returns a condition which matches if f matches any value
+// of a present attribute.
+func anyValue(f func(string) bool) condition {
+	return func(values []string) bool {
+		for _, v := range values {
+			if f(v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func parseConditions(b []byte) ([]condition, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("conditions must be an array: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("conditions must not be empty")
+	}
+
+	conditions := make([]condition, 0, len(raw))
+	for _, r := range raw {
+		c, err := parseCondition(r)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, nil
+}
+
+func parseCondition(b json.RawMessage) (condition, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	switch b[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, err
+		}
+		return anyValue(func(v string) bool { return v == s }), nil
+
+	case '{':
+		return parseOperator(b)
+
+	default:
+		n, err := parseNumber(b)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported condition %s", b)
+		}
+		return anyValue(func(v string) bool {
+			f, err := strconv.ParseFloat(v, 64)
+			return err == nil && f == n
+		}), nil
+	}
+}
+
+func parseNumber(b json.RawMessage) (float64, error) {
+	var n float64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func parseOperator(b json.RawMessage) (condition, error) {
+	var op map[string]json.RawMessage
+	if err := json.Unmarshal(b, &op); err != nil {
+		return nil, err
+	}
+	if len(op) != 1 {
+		return nil, fmt.Errorf("condition must have exactly one operator: %s", b)
+	}
+
+	// op has exactly one entry
+	var (
+		name string
+		arg  json.RawMessage
+	)
+	for name, arg = range op {
+	}
+
+	switch name {
+	case "prefix":
+		return parseStringOperator(arg, strings.HasPrefix)
+	case "suffix":
+		return parseStringOperator(arg, strings.HasSuffix)
+	case "equals-ignore-case":
+		return parseStringOperator(arg, strings.EqualFold)
+	case "exists":
+		var exists bool
+		if err := json.Unmarshal(arg, &exists); err != nil {
+			return nil, fmt.Errorf("exists must be a boolean: %w", err)
+		}
+		return func(values []string) bool {
+			return (len(values) > 0) == exists
+		}, nil
+	case "numeric":
+		return parseNumeric(arg)
+	case "anything-but":
+		return parseAnythingBut(arg)
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", name)
+	}
+}
+
+func parseStringOperator(arg json.RawMessage, f func(v, s string) bool) (condition, error) {
+	var s string
+	if err := json.Unmarshal(arg, &s); err != nil {
+		return nil, fmt.Errorf("operator requires a string: %w", err)
+	}
+	return anyValue(func(v string) bool { return f(v, s) }), nil
+}
+
+// parseNumeric parses a numeric range such as [">", 0, "<=", 100].
+func parseNumeric(arg json.RawMessage) (condition, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(arg, &raw); err != nil {
+		return nil, fmt.Errorf("numeric must be an array: %w", err)
+	}
+	if len(raw) == 0 || len(raw)%2 != 0 || len(raw) > 4 {
+		return nil, fmt.Errorf("numeric must contain one or two comparisons")
+	}
+
+	var comparisons []func(float64) bool
+	for i := 0; i < len(raw); i += 2 {
+		var op string
+		if err := json.Unmarshal(raw[i], &op); err != nil {
+			return nil, fmt.Errorf("numeric operator must be a string: %w", err)
+		}
+		n, err := parseNumber(raw[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("numeric operand must be a number: %w", err)
+		}
+
+		var cmp func(float64) bool
+		switch op {
+		case "=":
+			cmp = func(f float64) bool { return f == n }
+		case "<":
+			cmp = func(f float64) bool { return f < n }
+		case "<=":
+			cmp = func(f float64) bool { return f <= n }
+		case ">":
+			cmp = func(f float64) bool { return f > n }
+		case ">=":
+			cmp = func(f float64) bool { return f >= n }
+		default:
+			return nil, fmt.Errorf("unsupported numeric operator %q", op)
+		}
+		comparisons = append(comparisons, cmp)
+	}
+
+	return anyValue(func(v string) bool {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		for _, cmp := range comparisons {
+			if !cmp(f) {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// parseAnythingBut parses an anything-but condition, whose argument is a
+// string, a number, an array of either, or a prefix or suffix operator.
+// It only matches attributes which are present.
+func parseAnythingBut(arg json.RawMessage) (condition, error) {
+	arg = bytes.TrimSpace(arg)
+	if len(arg) == 0 {
+		return nil, fmt.Errorf("anything-but requires an argument")
+	}
+
+	var excluded condition
+	switch arg[0] {
+	case '[':
+		var raw []json.RawMessage
+		if err := json.Unmarshal(arg, &raw); err != nil {
+			return nil, err
+		}
+		conditions := make([]condition, 0, len(raw))
+		for _, r := range raw {
+			r = bytes.TrimSpace(r)
+			if len(r) > 0 && r[0] == '{' {
+				return nil, fmt.Errorf("anything-but arrays may only contain strings and numbers")
+			}
+			c, err := parseCondition(r)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, c)
+		}
+		excluded = func(values []string) bool { return matchAny(conditions, values) }
+
+	case '{':
+		var op map[string]json.RawMessage
+		if err := json.Unmarshal(arg, &op); err != nil {
+			return nil, err
+		}
+		_, prefix := op["prefix"]
+		_, suffix := op["suffix"]
+		if len(op) != 1 || !(prefix || suffix) {
+			return nil, fmt.Errorf("anything-but only supports the prefix and suffix operators")
+		}
+		c, err := parseOperator(arg)
+		if err != nil {
+			return nil, err
+		}
+		excluded = c
+
+	default:
+		c, err := parseCondition(arg)
+		if err != nil {
+			return nil, err
+		}
+		excluded = c
+	}
+
+	return func(values []string) bool {
+		if len(values) == 0 {
+			return false
+		}
+		for _, v := range values {
+			if !excluded([]string{v}) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
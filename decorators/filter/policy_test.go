@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"net/textproto"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// attrs builds Attributes from key-value pairs. Repeated keys have
+// multiple values.
+func attrs(kv ...string) msg.Attributes {
+	a := msg.Attributes{}
+	for i := 0; i < len(kv); i += 2 {
+		textproto.MIMEHeader(a).Add(kv[i], kv[i+1])
+	}
+	return a
+}
+
+func TestPolicy_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		attrs    msg.Attributes
+		expected bool
+	}{
+		{"exact string", `{"store": ["example_corp"]}`, attrs("store", "example_corp"), true},
+		{"exact string mismatch", `{"store": ["example_corp"]}`, attrs("store", "other_corp"), false},
+		{"exact string missing", `{"store": ["example_corp"]}`, attrs(), false},
+		{"key is case insensitive", `{"Store": ["example_corp"]}`, attrs("store", "example_corp"), true},
+		{"or within key", `{"store": ["a", "b"]}`, attrs("store", "b"), true},
+		{"and across keys", `{"store": ["a"], "event": ["b"]}`, attrs("store", "a"), false},
+		{"multiple values", `{"sport": ["rugby"]}`, attrs("sport", "football", "sport", "rugby"), true},
+		{"exact number", `{"price": [100]}`, attrs("price", "100.0"), true},
+		{"exact number mismatch", `{"price": [100]}`, attrs("price", "101"), false},
+		{"prefix", `{"sport": [{"prefix": "rug"}]}`, attrs("sport", "rugby"), true},
+		{"prefix mismatch", `{"sport": [{"prefix": "foot"}]}`, attrs("sport", "rugby"), false},
+		{"suffix", `{"file": [{"suffix": ".png"}]}`, attrs("file", "cat.png"), true},
+		{"equals-ignore-case", `{"env": [{"equals-ignore-case": "PROD"}]}`, attrs("env", "prod"), true},
+		{"anything-but string", `{"event": [{"anything-but": "cancelled"}]}`, attrs("event", "placed"), true},
+		{"anything-but string excluded", `{"event": [{"anything-but": "cancelled"}]}`, attrs("event", "cancelled"), false},
+		{"anything-but missing", `{"event": [{"anything-but": "cancelled"}]}`, attrs(), false},
+		{"anything-but list", `{"event": [{"anything-but": ["a", "b"]}]}`, attrs("event", "b"), false},
+		{"anything-but number", `{"count": [{"anything-but": 0}]}`, attrs("count", "1"), true},
+		{"anything-but prefix", `{"event": [{"anything-but": {"prefix": "order_"}}]}`, attrs("event", "order_placed"), false},
+		{"numeric range", `{"price": [{"numeric": [">", 0, "<=", 150]}]}`, attrs("price", "150"), true},
+		{"numeric range outside", `{"price": [{"numeric": [">", 0, "<=", 150]}]}`, attrs("price", "151"), false},
+		{"numeric equals", `{"price": [{"numeric": ["=", 3.5]}]}`, attrs("price", "3.5"), true},
+		{"numeric not a number", `{"price": [{"numeric": [">=", 0]}]}`, attrs("price", "free"), false},
+		{"exists", `{"store": [{"exists": true}]}`, attrs("store", "x"), true},
+		{"exists missing", `{"store": [{"exists": true}]}`, attrs(), false},
+		{"not exists", `{"store": [{"exists": false}]}`, attrs(), true},
+		{"not exists present", `{"store": [{"exists": false}]}`, attrs("store", "x"), false},
+		{"$or", `{"$or": [{"a": ["1"]}, {"b": ["2"]}]}`, attrs("b", "2"), true},
+		{"$or mismatch", `{"$or": [{"a": ["1"]}, {"b": ["2"]}]}`, attrs("c", "3"), false},
+		{"$or with keys", `{"c": ["3"], "$or": [{"a": ["1"]}, {"b": ["2"]}]}`, attrs("a", "1"), false},
+		{"empty policy", `{}`, attrs("a", "1"), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ParsePolicy([]byte(tc.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := p.Match(tc.attrs); actual != tc.expected {
+				t.Errorf("Match(%v) = %v, want %v", tc.attrs, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	policies := []string{
+		`[]`,
+		`{"store": "example_corp"}`,
+		`{"store": []}`,
+		`{"store": [true]}`,
+		`{"store": [{"unknown": "x"}]}`,
+		`{"store": [{"prefix": "a", "suffix": "b"}]}`,
+		`{"store": [{"prefix": 1}]}`,
+		`{"store": [{"exists": "yes"}]}`,
+		`{"price": [{"numeric": [">"]}]}`,
+		`{"price": [{"numeric": ["~", 1]}]}`,
+		`{"price": [{"numeric": [">", "1"]}]}`,
+		`{"event": [{"anything-but": {"exists": true}}]}`,
+		`{"event": [{"anything-but": [{"prefix": "a"}]}]}`,
+		`{"$or": {"a": ["1"]}}`,
+	}
+
+	for _, policy := range policies {
+		if _, err := ParsePolicy([]byte(policy)); err == nil {
+			t.Errorf("expected an error parsing %s", policy)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package filter
+
+import (
+	"context"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Receiver wraps a msg.Receiver so that it only receives Messages whose
+// Attributes match the policy. Messages which do not match are
+// acknowledged without being passed to next.
+func Receiver(next msg.Receiver, policy *Policy) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		if !policy.Match(m.Attributes) {
+			return nil
+		}
+		return next.Receive(ctx, m)
+	})
+}
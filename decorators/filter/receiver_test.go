@@ -0,0 +1,46 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Tests that the Receiver only passes matching messages to the next
+// Receiver, and acknowledges the others.
+func TestReceiver(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"event": ["order_placed"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	r := Receiver(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		calls++
+		return nil
+	}), policy)
+
+	matching := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("hello"),
+	}
+	matching.Attributes.Set("Event", "order_placed")
+
+	other := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString("hello"),
+	}
+	other.Attributes.Set("Event", "order_cancelled")
+
+	for _, m := range []*msg.Message{matching, other} {
+		if err := r.Receive(context.Background(), m); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expected next Receiver to be called once, got %d", calls)
+	}
+}
@@ -0,0 +1,139 @@
+// Package encodings reads and writes the ordered lists of encodings
+// applied to the body of a Message, which are carried by the
+// Content-Encoding and Content-Transfer-Encoding attributes.
+//
+// A list is written as a single comma-separated value, in the order
+// the encodings were applied, since not every backend preserves
+// attributes with several values. It is read from either form.
+//
+// The two attributes alone do not tell which was applied first when
+// both are set, so encoders also push every encoding onto Order, which
+// holds the whole sequence.
+package encodings
+
+import (
+	"errors"
+	"net/textproto"
+	"strings"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Order is the attribute holding every encoding in Content-Encoding and
+// Content-Transfer-Encoding, in the order they were applied.
+const Order = "Msg-Encodings"
+
+// Keys are the attributes which list encodings. Messages without Order
+// are assumed to follow MIME, where the transfer encodings are applied
+// after the content encodings, so Keys are in the order they are undone.
+var Keys = []string{"Content-Transfer-Encoding", "Content-Encoding"}
+
+// ErrOrder is returned for Messages whose Order does not match their
+// Content-Encoding and Content-Transfer-Encoding.
+var ErrOrder = errors.New("encodings: " + Order + " does not match Content-Encoding and Content-Transfer-Encoding")
+
+// List returns the encodings in the attribute key of attrs, in the order
+// they were applied. Identity encodings are omitted.
+func List(attrs msg.Attributes, key string) []string {
+	var list []string
+	for _, v := range attrs[textproto.CanonicalMIMEHeaderKey(key)] {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !isIdentity(name) {
+				list = append(list, name)
+			}
+		}
+	}
+	return list
+}
+
+// Set replaces the encodings in the attribute key of attrs with list,
+// and removes the attribute if list is empty.
+func Set(attrs msg.Attributes, key string, list []string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if len(list) == 0 {
+		delete(attrs, key)
+		return
+	}
+	attrs[key] = []string{strings.Join(list, ", ")}
+}
+
+// Append appends name to the encodings in the attribute key of attrs.
+func Append(attrs msg.Attributes, key, name string) {
+	Set(attrs, key, append(List(attrs, key), name))
+}
+
+// Last returns the encoding applied last in the attribute key of attrs,
+// or "" if there is none.
+func Last(attrs msg.Attributes, key string) string {
+	list := List(attrs, key)
+	if len(list) == 0 {
+		return ""
+	}
+	return list[len(list)-1]
+}
+
+// Push records that name was applied to the body, appending it to the
+// attribute key of attrs and to Order.
+func Push(attrs msg.Attributes, key, name string) {
+	Append(attrs, key, name)
+	Append(attrs, Order, name)
+}
+
+// Outer returns the encoding applied last to the body, and the attribute
+// of Keys which lists it. key is "" if no encoding was applied.
+//
+// If Order is set, it names the encoding, which must also be the one
+// applied last in one of Keys, and the number of encodings it holds must
+// match theirs; otherwise Outer returns ErrOrder.
+func Outer(attrs msg.Attributes) (key, name string, err error) {
+	order := List(attrs, Order)
+	if len(order) == 0 {
+		for _, key := range Keys {
+			if name := Last(attrs, key); name != "" {
+				return key, name, nil
+			}
+		}
+		return "", "", nil
+	}
+
+	n := 0
+	for _, key := range Keys {
+		n += len(List(attrs, key))
+	}
+	if n != len(order) {
+		return "", "", ErrOrder
+	}
+
+	name = order[len(order)-1]
+	for _, key := range Keys {
+		if Last(attrs, key) == name {
+			return key, name, nil
+		}
+	}
+	return "", "", ErrOrder
+}
+
+// Pop removes the encoding applied last from the attribute key of attrs,
+// and from Order if key is one of Keys.
+func Pop(attrs msg.Attributes, key string) {
+	list := List(attrs, key)
+	if len(list) > 0 {
+		Set(attrs, key, list[:len(list)-1])
+	}
+	for _, k := range Keys {
+		if textproto.CanonicalMIMEHeaderKey(key) == k {
+			Pop(attrs, Order)
+		}
+	}
+}
+
+// isIdentity returns true if name is an encoding which leaves the body
+// unchanged.
+func isIdentity(name string) bool {
+	switch name {
+	case "", "identity", "7bit", "8bit", "binary":
+		return true
+	}
+	return false
+}
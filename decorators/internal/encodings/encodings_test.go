@@ -0,0 +1,101 @@
+package encodings
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{values: nil, want: nil},
+		{values: []string{"gzip"}, want: []string{"gzip"}},
+		{values: []string{"lz4, GZIP"}, want: []string{"lz4", "gzip"}},
+		{values: []string{"lz4", "gzip,zstd"}, want: []string{"lz4", "gzip", "zstd"}},
+		{values: []string{"identity, lz4, 8bit"}, want: []string{"lz4"}},
+	}
+
+	for _, tt := range tests {
+		attrs := msg.Attributes{"Content-Encoding": tt.values}
+		if got := List(attrs, "content-encoding"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.values, tt.want, got)
+		}
+	}
+}
+
+func TestAppendPop(t *testing.T) {
+	attrs := msg.Attributes{}
+
+	Append(attrs, "Content-Encoding", "lz4")
+	Append(attrs, "Content-Encoding", "gzip")
+	if got := attrs.Get("Content-Encoding"); got != "lz4, gzip" {
+		t.Errorf("expected lz4, gzip, got %q", got)
+	}
+	if got := Last(attrs, "Content-Encoding"); got != "gzip" {
+		t.Errorf("expected gzip to be applied last, got %q", got)
+	}
+
+	Pop(attrs, "Content-Encoding")
+	if got := attrs.Get("Content-Encoding"); got != "lz4" {
+		t.Errorf("expected lz4, got %q", got)
+	}
+
+	Pop(attrs, "Content-Encoding")
+	if _, ok := attrs["Content-Encoding"]; ok {
+		t.Errorf("expected Content-Encoding to be removed, got %q", attrs["Content-Encoding"])
+	}
+}
+
+func TestOuter(t *testing.T) {
+	tests := []struct {
+		encoding, transfer, order string
+		key, name                 string
+		err                       error
+	}{
+		{},
+		{encoding: "gzip", key: "Content-Encoding", name: "gzip"},
+		{encoding: "gzip", transfer: "base64", key: "Content-Transfer-Encoding", name: "base64"},
+		{encoding: "gzip", transfer: "base64", order: "gzip, base64", key: "Content-Transfer-Encoding", name: "base64"},
+		{encoding: "gzip", transfer: "base64", order: "base64, gzip", key: "Content-Encoding", name: "gzip"},
+		{encoding: "gzip", transfer: "base64", order: "gzip", err: ErrOrder},
+		{encoding: "gzip", transfer: "base64", order: "base64, lz4", err: ErrOrder},
+		{order: "gzip", err: ErrOrder},
+	}
+
+	for _, tt := range tests {
+		attrs := msg.Attributes{}
+		for k, v := range map[string]string{"Content-Encoding": tt.encoding, "Content-Transfer-Encoding": tt.transfer, Order: tt.order} {
+			if v != "" {
+				attrs.Set(k, v)
+			}
+		}
+
+		key, name, err := Outer(attrs)
+		if key != tt.key || name != tt.name || err != tt.err {
+			t.Errorf("%v: expected %q %q %v, got %q %q %v", attrs, tt.key, tt.name, tt.err, key, name, err)
+		}
+	}
+}
+
+func TestPushPop(t *testing.T) {
+	attrs := msg.Attributes{}
+
+	Push(attrs, "Content-Encoding", "gzip")
+	Push(attrs, "Content-Transfer-Encoding", "base64")
+	Push(attrs, "Content-Encoding", "lz4")
+	if got := attrs.Get(Order); got != "gzip, base64, lz4" {
+		t.Errorf("expected %s gzip, base64, lz4, got %q", Order, got)
+	}
+
+	Pop(attrs, "Content-Encoding")
+	if got := attrs.Get(Order); got != "gzip, base64" {
+		t.Errorf("expected %s gzip, base64, got %q", Order, got)
+	}
+	if got := attrs.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("expected Content-Encoding gzip, got %q", got)
+	}
+}
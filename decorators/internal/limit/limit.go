@@ -0,0 +1,108 @@
+// Package limit enforces limits on the decoded bodies of Messages, which
+// are shared by the decoding decorators.
+package limit
+
+import (
+	"io"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Limits are the limits on decoding a body. A zero limit means there is
+// no limit.
+type Limits struct {
+	// MaxSize is the maximum number of decoded bytes.
+	MaxSize int64
+
+	// MaxRatio is the maximum ratio of decoded to encoded bytes.
+	MaxRatio float64
+}
+
+// Counter counts the bytes read from R, and records the error which
+// ended them other than io.EOF.
+type Counter struct {
+	R   io.Reader
+	N   int64
+	Err error
+}
+
+func (c *Counter) Read(p []byte) (int, error) {
+	n, err := c.R.Read(p)
+	c.N += int64(n)
+	if err != nil && err != io.EOF {
+		c.Err = err
+	}
+	return n, err
+}
+
+// Reader reads a decoded body and fails with a *msg.DecodeLimitError
+// once it exceeds its Limits.
+//
+// Errors of the decoded body are decode errors, such as a corrupt
+// stream, unless reading encoded failed: those are errors of the
+// transport, and may go away if the Message is delivered again.
+type Reader struct {
+	encoding string
+	decoded  io.Reader
+	encoded  *Counter
+	limits   Limits
+
+	n         int64
+	err       error
+	decodeErr error
+}
+
+// NewReader returns a Reader of decoded, which is decoded from encoded
+// with encoding. The ratio is only enforced if encoded is not nil, and
+// without encoded every error of decoded is taken for a decode error.
+func NewReader(encoding string, decoded io.Reader, encoded *Counter, limits Limits) *Reader {
+	return &Reader{
+		encoding: encoding,
+		decoded:  decoded,
+		encoded:  encoded,
+		limits:   limits,
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// read at most one byte past the maximum size, to detect that it
+	// was exceeded
+	if max := r.limits.MaxSize; max > 0 && int64(len(p)) > max-r.n+1 {
+		p = p[:max-r.n+1]
+	}
+
+	n, err := r.decoded.Read(p)
+	r.n += int64(n)
+
+	if max := r.limits.MaxSize; max > 0 && r.n > max {
+		n -= int(r.n - max)
+		r.n = max
+		r.err = &msg.DecodeLimitError{Encoding: r.encoding, MaxSize: max}
+		return n, r.err
+	}
+	if max := r.limits.MaxRatio; max > 0 && r.encoded != nil && float64(r.n) > max*float64(r.encoded.N) {
+		r.err = &msg.DecodeLimitError{Encoding: r.encoding, MaxRatio: max}
+		return n, r.err
+	}
+	if err != nil && err != io.EOF && (r.encoded == nil || r.encoded.Err == nil) {
+		r.decodeErr = err
+	}
+	return n, err
+}
+
+// Check returns a permanent error if r exceeded its Limits or failed to
+// decode the body while it was received, whether or not the Receiver
+// returned the error it got from Read. Otherwise it returns err.
+func (r *Reader) Check(err error) error {
+	if r.err != nil {
+		return msg.Permanent(r.err)
+	}
+	if r.decodeErr != nil {
+		return msg.Permanent(r.decodeErr)
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package limit
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+func TestReader_MaxSize(t *testing.T) {
+	tests := []struct {
+		body    string
+		max     int64
+		wantErr bool
+	}{
+		{body: "abc123", max: 0},
+		{body: "abc123", max: 6},
+		{body: "abc123", max: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r := NewReader("identity", strings.NewReader(tt.body), nil, Limits{MaxSize: tt.max})
+		b, err := io.ReadAll(r)
+
+		var lerr *msg.DecodeLimitError
+		if tt.wantErr {
+			if !errors.As(err, &lerr) || lerr.MaxSize != tt.max {
+				t.Errorf("max %d: expected a DecodeLimitError, got %v", tt.max, err)
+			}
+			if int64(len(b)) != tt.max {
+				t.Errorf("max %d: expected to read %d bytes, got %d", tt.max, tt.max, len(b))
+			}
+			if !msg.IsPermanent(r.Check(nil)) {
+				t.Errorf("max %d: expected Check to return a permanent error", tt.max)
+			}
+			continue
+		}
+
+		if err != nil || string(b) != tt.body {
+			t.Errorf("max %d: expected %q, got %q, %v", tt.max, tt.body, b, err)
+		}
+		if err := r.Check(nil); err != nil {
+			t.Errorf("max %d: expected Check to return nil, got %v", tt.max, err)
+		}
+	}
+}
+
+func TestReader_MaxRatio(t *testing.T) {
+	// "decode" every encoded byte into ten bytes
+	encoded := &Counter{R: strings.NewReader(strings.Repeat("a", 10))}
+	decoded := io.MultiReader(
+		io.LimitReader(encoded, 1),
+		strings.NewReader(strings.Repeat("b", 20)),
+	)
+
+	r := NewReader("bomb", decoded, encoded, Limits{MaxRatio: 10})
+	_, err := io.ReadAll(r)
+
+	var lerr *msg.DecodeLimitError
+	if !errors.As(err, &lerr) || lerr.MaxRatio != 10 {
+		t.Fatalf("expected a DecodeLimitError, got %v", err)
+	}
+	if want := "msg: decoding bomb body exceeded max ratio of 10"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestReader_DecodeErrors(t *testing.T) {
+	errCorrupt := errors.New("corrupt")
+	errTransport := errors.New("connection reset")
+
+	tests := []struct {
+		name      string
+		encoded   io.Reader
+		decode    func(io.Reader) io.Reader
+		permanent bool
+	}{
+		{
+			name:      "Corrupt",
+			encoded:   strings.NewReader("abc123"),
+			decode:    func(r io.Reader) io.Reader { return io.MultiReader(r, iotest.ErrReader(errCorrupt)) },
+			permanent: true,
+		},
+		{
+			name:    "Transport",
+			encoded: io.MultiReader(strings.NewReader("abc123"), iotest.ErrReader(errTransport)),
+			decode:  func(r io.Reader) io.Reader { return r },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := &Counter{R: tt.encoded}
+			r := NewReader("identity", tt.decode(encoded), encoded, Limits{})
+			_, err := io.ReadAll(r)
+			if err == nil {
+				t.Fatal("expected Read to fail")
+			}
+
+			err = r.Check(err)
+			if got := msg.IsPermanent(err); got != tt.permanent {
+				t.Errorf("expected Check to return a permanent error: %v, got %v", tt.permanent, err)
+			}
+		})
+	}
+}
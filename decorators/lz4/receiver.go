@@ -5,28 +5,70 @@ import (
 
 	"github.com/pierrec/lz4/v4"
 	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
+	"github.com/zerofox-oss/go-msg/decorators/internal/limit"
 )
 
+// Options configures the Decoder.
+type Options struct {
+	MaxDecodedSize int64
+	MaxRatio       float64
+}
+
+// Option is a functional option for the Decoder.
+type Option func(*Options)
+
+// WithMaxDecodedSize sets the maximum number of bytes a Receiver can read
+// from a decoded Message.Body. The default is no limit.
+func WithMaxDecodedSize(n int64) Option {
+	return func(o *Options) {
+		o.MaxDecodedSize = n
+	}
+}
+
+// WithMaxRatio sets the maximum ratio of decoded to encoded bytes of a
+// Message.Body. The default is no limit.
+func WithMaxRatio(r float64) Option {
+	return func(o *Options) {
+		o.MaxRatio = r
+	}
+}
+
 // Decoder wraps a msg.Receiver with lz4 decoding functionality.
-// It only attempts to decode the Message.Body if Content-Encoding
-// is set to lz4. This should be used in conjuction with the base64
+// It only attempts to decode the Message.Body if lz4 is the encoding
+// applied last, in Content-Encoding, and passes next a copy of the
+// Message without it. This should be used in conjuction with the base64
 // decode decorator, when the message queue doesn't support binary.
 // In this case the base64 decorator should be the outermost decorator
 // in order to run first.
-func Decoder(next msg.Receiver) msg.Receiver {
+//
+// A Message whose body exceeds the limits set by the options fails with
+// a permanent *msg.DecodeLimitError.
+func Decoder(next msg.Receiver, opts ...Option) msg.Receiver {
+	options := &Options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	limits := limit.Limits{
+		MaxSize:  options.MaxDecodedSize,
+		MaxRatio: options.MaxRatio,
+	}
+
 	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
-		if isLz4Compressed(m) {
-			m.Body = lz4.NewReader(m.Body)
+		if !isLz4Compressed(m) {
+			return next.Receive(ctx, m)
 		}
-		return next.Receive(ctx, m)
+		encoded := &limit.Counter{R: m.Body}
+		r := limit.NewReader("lz4", lz4.NewReader(encoded), encoded, limits)
+		decoded := msg.WithBody(m, r)
+		encodings.Pop(decoded.Attributes, "Content-Encoding")
+		return r.Check(next.Receive(ctx, decoded))
 	})
 }
 
-// isLz4Compressedreturns true if Content-Encoding is set to
-// "lz4" in the passed Message's Attributes.
-//
-// Note: MIMEHeader.Get() is used to fetch this value. In the case of a list of
-// values, .Get() returns the 0th value.
+// isLz4Compressed returns true if "lz4" is the encoding applied last
+// to the body of the passed Message, in its Content-Encoding.
 func isLz4Compressed(m *msg.Message) bool {
-	return m.Attributes.Get("Content-Encoding") == "lz4"
+	key, name, err := encodings.Outer(m.Attributes)
+	return err == nil && key == "Content-Encoding" && name == "lz4"
 }
@@ -3,10 +3,12 @@ package lz4
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io/ioutil"
 	"testing"
 
 	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/backends/mem"
 )
 
 type ChanReceiver struct {
@@ -136,3 +138,66 @@ func TestIsLz4Compressed_FalseContentCompressionNotSet(t *testing.T) {
 		t.Error("Expected m not to be lz4 compressed but got true.")
 	}
 }
+
+// Tests that a Message whose body exceeds the limits of the Decoder fails
+// with a permanent DecodeLimitError.
+func TestDecoder_RejectsDecompressionBombs(t *testing.T) {
+	for _, opt := range []Option{WithMaxDecodedSize(1024), WithMaxRatio(100)} {
+		c := make(chan *msg.Message, 1)
+		w := Encoder(&mem.Topic{C: c}).NewWriter(context.Background())
+		w.Write(make([]byte, 1<<20))
+		w.Close()
+
+		r := Decoder(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			_, err := ioutil.ReadAll(m.Body)
+			return err
+		}), opt)
+
+		err := r.Receive(context.Background(), <-c)
+		var lerr *msg.DecodeLimitError
+		if !errors.As(err, &lerr) {
+			t.Errorf("expected a DecodeLimitError, got %v", err)
+		}
+		if msg.IsRetryable(err) {
+			t.Errorf("expected %v not to be retryable", err)
+		}
+	}
+}
+
+// Tests that isLz4Compressed returns false if lz4 was applied before
+// another encoding, which must be decoded first.
+func TestIsLz4Compressed_FalseAppliedBeforeOtherEncoding(t *testing.T) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+	}
+	m.Attributes.Set("Content-Encoding", "lz4, gzip")
+
+	if isLz4Compressed(m) {
+		t.Error("Expected m not to be lz4 compressed but got true.")
+	}
+
+	m.Attributes.Set("Content-Encoding", "gzip, lz4")
+	if !isLz4Compressed(m) {
+		t.Error("Expected m to be lz4 compressed but got false.")
+	}
+}
+
+// Tests that isLz4Compressed follows Msg-Encodings, which records whether
+// lz4 was applied before or after a transfer encoding.
+func TestIsLz4Compressed_FollowsEncodingOrder(t *testing.T) {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+	}
+	m.Attributes.Set("Content-Encoding", "lz4")
+	m.Attributes.Set("Content-Transfer-Encoding", "base64")
+
+	m.Attributes.Set("Msg-Encodings", "lz4, base64")
+	if isLz4Compressed(m) {
+		t.Error("Expected m not to be lz4 compressed but got true.")
+	}
+
+	m.Attributes.Set("Msg-Encodings", "base64, lz4")
+	if !isLz4Compressed(m) {
+		t.Error("Expected m to be lz4 compressed but got false.")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/pierrec/lz4/v4"
 	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/decorators/internal/encodings"
 )
 
 // Encoder wraps a topic with another which lz4-encodes a Message.
@@ -35,6 +36,12 @@ type encodeWriter struct {
 	Next msg.MessageWriter
 
 	Writer *lz4.Writer
+
+	// encoded is set once lz4 was appended to Content-Encoding, which
+	// happens before any bytes reach the next MessageWriter, so that
+	// encoders wrapped by it append their encodings after lz4.
+	encoded bool
+
 	closed bool
 	mux    sync.Mutex
 }
@@ -59,9 +66,7 @@ func (w *encodeWriter) Close() error {
 	}
 	w.closed = true
 
-	attrs := *w.Attributes()
-	attrs["Content-Encoding"] = []string{"lz4"}
-
+	w.encode()
 	if err := w.Writer.Close(); err != nil {
 		return err
 	}
@@ -77,5 +82,14 @@ func (w *encodeWriter) Write(b []byte) (int, error) {
 	if w.closed {
 		return 0, msg.ErrClosedMessageWriter
 	}
+	w.encode()
 	return w.Writer.Write(b)
 }
+
+// encode pushes lz4 onto Content-Encoding, once.
+func (w *encodeWriter) encode() {
+	if !w.encoded {
+		encodings.Push(*w.Attributes(), "Content-Encoding", "lz4")
+		w.encoded = true
+	}
+}
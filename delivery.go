@@ -0,0 +1,44 @@
+package msg
+
+import (
+	"context"
+	"time"
+)
+
+// DeliveryInfo describes a single delivery of a Message to a Receiver.
+// Servers attach it to the Context passed to Receive so that decorators
+// can inspect delivery metadata without knowing the underlying backend.
+//
+// Fields which a backend cannot provide are left as their zero value.
+type DeliveryInfo struct {
+	// MessageID is the identifier assigned to the Message by the backend.
+	MessageID string
+
+	// ReceiveCount is the number of times the Message has been delivered,
+	// including the current delivery. It is 1 on first delivery.
+	ReceiveCount int
+
+	// FirstReceived is the time the Message was first delivered.
+	FirstReceived time.Time
+
+	// PublishTime is the time the Message was persisted to the backend.
+	PublishTime time.Time
+
+	// Source is the name of the Server that delivered the Message.
+	Source string
+}
+
+type deliveryInfoKey struct{}
+
+// WithDeliveryInfo returns a copy of ctx which carries info.
+// It is intended to be used by Server implementations.
+func WithDeliveryInfo(ctx context.Context, info DeliveryInfo) context.Context {
+	return context.WithValue(ctx, deliveryInfoKey{}, info)
+}
+
+// DeliveryInfoFromContext returns the DeliveryInfo stored in ctx.
+// The boolean is false if the Server did not provide one.
+func DeliveryInfoFromContext(ctx context.Context) (DeliveryInfo, bool) {
+	info, ok := ctx.Value(deliveryInfoKey{}).(DeliveryInfo)
+	return info, ok
+}
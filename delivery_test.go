@@ -0,0 +1,32 @@
+package msg_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	msg "github.com/zerofox-oss/go-msg"
+)
+
+func TestDeliveryInfoFromContext(t *testing.T) {
+	if _, ok := msg.DeliveryInfoFromContext(context.Background()); ok {
+		t.Error("expected no DeliveryInfo in an empty context")
+	}
+
+	expected := msg.DeliveryInfo{
+		MessageID:     "1",
+		ReceiveCount:  2,
+		FirstReceived: time.Now(),
+		PublishTime:   time.Now().Add(-time.Minute),
+		Source:        "test",
+	}
+	ctx := msg.WithDeliveryInfo(context.Background(), expected)
+
+	info, ok := msg.DeliveryInfoFromContext(ctx)
+	if !ok {
+		t.Fatal("expected DeliveryInfo in context")
+	}
+	if info != expected {
+		t.Errorf("got %+v, want %+v", info, expected)
+	}
+}
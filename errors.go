@@ -0,0 +1,108 @@
+package msg
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// PermanentError signals that a Message can never be processed
+// successfully. Servers should not redeliver a Message whose
+// Receive call returned a PermanentError.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent wraps err in a PermanentError.
+// If err is nil, Permanent returns nil.
+//
+//	if err := json.Unmarshal(body, &v); err != nil {
+//		return msg.Permanent(err)
+//	}
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return "msg: permanent failure: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterError signals that a Message could not be processed and
+// should not be redelivered before Delay has elapsed.
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// RetryAfter wraps err in a RetryAfterError with the given delay.
+// If err is nil, RetryAfter returns nil.
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryAfterError{Err: err, Delay: d}
+}
+
+func (e *RetryAfterError) Error() string {
+	return "msg: retry after " + e.Delay.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeLimitError signals that decoding the body of a Message exceeded
+// a limit of a decoding decorator, e.g. because the body is a
+// decompression bomb. Decorators return it wrapped in a PermanentError.
+type DecodeLimitError struct {
+	// Encoding is the encoding which was being decoded, e.g. "lz4".
+	Encoding string
+
+	// MaxSize is the maximum decoded size in bytes, if it was exceeded.
+	MaxSize int64
+
+	// MaxRatio is the maximum ratio of decoded to encoded bytes,
+	// if it was exceeded.
+	MaxRatio float64
+}
+
+func (e *DecodeLimitError) Error() string {
+	if e.MaxRatio > 0 {
+		return "msg: decoding " + e.Encoding + " body exceeded max ratio of " +
+			strconv.FormatFloat(e.MaxRatio, 'g', -1, 64)
+	}
+	return "msg: decoding " + e.Encoding + " body exceeded max size of " +
+		strconv.FormatInt(e.MaxSize, 10) + " bytes"
+}
+
+// IsPermanent reports whether any error in err's chain is a PermanentError.
+func IsPermanent(err error) bool {
+	var pe *PermanentError
+	return errors.As(err, &pe)
+}
+
+// IsRetryable reports whether a Message whose Receive call returned err
+// should be redelivered. A nil error or a PermanentError is not retryable;
+// any other error is.
+func IsRetryable(err error) bool {
+	return err != nil && !IsPermanent(err)
+}
+
+// RetryDelay returns the delay carried by the first RetryAfterError in
+// err's chain. The boolean is false if there is no such error.
+func RetryDelay(err error) (time.Duration, bool) {
+	var re *RetryAfterError
+	if errors.As(err, &re) {
+		return re.Delay, true
+	}
+	return 0, false
+}
@@ -0,0 +1,104 @@
+package msg_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	msg "github.com/zerofox-oss/go-msg"
+)
+
+var errTest = errors.New("could not process message")
+
+func TestPermanent(t *testing.T) {
+	if err := msg.Permanent(nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	err := msg.Permanent(errTest)
+	if !errors.Is(err, errTest) {
+		t.Errorf("expected %v to wrap %v", err, errTest)
+	}
+	if !msg.IsPermanent(err) {
+		t.Errorf("expected %v to be permanent", err)
+	}
+	if msg.IsRetryable(err) {
+		t.Errorf("expected %v not to be retryable", err)
+	}
+
+	// permanent errors are still detected when wrapped
+	wrapped := fmt.Errorf("receiver: %w", err)
+	if !msg.IsPermanent(wrapped) {
+		t.Errorf("expected %v to be permanent", wrapped)
+	}
+}
+
+func TestDecodeLimitError(t *testing.T) {
+	tests := []struct {
+		err  *msg.DecodeLimitError
+		want string
+	}{
+		{
+			err:  &msg.DecodeLimitError{Encoding: "lz4", MaxSize: 1024},
+			want: "msg: decoding lz4 body exceeded max size of 1024 bytes",
+		},
+		{
+			err:  &msg.DecodeLimitError{Encoding: "gzip", MaxRatio: 100},
+			want: "msg: decoding gzip body exceeded max ratio of 100",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if err := msg.RetryAfter(nil, time.Second); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+
+	err := msg.RetryAfter(errTest, 5*time.Second)
+	if !errors.Is(err, errTest) {
+		t.Errorf("expected %v to wrap %v", err, errTest)
+	}
+	if !msg.IsRetryable(err) {
+		t.Errorf("expected %v to be retryable", err)
+	}
+
+	d, ok := msg.RetryDelay(fmt.Errorf("receiver: %w", err))
+	if !ok {
+		t.Fatalf("expected %v to carry a retry delay", err)
+	}
+	if d != 5*time.Second {
+		t.Errorf("expected delay of %v, got %v", 5*time.Second, d)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{errTest, true},
+		{msg.Permanent(errTest), false},
+		{msg.RetryAfter(errTest, time.Second), true},
+		{msg.RetryAfter(msg.Permanent(errTest), time.Second), false},
+	}
+
+	for _, tc := range tests {
+		if actual := msg.IsRetryable(tc.err); actual != tc.expected {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tc.err, actual, tc.expected)
+		}
+	}
+}
+
+func TestRetryDelay_NoDelay(t *testing.T) {
+	if _, ok := msg.RetryDelay(errTest); ok {
+		t.Errorf("expected %v not to carry a retry delay", errTest)
+	}
+}
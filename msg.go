@@ -99,6 +99,10 @@ func CloneBody(m *Message) (io.Reader, error) {
 // If Receive returns an error, the server (the caller of Receive) assumes the
 // message has not been processed and, depending on the underlying pub/sub
 // system, the message should be put back on the message queue.
+//
+// Receive may wrap its error with Permanent to signal that the message
+// should not be retried, or with RetryAfter to signal that it should not
+// be retried before a given delay.
 type Receiver interface {
 	Receive(context.Context, *Message) error
 }
@@ -0,0 +1,124 @@
+package msgtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// updateEnv is the environment variable which makes AssertGolden write
+// golden files instead of comparing against them. It is an environment
+// variable rather than a flag so that importing msgtest does not register
+// flags on the test binaries of its users.
+const updateEnv = "MSGTEST_UPDATE"
+
+// AssertAttribute fails the test if the attribute key of m is not want.
+func AssertAttribute(t testing.TB, m *msg.Message, key, want string) {
+	t.Helper()
+
+	if got := m.Attributes.Get(key); got != want {
+		t.Errorf("expected attribute %s to be %q, got %q", key, want, got)
+	}
+}
+
+// AssertBody fails the test if the body of m is not want.
+// The body remains readable afterwards.
+func AssertBody(t testing.TB, m *msg.Message, want string) {
+	t.Helper()
+
+	body, err := msg.DumpBody(m)
+	if err != nil {
+		t.Fatalf("could not read body: %s", err)
+	}
+	if string(body) != want {
+		t.Errorf("expected body %q, got %q", want, string(body))
+	}
+}
+
+// AssertJSONBody fails the test if the body of m is not a JSON document
+// equivalent to want. Formatting and object key order are ignored.
+// The body remains readable afterwards.
+func AssertJSONBody(t testing.TB, m *msg.Message, want string) {
+	t.Helper()
+
+	body, err := msg.DumpBody(m)
+	if err != nil {
+		t.Fatalf("could not read body: %s", err)
+	}
+
+	var gotDoc, wantDoc interface{}
+	if err := json.Unmarshal(body, &gotDoc); err != nil {
+		t.Fatalf("body is not valid JSON: %s: %q", err, string(body))
+	}
+	if err := json.Unmarshal([]byte(want), &wantDoc); err != nil {
+		t.Fatalf("expected body is not valid JSON: %s", err)
+	}
+	if !reflect.DeepEqual(gotDoc, wantDoc) {
+		t.Errorf("expected body %s, got %s", want, string(body))
+	}
+}
+
+// goldenMessage is the representation of a RecordedMessage in golden files.
+type goldenMessage struct {
+	Attributes msg.Attributes `json:"attributes"`
+	Body       string         `json:"body,omitempty"`
+	BodyBase64 string         `json:"bodyBase64,omitempty"`
+	Delay      string         `json:"delay,omitempty"`
+}
+
+// AssertGolden fails the test if messages differ from the snapshot stored
+// in the golden file at path. Bodies which are not valid UTF-8 are stored
+// base64-encoded.
+//
+// Run the tests with MSGTEST_UPDATE=1 to write the golden file instead.
+func AssertGolden(t testing.TB, path string, messages []*RecordedMessage) {
+	t.Helper()
+
+	golden := make([]goldenMessage, 0, len(messages))
+	for _, m := range messages {
+		gm := goldenMessage{Attributes: m.Attributes}
+		if gm.Attributes == nil {
+			gm.Attributes = msg.Attributes{}
+		}
+		if utf8.Valid(m.Body) {
+			gm.Body = string(m.Body)
+		} else {
+			gm.BodyBase64 = base64.StdEncoding.EncodeToString(m.Body)
+		}
+		if m.Delay > 0 {
+			gm.Delay = m.Delay.String()
+		}
+		golden = append(golden, gm)
+	}
+
+	got, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		t.Fatalf("could not encode messages: %s", err)
+	}
+	got = append(got, '\n')
+
+	if os.Getenv(updateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create golden file directory: %s", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("could not write golden file: %s", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read golden file (run with %s=1 to create it): %s", updateEnv, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("published messages do not match golden file %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
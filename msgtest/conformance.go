@@ -0,0 +1,341 @@
+// Package msgtest provides utilities for testing msg backends and Receivers.
+//
+// TestTopic and TestServer are conformance suites which assert that a backend
+// follows the contracts of msg.Topic, msg.MessageWriter and msg.Server. A
+// backend runs them from its own tests by providing a factory:
+//
+//	func TestConformance(t *testing.T) {
+//		msgtest.TestTopic(t, func(t *testing.T) msgtest.TopicFixture {
+//			c := make(chan *msg.Message, 100)
+//			return msgtest.TopicFixture{
+//				Topic: &mem.Topic{C: c},
+//				Next:  func(ctx context.Context) (*msg.Message, error) { ... },
+//			}
+//		})
+//	}
+package msgtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Timeout is how long the conformance suites wait for a Message to be
+// published or delivered before failing.
+var Timeout = 10 * time.Second
+
+// TopicFixture is a Topic under test.
+type TopicFixture struct {
+	Topic msg.Topic
+
+	// Next returns the next Message published to Topic. It should block
+	// until a Message is available or ctx is done.
+	Next func(ctx context.Context) (*msg.Message, error)
+}
+
+// TopicFactory returns a new, empty TopicFixture. It is called once per
+// test, and may use t.Cleanup to release resources.
+type TopicFactory func(t *testing.T) TopicFixture
+
+// ServerFixture is a Server under test.
+type ServerFixture struct {
+	Server msg.Server
+
+	// Topic publishes Messages which are delivered by Server.
+	Topic msg.Topic
+}
+
+// ServerFactory returns a new ServerFixture whose Server has not been
+// started. It is called once per test, and may use t.Cleanup to release
+// resources.
+type ServerFactory func(t *testing.T) ServerFixture
+
+// TestTopic runs the msg.Topic conformance suite against Topics created by f.
+func TestTopic(t *testing.T, f TopicFactory) {
+	t.Run("WriteAndClose", func(t *testing.T) {
+		fx := f(t)
+
+		publish(t, fx.Topic, "hello world", msg.Attributes{})
+
+		m := next(t, fx)
+		AssertBody(t, m, "hello world")
+	})
+
+	t.Run("Attributes", func(t *testing.T) {
+		fx := f(t)
+
+		attrs := msg.Attributes{}
+		attrs.Set("Content-Type", "text/plain")
+		attrs.Set("X-Request-Id", "1234")
+		publish(t, fx.Topic, "hello world", attrs)
+
+		m := next(t, fx)
+		for k := range attrs {
+			if m.Attributes.Get(k) != attrs.Get(k) {
+				t.Errorf("expected attribute %s to be %q, got %q", k, attrs.Get(k), m.Attributes.Get(k))
+			}
+		}
+	})
+
+	t.Run("ClosedMessageWriter", func(t *testing.T) {
+		fx := f(t)
+
+		w := fx.Topic.NewWriter(context.Background())
+		if _, err := w.Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write([]byte("hello again")); !errors.Is(err, msg.ErrClosedMessageWriter) {
+			t.Errorf("expected %v from Write after Close, got %v", msg.ErrClosedMessageWriter, err)
+		}
+		if err := w.Close(); !errors.Is(err, msg.ErrClosedMessageWriter) {
+			t.Errorf("expected %v from Close after Close, got %v", msg.ErrClosedMessageWriter, err)
+		}
+
+		next(t, fx)
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		fx := f(t)
+
+		const n = 20
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				publish(t, fx.Topic, fmt.Sprintf("message #%d", i), msg.Attributes{})
+			}(i)
+		}
+
+		seen := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			body, err := msg.DumpBody(next(t, fx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[string(body)] = true
+		}
+		wg.Wait()
+
+		for i := 0; i < n; i++ {
+			if body := fmt.Sprintf("message #%d", i); !seen[body] {
+				t.Errorf("expected %q to be published", body)
+			}
+		}
+	})
+}
+
+// TestServer runs the msg.Server conformance suite against Servers created by f.
+func TestServer(t *testing.T, f ServerFactory) {
+	t.Run("Serve", func(t *testing.T) {
+		fx := f(t)
+
+		attrs := msg.Attributes{}
+		attrs.Set("X-Request-Id", "1234")
+		publish(t, fx.Topic, "hello world", attrs)
+
+		received := make(chan *msg.Message, 1)
+		serve(t, fx.Server, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			received <- msg.WithBody(m, bytes.NewReader(body))
+			return nil
+		}))
+
+		m := receive(t, received)
+		AssertBody(t, m, "hello world")
+		if m.Attributes.Get("X-Request-Id") != "1234" {
+			t.Errorf("expected attribute X-Request-Id to be %q, got %q", "1234", m.Attributes.Get("X-Request-Id"))
+		}
+	})
+
+	t.Run("RetryOnError", func(t *testing.T) {
+		fx := f(t)
+
+		publish(t, fx.Topic, "hello world", msg.Attributes{})
+
+		var mux sync.Mutex
+		calls := 0
+		received := make(chan *msg.Message, 1)
+		serve(t, fx.Server, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			mux.Lock()
+			defer mux.Unlock()
+
+			calls++
+			if calls == 1 {
+				return errors.New("msgtest: try again")
+			}
+
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			received <- msg.WithBody(m, bytes.NewReader(body))
+			return nil
+		}))
+
+		AssertBody(t, receive(t, received), "hello world")
+	})
+
+	t.Run("ConcurrentMessages", func(t *testing.T) {
+		fx := f(t)
+
+		const n = 20
+		for i := 0; i < n; i++ {
+			publish(t, fx.Topic, fmt.Sprintf("message #%d", i), msg.Attributes{})
+		}
+
+		received := make(chan *msg.Message, n)
+		serve(t, fx.Server, msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			body, err := msg.DumpBody(m)
+			if err != nil {
+				return err
+			}
+			received <- msg.WithBody(m, bytes.NewReader(body))
+			return nil
+		}))
+
+		seen := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			body, err := msg.DumpBody(receive(t, received))
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen[string(body)] = true
+		}
+		for i := 0; i < n; i++ {
+			if body := fmt.Sprintf("message #%d", i); !seen[body] {
+				t.Errorf("expected %q to be delivered", body)
+			}
+		}
+	})
+
+	t.Run("ShutdownReturnsErrServerClosed", func(t *testing.T) {
+		fx := f(t)
+
+		served := make(chan error, 1)
+		go func() {
+			served <- fx.Server.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+				return nil
+			}))
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+
+		if err := fx.Server.Shutdown(ctx); err != nil && !errors.Is(err, msg.ErrServerClosed) {
+			t.Errorf("expected Shutdown to return nil or %v, got %v", msg.ErrServerClosed, err)
+		}
+
+		select {
+		case err := <-served:
+			if !errors.Is(err, msg.ErrServerClosed) {
+				t.Errorf("expected Serve to return %v, got %v", msg.ErrServerClosed, err)
+			}
+		case <-ctx.Done():
+			t.Fatal("Serve did not return after Shutdown")
+		}
+	})
+
+	t.Run("ShutdownContextExpires", func(t *testing.T) {
+		fx := f(t)
+
+		publish(t, fx.Topic, "hello world", msg.Attributes{})
+
+		inflight := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+
+		go fx.Server.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			close(inflight)
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return nil
+		}))
+
+		select {
+		case <-inflight:
+		case <-time.After(Timeout):
+			t.Fatal("timed out waiting for message to be delivered")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := fx.Server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected Shutdown to return %v, got %v", context.DeadlineExceeded, err)
+		}
+	})
+}
+
+// publish writes a Message with the given body and attributes to topic.
+func publish(t *testing.T, topic msg.Topic, body string, attrs msg.Attributes) {
+	t.Helper()
+
+	w := topic.NewWriter(context.Background())
+	for k, v := range attrs {
+		(*w.Attributes())[k] = v
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		t.Errorf("could not write message: %s", err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("could not close message writer: %s", err)
+	}
+}
+
+// next returns the next Message published to a TopicFixture.
+func next(t *testing.T, fx TopicFixture) *msg.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	m, err := fx.Next(ctx)
+	if err != nil {
+		t.Fatalf("could not get published message: %s", err)
+	}
+	return m
+}
+
+// serve starts the Server in the background and shuts it down when the
+// test completes.
+func serve(t *testing.T, srv msg.Server, r msg.Receiver) {
+	t.Helper()
+
+	go srv.Serve(r)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+}
+
+// receive waits for a Message to be sent to c.
+func receive(t *testing.T, c chan *msg.Message) *msg.Message {
+	t.Helper()
+
+	select {
+	case m := <-c:
+		return m
+	case <-time.After(Timeout):
+		t.Fatal("timed out waiting for message to be delivered")
+		return nil
+	}
+}
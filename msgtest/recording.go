@@ -0,0 +1,128 @@
+package msgtest
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// RecordedMessage is a Message published to a RecordingTopic.
+type RecordedMessage struct {
+	Attributes msg.Attributes
+	Body       []byte
+	Delay      time.Duration
+
+	// Context is the Context passed to NewWriter.
+	Context context.Context
+}
+
+// Message returns the RecordedMessage as a msg.Message with a new Body.
+func (r *RecordedMessage) Message() *msg.Message {
+	return &msg.Message{
+		Attributes: r.Attributes,
+		Body:       bytes.NewReader(r.Body),
+	}
+}
+
+// RecordingTopic is a msg.Topic which records every Message published to it.
+// It is safe to use from concurrent goroutines. The zero value is ready to use.
+type RecordingTopic struct {
+	mux      sync.Mutex
+	messages []*RecordedMessage
+}
+
+// Ensure that RecordingTopic implements msg.Topic
+var _ msg.Topic = &RecordingTopic{}
+
+// NewWriter returns a MessageWriter which records its Message on Close.
+func (t *RecordingTopic) NewWriter(ctx context.Context) msg.MessageWriter {
+	return &recordingWriter{
+		topic: t,
+		ctx:   ctx,
+
+		attributes: msg.Attributes{},
+	}
+}
+
+// Messages returns the Messages published so far, in the order they
+// were closed.
+func (t *RecordingTopic) Messages() []*RecordedMessage {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	messages := make([]*RecordedMessage, len(t.messages))
+	copy(messages, t.messages)
+	return messages
+}
+
+// Reset discards all recorded Messages.
+func (t *RecordingTopic) Reset() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.messages = nil
+}
+
+func (t *RecordingTopic) record(m *RecordedMessage) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.messages = append(t.messages, m)
+}
+
+type recordingWriter struct {
+	topic *RecordingTopic
+	ctx   context.Context
+
+	attributes msg.Attributes
+	buf        bytes.Buffer
+	delay      time.Duration
+	closed     bool
+	mux        sync.Mutex
+}
+
+// Attributes returns the attributes of the MessageWriter.
+func (w *recordingWriter) Attributes() *msg.Attributes {
+	return &w.attributes
+}
+
+// SetDelay records the delay of the Message.
+func (w *recordingWriter) SetDelay(delay time.Duration) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.delay = delay
+}
+
+// Close records the Message with its RecordingTopic.
+func (w *recordingWriter) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return msg.ErrClosedMessageWriter
+	}
+	w.closed = true
+
+	w.topic.record(&RecordedMessage{
+		Attributes: w.attributes,
+		Body:       w.buf.Bytes(),
+		Delay:      w.delay,
+		Context:    w.ctx,
+	})
+	return nil
+}
+
+// Write writes bytes to an internal buffer.
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.closed {
+		return 0, msg.ErrClosedMessageWriter
+	}
+	return w.buf.Write(p)
+}
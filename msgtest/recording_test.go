@@ -0,0 +1,65 @@
+package msgtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+type ctxKey struct{}
+
+func TestRecordingTopic(t *testing.T) {
+	topic := &msgtest.RecordingTopic{}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+	w := topic.NewWriter(ctx)
+	w.Attributes().Set("Type", "OrderPlaced")
+	w.SetDelay(time.Minute)
+	w.Write([]byte(`{"id": 1}`))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("again")); err != msg.ErrClosedMessageWriter {
+		t.Errorf("expected %v, got %v", msg.ErrClosedMessageWriter, err)
+	}
+
+	messages := topic.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	rm := messages[0]
+	if rm.Delay != time.Minute {
+		t.Errorf("expected delay of %v, got %v", time.Minute, rm.Delay)
+	}
+	if v := rm.Context.Value(ctxKey{}); v != "request-1" {
+		t.Errorf("expected context value request-1, got %v", v)
+	}
+
+	m := rm.Message()
+	msgtest.AssertAttribute(t, m, "Type", "OrderPlaced")
+	msgtest.AssertJSONBody(t, m, `{ "id": 1 }`)
+	msgtest.AssertBody(t, m, `{"id": 1}`)
+
+	topic.Reset()
+	if n := len(topic.Messages()); n != 0 {
+		t.Errorf("expected no messages after Reset, got %d", n)
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	topic := &msgtest.RecordingTopic{}
+
+	for _, body := range [][]byte{[]byte("hello world"), {0xff, 0xfe}} {
+		w := topic.NewWriter(context.Background())
+		w.Attributes().Set("Content-Type", "text/plain")
+		w.Write(body)
+		w.Close()
+	}
+
+	msgtest.AssertGolden(t, "testdata/published.golden.json", topic.Messages())
+}
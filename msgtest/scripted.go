@@ -0,0 +1,146 @@
+package msgtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zerofox-oss/go-msg"
+)
+
+// Result is the outcome of a single delivery by a ScriptedServer.
+type Result struct {
+	Message *msg.Message
+	Err     error
+}
+
+// ScriptedServer is a msg.Server which delivers a fixed list of Messages
+// to a Receiver, one at a time and in order, and records the result of
+// each Receive call. Failed Messages are not redelivered.
+//
+// Once every Message has been delivered, Serve blocks until Shutdown.
+type ScriptedServer struct {
+	messages []*msg.Message
+
+	mux      sync.Mutex
+	served   bool
+	results  []Result
+	done     chan struct{}
+	shutdown chan struct{}
+	once     sync.Once
+}
+
+// Ensure that ScriptedServer implements msg.Server
+var _ msg.Server = &ScriptedServer{}
+
+// NewScriptedServer returns a ScriptedServer which delivers messages.
+func NewScriptedServer(messages ...*msg.Message) *ScriptedServer {
+	return &ScriptedServer{
+		messages: messages,
+		done:     make(chan struct{}),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// NewMessage returns a Message with the given body and attributes,
+// which are given as alternating keys and values.
+func NewMessage(body string, kv ...string) *msg.Message {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       bytes.NewBufferString(body),
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		m.Attributes.Set(kv[i], kv[i+1])
+	}
+	return m
+}
+
+// errServed is returned by Serve when it is called more than once.
+var errServed = errors.New("msgtest: ScriptedServer can only be served once")
+
+// Serve delivers each Message to r, then blocks until Shutdown is called.
+// It returns msg.ErrServerClosed, unless the ScriptedServer has already
+// been served, since its Messages are only delivered once.
+//
+// Each Message's body is read before delivery, so that the Message
+// recorded in its Result still has a readable body.
+func (s *ScriptedServer) Serve(r msg.Receiver) error {
+	s.mux.Lock()
+	if s.served {
+		s.mux.Unlock()
+		return errServed
+	}
+	s.served = true
+	s.mux.Unlock()
+
+	s.deliver(r)
+	close(s.done)
+
+	<-s.shutdown
+	return msg.ErrServerClosed
+}
+
+// deliver delivers each Message to r, until Shutdown is called.
+func (s *ScriptedServer) deliver(r msg.Receiver) {
+	for i, m := range s.messages {
+		select {
+		case <-s.shutdown:
+			return
+		default:
+		}
+
+		body, err := msg.DumpBody(m)
+		if err != nil {
+			s.record(Result{Message: m, Err: err})
+			continue
+		}
+
+		ctx := msg.WithDeliveryInfo(context.Background(), msg.DeliveryInfo{
+			MessageID:     strconv.Itoa(i + 1),
+			ReceiveCount:  1,
+			FirstReceived: time.Now(),
+			Source:        "msgtest",
+		})
+		err = r.Receive(ctx, msg.WithBody(m, bytes.NewReader(body)))
+
+		s.record(Result{
+			Message: msg.WithBody(m, bytes.NewReader(body)),
+			Err:     err,
+		})
+	}
+}
+
+// Shutdown stops the ScriptedServer. Since Messages are delivered
+// synchronously, it does not wait for a Message in flight.
+func (s *ScriptedServer) Shutdown(ctx context.Context) error {
+	s.once.Do(func() {
+		close(s.shutdown)
+	})
+	return msg.ErrServerClosed
+}
+
+// Done returns a channel which is closed once every Message has been
+// delivered, or once Serve stopped delivering them because of Shutdown.
+func (s *ScriptedServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// Results returns the results of the deliveries made so far, in order.
+func (s *ScriptedServer) Results() []Result {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	results := make([]Result, len(s.results))
+	copy(results, s.results)
+	return results
+}
+
+func (s *ScriptedServer) record(r Result) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.results = append(s.results, r)
+}
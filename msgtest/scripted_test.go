@@ -0,0 +1,73 @@
+package msgtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zerofox-oss/go-msg"
+	"github.com/zerofox-oss/go-msg/msgtest"
+)
+
+func TestScriptedServer(t *testing.T) {
+	srv := msgtest.NewScriptedServer(
+		msgtest.NewMessage("first", "Type", "OrderPlaced"),
+		msgtest.NewMessage("second", "Type", "OrderCancelled"),
+	)
+
+	errCancelled := errors.New("cancelled orders are not supported")
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			if _, ok := msg.DeliveryInfoFromContext(ctx); !ok {
+				t.Error("expected DeliveryInfo in context")
+			}
+			if m.Attributes.Get("Type") == "OrderCancelled" {
+				return errCancelled
+			}
+			return nil
+		}))
+	}()
+
+	<-srv.Done()
+
+	results := srv.Results()
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Err != nil {
+		t.Errorf("expected first message to succeed, got %v", results[0].Err)
+	}
+	if results[1].Err != errCancelled {
+		t.Errorf("expected %v, got %v", errCancelled, results[1].Err)
+	}
+	msgtest.AssertBody(t, results[1].Message, "second")
+
+	srv.Shutdown(context.Background())
+	if err := <-served; err != msg.ErrServerClosed {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+}
+
+func TestScriptedServer_ShutdownBeforeServe(t *testing.T) {
+	srv := msgtest.NewScriptedServer(msgtest.NewMessage("first"))
+	srv.Shutdown(context.Background())
+
+	receiver := msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		t.Error("expected no delivery after Shutdown")
+		return nil
+	})
+	if err := srv.Serve(receiver); err != msg.ErrServerClosed {
+		t.Errorf("expected %v, got %v", msg.ErrServerClosed, err)
+	}
+
+	select {
+	case <-srv.Done():
+	default:
+		t.Error("expected Done to be closed once Serve returned")
+	}
+
+	if err := srv.Serve(receiver); err == nil || err == msg.ErrServerClosed {
+		t.Errorf("expected an error when serving twice, got %v", err)
+	}
+}
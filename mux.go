@@ -0,0 +1,216 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnroutable is returned by a ReceiverMux without a fallback Receiver
+// when no registered Matcher matches a Message. It is wrapped with
+// Permanent, since redelivering the Message would not change the outcome.
+var ErrUnroutable = errors.New("msg: no receiver matches message")
+
+// A Matcher reports whether a Message should be routed to a Receiver.
+type Matcher interface {
+	Match(*Message) bool
+}
+
+// The MatcherFunc is an adapter to allow the use of ordinary functions
+// as a Matcher. MatcherFunc(f) is a Matcher that calls f.
+type MatcherFunc func(*Message) bool
+
+// Match calls f(m)
+func (f MatcherFunc) Match(m *Message) bool {
+	return f(m)
+}
+
+// AttributeEquals matches Messages whose attribute key is value.
+func AttributeEquals(key, value string) Matcher {
+	return MatcherFunc(func(m *Message) bool {
+		return m.Attributes.Get(key) == value
+	})
+}
+
+// AttributePrefix matches Messages whose attribute key starts with prefix.
+// Messages without the attribute do not match.
+func AttributePrefix(key, prefix string) Matcher {
+	return MatcherFunc(func(m *Message) bool {
+		v := m.Attributes.Get(key)
+		return v != "" && strings.HasPrefix(v, prefix)
+	})
+}
+
+// AttributeRegexp matches Messages whose attribute key matches re.
+// Messages without the attribute do not match.
+func AttributeRegexp(key string, re *regexp.Regexp) Matcher {
+	return MatcherFunc(func(m *Message) bool {
+		v := m.Attributes.Get(key)
+		return v != "" && re.MatchString(v)
+	})
+}
+
+// AllOf matches Messages which are matched by every one of matchers.
+// It can be used to match on multiple attributes:
+//
+//	msg.AllOf(
+//		msg.AttributeEquals("Type", "OrderPlaced"),
+//		msg.AttributeEquals("Version", "2"),
+//	)
+func AllOf(matchers ...Matcher) Matcher {
+	return MatcherFunc(func(m *Message) bool {
+		for _, matcher := range matchers {
+			if !matcher.Match(m) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// BodyJSONEquals matches Messages whose body is a JSON document with value
+// at path. The path is a dot-separated list of object keys and array
+// indexes, optionally starting with "$.", such as "$.order.items[0].sku".
+// String values are compared as is; other values are compared using their
+// JSON encoding, such as "42" or "true".
+//
+// The body is read using CloneBody, so it remains readable by the Receiver.
+func BodyJSONEquals(path, value string) Matcher {
+	segments := parseJSONPath(path)
+
+	return MatcherFunc(func(m *Message) bool {
+		body, err := CloneBody(m)
+		if err != nil {
+			return false
+		}
+
+		var doc interface{}
+		if err := json.NewDecoder(body).Decode(&doc); err != nil {
+			return false
+		}
+
+		v, ok := lookupJSONPath(doc, segments)
+		if !ok {
+			return false
+		}
+		if s, ok := v.(string); ok {
+			return s == value
+		}
+		b, err := json.Marshal(v)
+		return err == nil && string(b) == value
+	})
+}
+
+// parseJSONPath splits a path such as "$.a.b[0]" into ["a", "b", "0"].
+func parseJSONPath(path string) []string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	var segments []string
+	for _, s := range strings.Split(path, ".") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func lookupJSONPath(doc interface{}, segments []string) (interface{}, bool) {
+	for _, s := range segments {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			next, ok := v[s]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []interface{}:
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// ReceiverMux is a Receiver which routes Messages to other Receivers,
+// similar to http.ServeMux. Routes are evaluated in the order they were
+// registered, and a Message is passed to the Receiver of the first route
+// whose Matcher matches it.
+//
+// Messages which match no route are passed to the fallback Receiver.
+// Without a fallback, Receive returns Permanent(ErrUnroutable).
+//
+// The zero value is an empty ReceiverMux ready to use.
+type ReceiverMux struct {
+	mux      sync.RWMutex
+	routes   []route
+	fallback Receiver
+}
+
+type route struct {
+	matcher  Matcher
+	receiver Receiver
+}
+
+// Ensure that ReceiverMux implements Receiver
+var _ Receiver = &ReceiverMux{}
+
+// NewReceiverMux allocates and returns a new ReceiverMux.
+func NewReceiverMux() *ReceiverMux {
+	return &ReceiverMux{}
+}
+
+// Handle registers r for Messages matched by m.
+func (mux *ReceiverMux) Handle(m Matcher, r Receiver) {
+	if m == nil {
+		panic("msg: nil matcher")
+	}
+	if r == nil {
+		panic("msg: nil receiver")
+	}
+
+	mux.mux.Lock()
+	defer mux.mux.Unlock()
+
+	mux.routes = append(mux.routes, route{matcher: m, receiver: r})
+}
+
+// HandleFunc registers f for Messages matched by m.
+func (mux *ReceiverMux) HandleFunc(m Matcher, f func(context.Context, *Message) error) {
+	mux.Handle(m, ReceiverFunc(f))
+}
+
+// HandleFallback registers r for Messages which match no route.
+func (mux *ReceiverMux) HandleFallback(r Receiver) {
+	mux.mux.Lock()
+	defer mux.mux.Unlock()
+
+	mux.fallback = r
+}
+
+// Receive passes m to the Receiver of the first matching route.
+func (mux *ReceiverMux) Receive(ctx context.Context, m *Message) error {
+	mux.mux.RLock()
+	r := mux.fallback
+	for _, route := range mux.routes {
+		if route.matcher.Match(m) {
+			r = route.receiver
+			break
+		}
+	}
+	mux.mux.RUnlock()
+
+	if r == nil {
+		return Permanent(ErrUnroutable)
+	}
+	return r.Receive(ctx, m)
+}
@@ -0,0 +1,129 @@
+package msg_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	msg "github.com/zerofox-oss/go-msg"
+)
+
+func newMessage(body string, kv ...string) *msg.Message {
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       strings.NewReader(body),
+	}
+	for i := 0; i < len(kv); i += 2 {
+		m.Attributes.Set(kv[i], kv[i+1])
+	}
+	return m
+}
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		name     string
+		matcher  msg.Matcher
+		msg      *msg.Message
+		expected bool
+	}{
+		{"equals", msg.AttributeEquals("Type", "OrderPlaced"), newMessage("", "Type", "OrderPlaced"), true},
+		{"equals mismatch", msg.AttributeEquals("Type", "OrderPlaced"), newMessage("", "Type", "OrderShipped"), false},
+		{"prefix", msg.AttributePrefix("Type", "Order"), newMessage("", "Type", "OrderShipped"), true},
+		{"prefix missing", msg.AttributePrefix("Type", ""), newMessage(""), false},
+		{"regexp", msg.AttributeRegexp("Type", regexp.MustCompile(`^Order(Placed|Shipped)$`)), newMessage("", "Type", "OrderShipped"), true},
+		{"regexp mismatch", msg.AttributeRegexp("Type", regexp.MustCompile(`^Order(Placed|Shipped)$`)), newMessage("", "Type", "OrderCancelled"), false},
+		{"all of", msg.AllOf(msg.AttributeEquals("Type", "Order"), msg.AttributeEquals("Version", "2")), newMessage("", "Type", "Order", "Version", "2"), true},
+		{"all of mismatch", msg.AllOf(msg.AttributeEquals("Type", "Order"), msg.AttributeEquals("Version", "2")), newMessage("", "Type", "Order", "Version", "1"), false},
+		{"json string", msg.BodyJSONEquals("$.order.status", "placed"), newMessage(`{"order": {"status": "placed"}}`), true},
+		{"json number", msg.BodyJSONEquals("order.items[1].qty", "2"), newMessage(`{"order": {"items": [{"qty": 1}, {"qty": 2}]}}`), true},
+		{"json bool", msg.BodyJSONEquals("$.urgent", "true"), newMessage(`{"urgent": true}`), true},
+		{"json mismatch", msg.BodyJSONEquals("$.order.status", "placed"), newMessage(`{"order": {"status": "shipped"}}`), false},
+		{"json missing path", msg.BodyJSONEquals("$.order.items[5]", "x"), newMessage(`{"order": {"items": []}}`), false},
+		{"json invalid body", msg.BodyJSONEquals("$.order", "x"), newMessage(`not json`), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.matcher.Match(tc.msg); actual != tc.expected {
+				t.Errorf("Match() = %v, want %v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+// Tests that the body is still readable after being matched on.
+func TestBodyJSONEquals_PreservesBody(t *testing.T) {
+	body := `{"status": "placed"}`
+	m := newMessage(body)
+
+	if !msg.BodyJSONEquals("status", "placed").Match(m) {
+		t.Fatal("expected message to match")
+	}
+
+	b, err := io.ReadAll(m.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != body {
+		t.Errorf("expected body %s, got %s", body, string(b))
+	}
+}
+
+func TestReceiverMux(t *testing.T) {
+	var routed []string
+	record := func(name string) msg.ReceiverFunc {
+		return func(ctx context.Context, m *msg.Message) error {
+			routed = append(routed, name)
+			return nil
+		}
+	}
+
+	mux := msg.NewReceiverMux()
+	mux.Handle(msg.AttributeEquals("Type", "OrderPlaced"), record("placed"))
+	mux.Handle(msg.AttributePrefix("Type", "Order"), record("order"))
+	mux.HandleFunc(msg.BodyJSONEquals("kind", "refund"), record("refund"))
+
+	messages := []*msg.Message{
+		newMessage("", "Type", "OrderPlaced"),
+		newMessage("", "Type", "OrderShipped"),
+		newMessage(`{"kind": "refund"}`),
+	}
+	for _, m := range messages {
+		if err := mux.Receive(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"placed", "order", "refund"}
+	if strings.Join(routed, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected messages routed to %v, got %v", expected, routed)
+	}
+}
+
+func TestReceiverMux_Unroutable(t *testing.T) {
+	var mux msg.ReceiverMux
+
+	err := mux.Receive(context.Background(), newMessage("", "Type", "Unknown"))
+	if !errors.Is(err, msg.ErrUnroutable) {
+		t.Errorf("expected %v, got %v", msg.ErrUnroutable, err)
+	}
+	if msg.IsRetryable(err) {
+		t.Errorf("expected %v not to be retryable", err)
+	}
+
+	fallback := false
+	mux.HandleFallback(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		fallback = true
+		return nil
+	}))
+
+	if err := mux.Receive(context.Background(), newMessage("", "Type", "Unknown")); err != nil {
+		t.Fatal(err)
+	}
+	if !fallback {
+		t.Error("expected fallback Receiver to be called")
+	}
+}
@@ -0,0 +1,175 @@
+package msg
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"time"
+)
+
+// A Codec encodes values into Message bodies and decodes them back.
+type Codec interface {
+	// ContentType is the media type of encoded bodies, such as
+	// "application/json". It is written to the Content-Type attribute.
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+// JSONCodec is a Codec which uses encoding/json.
+type JSONCodec struct{}
+
+// ContentType returns "application/json".
+func (JSONCodec) ContentType() string { return "application/json" }
+
+// Encode writes the JSON encoding of v to w.
+func (JSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Decode reads the JSON encoding of a value from r into v.
+func (JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// GobCodec is a Codec which uses encoding/gob.
+type GobCodec struct{}
+
+// ContentType returns "application/x-gob".
+func (GobCodec) ContentType() string { return "application/x-gob" }
+
+// Encode writes the gob encoding of v to w.
+func (GobCodec) Encode(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+// Decode reads the gob encoding of a value from r into v.
+func (GobCodec) Decode(r io.Reader, v interface{}) error {
+	return gob.NewDecoder(r).Decode(v)
+}
+
+// DecodeError is returned by a TypedReceiver when a Message cannot be
+// decoded, either because its Content-Type does not match the Codec or
+// because its body is malformed. It is wrapped with Permanent.
+type DecodeError struct {
+	ContentType string
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("msg: could not decode %q body: %s", e.ContentType, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TypedTopic publishes values of type T to a Topic, encoded with a Codec.
+type TypedTopic[T any] struct {
+	Topic Topic
+	Codec Codec
+}
+
+// NewTypedTopic returns a TypedTopic which publishes to t using c.
+func NewTypedTopic[T any](t Topic, c Codec) *TypedTopic[T] {
+	return &TypedTopic[T]{Topic: t, Codec: c}
+}
+
+// A PublishOption configures the MessageWriter of a single Publish call.
+type PublishOption func(MessageWriter)
+
+// PublishAttribute sets the attribute key to value on the published Message.
+func PublishAttribute(key, value string) PublishOption {
+	return func(w MessageWriter) {
+		w.Attributes().Set(key, value)
+	}
+}
+
+// PublishDelay delays the delivery of the published Message by d.
+func PublishDelay(d time.Duration) PublishOption {
+	return func(w MessageWriter) {
+		w.SetDelay(d)
+	}
+}
+
+// Publish encodes v and publishes it as a single Message.
+// The Content-Type attribute is set to the Codec's content type.
+//
+// v is encoded before a MessageWriter is created, so nothing is published
+// if it cannot be encoded and the Codec's error is returned. If writing
+// the encoded body fails, the MessageWriter is abandoned without being
+// closed, since closing it would publish a partial body.
+func (t *TypedTopic[T]) Publish(ctx context.Context, v T, opts ...PublishOption) error {
+	var body bytes.Buffer
+	if err := t.Codec.Encode(&body, v); err != nil {
+		return err
+	}
+
+	w := t.Topic.NewWriter(ctx)
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.Attributes().Set("Content-Type", t.Codec.ContentType())
+
+	if _, err := w.Write(body.Bytes()); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// TypedReceiver is a Receiver which decodes Messages into values of type T
+// before passing them to a function.
+//
+// Messages whose Content-Type does not match the Codec, or whose body
+// cannot be decoded, are not passed on. Instead Receive returns a
+// DecodeError wrapped with Permanent. Messages without a Content-Type
+// are decoded with the Codec.
+type TypedReceiver[T any] struct {
+	Codec   Codec
+	Handler func(context.Context, *Message, T) error
+}
+
+// NewTypedReceiver returns a TypedReceiver which decodes Messages using c
+// and passes them to f.
+func NewTypedReceiver[T any](c Codec, f func(context.Context, *Message, T) error) *TypedReceiver[T] {
+	return &TypedReceiver[T]{Codec: c, Handler: f}
+}
+
+// Receive decodes m and calls the Handler with the decoded value.
+func (r *TypedReceiver[T]) Receive(ctx context.Context, m *Message) error {
+	v, err := r.decode(m)
+	if err != nil {
+		return Permanent(err)
+	}
+	return r.Handler(ctx, m, v)
+}
+
+func (r *TypedReceiver[T]) decode(m *Message) (v T, err error) {
+	contentType := m.Attributes.Get("Content-Type")
+	if contentType != "" {
+		mediaType, _, perr := mime.ParseMediaType(contentType)
+		if perr != nil || mediaType != r.Codec.ContentType() {
+			return v, &DecodeError{
+				ContentType: contentType,
+				Err:         fmt.Errorf("expected content type %q", r.Codec.ContentType()),
+			}
+		}
+	}
+
+	// codecs may panic on values they do not support
+	defer func() {
+		if p := recover(); p != nil {
+			err = &DecodeError{ContentType: contentType, Err: fmt.Errorf("panic: %v", p)}
+		}
+	}()
+
+	if derr := r.Codec.Decode(m.Body, &v); derr != nil {
+		return v, &DecodeError{ContentType: contentType, Err: derr}
+	}
+	return v, nil
+}
@@ -0,0 +1,160 @@
+package msg_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	msg "github.com/zerofox-oss/go-msg"
+)
+
+type order struct {
+	ID    string
+	Total int
+}
+
+// recordingTopic returns a Topic whose MessageWriters are kept in ws.
+func recordingTopic(ws *[]*bufferWriter) msg.Topic {
+	return msg.TopicFunc(func(ctx context.Context) msg.MessageWriter {
+		w := &bufferWriter{attrs: msg.Attributes{}}
+		*ws = append(*ws, w)
+		return w
+	})
+}
+
+type bufferWriter struct {
+	bytes.Buffer
+	attrs  msg.Attributes
+	delay  time.Duration
+	closed bool
+}
+
+func (w *bufferWriter) Close() error                { w.closed = true; return nil }
+func (w *bufferWriter) Attributes() *msg.Attributes { return &w.attrs }
+func (w *bufferWriter) SetDelay(d time.Duration)    { w.delay = d }
+
+func TestTypedTopicAndReceiver(t *testing.T) {
+	for _, codec := range []msg.Codec{msg.JSONCodec{}, msg.GobCodec{}} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			var ws []*bufferWriter
+			topic := msg.NewTypedTopic[order](recordingTopic(&ws), codec)
+
+			expected := order{ID: "1234", Total: 42}
+			err := topic.Publish(context.Background(), expected,
+				msg.PublishAttribute("Type", "OrderPlaced"),
+				msg.PublishDelay(time.Minute),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := ws[0]
+			if !w.closed {
+				t.Error("expected MessageWriter to be closed")
+			}
+			if ct := w.attrs.Get("Content-Type"); ct != codec.ContentType() {
+				t.Errorf("expected Content-Type %s, got %s", codec.ContentType(), ct)
+			}
+			if typ := w.attrs.Get("Type"); typ != "OrderPlaced" {
+				t.Errorf("expected Type OrderPlaced, got %s", typ)
+			}
+			if w.delay != time.Minute {
+				t.Errorf("expected delay of %v, got %v", time.Minute, w.delay)
+			}
+
+			var actual order
+			r := msg.NewTypedReceiver(codec, func(ctx context.Context, m *msg.Message, o order) error {
+				actual = o
+				return nil
+			})
+			m := &msg.Message{Attributes: w.attrs, Body: &w.Buffer}
+			if err := r.Receive(context.Background(), m); err != nil {
+				t.Fatal(err)
+			}
+			if actual != expected {
+				t.Errorf("expected %+v, got %+v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestTypedTopic_EncodeError(t *testing.T) {
+	var ws []*bufferWriter
+	topic := msg.NewTypedTopic[func()](recordingTopic(&ws), msg.JSONCodec{})
+
+	err := topic.Publish(context.Background(), func() {})
+
+	var typeErr *json.UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("expected the encoding error, got %v", err)
+	}
+	if len(ws) != 0 {
+		t.Errorf("expected no MessageWriter, got %d", len(ws))
+	}
+}
+
+func TestTypedReceiver_DecodeErrors(t *testing.T) {
+	called := false
+	r := msg.NewTypedReceiver(msg.JSONCodec{}, func(ctx context.Context, m *msg.Message, o order) error {
+		called = true
+		return nil
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"wrong content type", "application/x-gob", `{"ID": "1"}`},
+		{"invalid content type", "application/json; =", `{"ID": "1"}`},
+		{"malformed body", "application/json", `{"ID": `},
+		{"malformed body without content type", "", `not json`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &msg.Message{
+				Attributes: msg.Attributes{},
+				Body:       strings.NewReader(tc.body),
+			}
+			if tc.contentType != "" {
+				m.Attributes.Set("Content-Type", tc.contentType)
+			}
+
+			err := r.Receive(context.Background(), m)
+
+			var decodeErr *msg.DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("expected a DecodeError, got %v", err)
+			}
+			if msg.IsRetryable(err) {
+				t.Errorf("expected %v not to be retryable", err)
+			}
+		})
+	}
+
+	if called {
+		t.Error("expected Handler not to be called")
+	}
+}
+
+// Tests that Content-Type parameters are ignored when matching the Codec.
+func TestTypedReceiver_ContentTypeParameters(t *testing.T) {
+	r := msg.NewTypedReceiver(msg.JSONCodec{}, func(ctx context.Context, m *msg.Message, o order) error {
+		return nil
+	})
+
+	m := &msg.Message{
+		Attributes: msg.Attributes{},
+		Body:       strings.NewReader(`{"ID": "1"}`),
+	}
+	m.Attributes.Set("Content-Type", "application/json; charset=utf-8")
+
+	if err := r.Receive(context.Background(), m); err != nil {
+		t.Error(err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 // in the ratio of the weights provided.
 type MultiServer struct {
 	servers       []msg.Server
+	names         []string
 	weights       []float64
 	concurrency   int
 	queueWaitTime time.Duration
@@ -23,6 +24,10 @@ type MultiServer struct {
 type ServerWeight struct {
 	Server msg.Server
 	Weight float64
+
+	// Name identifies the Server as the Source of the msg.DeliveryInfo
+	// passed to the receiver, unless the Server provides one itself.
+	Name string
 }
 
 // MultiServerOption is a functional option for the MultiServer.
@@ -48,16 +53,19 @@ func NewMultiServer(concurrency int, serverWeights []ServerWeight, opts ...Multi
 	}
 
 	servers := make([]msg.Server, 0, len(serverWeights))
+	names := make([]string, 0, len(serverWeights))
 	weights := make([]float64, 0, len(serverWeights))
 
 	for _, s := range serverWeights {
 		servers = append(servers, s.Server)
+		names = append(names, s.Name)
 		weights = append(weights, s.Weight)
 	}
 
 	server := &MultiServer{
 		concurrency:   concurrency,
 		servers:       servers,
+		names:         names,
 		weights:       weights,
 		queueWaitTime: 1 * time.Millisecond,
 	}
@@ -83,13 +91,32 @@ func (m *MultiServer) Serve(msg msg.Receiver) error {
 		s := s
 		i := i
 		g.Go(func() error {
-			return s.Serve(m.wfr.WithPriorityReceiver(i))
+			return s.Serve(withDeliveryInfo(m.names[i], m.wfr.WithPriorityReceiver(i)))
 		})
 	}
 
 	return g.Wait()
 }
 
+// withDeliveryInfo ensures that a msg.DeliveryInfo is available to next.
+// If the underlying Server did not provide one, a new one is created for
+// the current delivery. An empty Source is set to name.
+func withDeliveryInfo(name string, next msg.Receiver) msg.Receiver {
+	return msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+		info, ok := msg.DeliveryInfoFromContext(ctx)
+		if !ok {
+			info = msg.DeliveryInfo{
+				ReceiveCount:  1,
+				FirstReceived: time.Now(),
+			}
+		}
+		if info.Source == "" {
+			info.Source = name
+		}
+		return next.Receive(msg.WithDeliveryInfo(ctx, info), m)
+	})
+}
+
 // Shutdown shuts down the server.
 func (m *MultiServer) Shutdown(ctx context.Context) error {
 	g := errgroup.Group{}
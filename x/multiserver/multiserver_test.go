@@ -110,3 +110,35 @@ func TestMultiServer(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiServer_DeliveryInfo(t *testing.T) {
+	inputChan := make(chan *msg.Message, 1)
+	server := mem.NewServer(inputChan, 1)
+
+	mserver, err := multiserver.NewMultiServer(1, []multiserver.ServerWeight{
+		{Server: server, Weight: 1, Name: "high-priority"},
+	})
+	assert.NoError(t, err)
+
+	infos := make(chan msg.DeliveryInfo, 1)
+	go func() {
+		mserver.Serve(msg.ReceiverFunc(func(ctx context.Context, m *msg.Message) error {
+			info, ok := msg.DeliveryInfoFromContext(ctx)
+			assert.True(t, ok)
+			infos <- info
+			return nil
+		}))
+	}()
+
+	inputChan <- &msg.Message{
+		Body:       bytes.NewBufferString("hello world"),
+		Attributes: msg.Attributes{},
+	}
+
+	info := <-infos
+	assert.Equal(t, "high-priority", info.Source)
+	assert.Equal(t, 1, info.ReceiveCount)
+	assert.NotEmpty(t, info.MessageID)
+
+	mserver.Shutdown(context.Background())
+}